@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/tneuqole/monkey-go/token"
@@ -45,9 +46,10 @@ func (p *Program) String() string {
 }
 
 type LetStatement struct {
-	Token token.Token // the LET token
-	Name  *Identifier
-	Value Expression
+	Token  token.Token // the LET token
+	Name   *Identifier
+	Value  Expression
+	Export bool // declared with export let
 }
 
 func (ls *LetStatement) statementNode()       {}
@@ -56,6 +58,9 @@ func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
+	if ls.Export {
+		out.WriteString("export ")
+	}
 	out.WriteString(ls.TokenLiteral() + " ")
 	out.WriteString(ls.Name.String())
 	out.WriteString(" = ")
@@ -196,8 +201,9 @@ func (ie *IfExpression) String() string {
 }
 
 type BlockStatement struct {
-	Token      token.Token // the LET token
+	Token      token.Token // the { token
 	Statements []Statement
+	End        token.Token // the } token
 }
 
 func (bs *BlockStatement) statementNode()       {}
@@ -316,6 +322,7 @@ func (ie *IndexExpression) String() string {
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	Keys  []Expression // keys of Pairs in source order
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -324,8 +331,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for k, v := range hl.Pairs {
-		pairs = append(pairs, k.String()+":"+v.String())
+	for _, k := range hl.OrderedKeys() {
+		pairs = append(pairs, k.String()+":"+hl.Pairs[k].String())
 	}
 
 	out.WriteString("{")
@@ -335,6 +342,24 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+// OrderedKeys returns the keys of Pairs in source order. Hash literals built
+// without Keys fall back to ordering by String().
+func (hl *HashLiteral) OrderedKeys() []Expression {
+	if len(hl.Keys) == len(hl.Pairs) {
+		return hl.Keys
+	}
+
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for k := range hl.Pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+
+	return keys
+}
+
 type MacroLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
@@ -359,3 +384,14 @@ func (ml *MacroLiteral) String() string {
 
 	return out.String()
 }
+
+type ImportExpression struct {
+	Token token.Token // the IMPORT token
+	Path  *StringLiteral
+}
+
+func (ie *ImportExpression) expressionNode()      {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) String() string {
+	return ie.TokenLiteral() + ` "` + ie.Path.Value + `"`
+}
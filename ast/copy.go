@@ -0,0 +1,162 @@
+package ast
+
+// Copy returns a deep copy of node, so that Modify can change the copy and
+// leave node as it is. Tokens and literal values are shared.
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		return &Program{Statements: copyStatements(node.Statements)}
+	case Statement:
+		return copyStatement(node)
+	case Expression:
+		return copyExpression(node)
+	default:
+		return node
+	}
+}
+
+func copyStatements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	copied := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		copied[i] = copyStatement(stmt)
+	}
+	return copied
+}
+
+func copyStatement(stmt Statement) Statement {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		c := *stmt
+		c.Name = copyIdentifier(stmt.Name)
+		c.Value = copyExpression(stmt.Value)
+		return &c
+	case *ReturnStatement:
+		c := *stmt
+		c.ReturnValue = copyExpression(stmt.ReturnValue)
+		return &c
+	case *ExpressionStatement:
+		c := *stmt
+		c.Expression = copyExpression(stmt.Expression)
+		return &c
+	case *BlockStatement:
+		return copyBlock(stmt)
+	default:
+		return stmt
+	}
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	c := *block
+	c.Statements = copyStatements(block.Statements)
+	return &c
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	c := *ident
+	return &c
+}
+
+func copyIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	copied := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		copied[i] = copyIdentifier(ident)
+	}
+	return copied
+}
+
+func copyExpressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+	copied := make([]Expression, len(exps))
+	for i, exp := range exps {
+		copied[i] = copyExpression(exp)
+	}
+	return copied
+}
+
+func copyExpression(exp Expression) Expression {
+	switch exp := exp.(type) {
+	case *Identifier:
+		return copyIdentifier(exp)
+	case *IntegerLiteral:
+		c := *exp
+		return &c
+	case *Boolean:
+		c := *exp
+		return &c
+	case *StringLiteral:
+		c := *exp
+		return &c
+	case *PrefixExpression:
+		c := *exp
+		c.Right = copyExpression(exp.Right)
+		return &c
+	case *InfixExpression:
+		c := *exp
+		c.Left = copyExpression(exp.Left)
+		c.Right = copyExpression(exp.Right)
+		return &c
+	case *IfExpression:
+		c := *exp
+		c.Condition = copyExpression(exp.Condition)
+		c.Consequence = copyBlock(exp.Consequence)
+		c.Alternative = copyBlock(exp.Alternative)
+		return &c
+	case *FunctionLiteral:
+		c := *exp
+		c.Parameters = copyIdentifiers(exp.Parameters)
+		c.Body = copyBlock(exp.Body)
+		return &c
+	case *MacroLiteral:
+		c := *exp
+		c.Parameters = copyIdentifiers(exp.Parameters)
+		c.Body = copyBlock(exp.Body)
+		return &c
+	case *CallExpression:
+		c := *exp
+		c.Function = copyExpression(exp.Function)
+		c.Arguments = copyExpressions(exp.Arguments)
+		return &c
+	case *ArrayLiteral:
+		c := *exp
+		c.Elements = copyExpressions(exp.Elements)
+		return &c
+	case *IndexExpression:
+		c := *exp
+		c.Left = copyExpression(exp.Left)
+		c.Index = copyExpression(exp.Index)
+		return &c
+	case *HashLiteral:
+		c := *exp
+		c.Pairs = make(map[Expression]Expression, len(exp.Pairs))
+		c.Keys = make([]Expression, 0, len(exp.Pairs))
+		for _, k := range exp.OrderedKeys() {
+			key := copyExpression(k)
+			c.Pairs[key] = copyExpression(exp.Pairs[k])
+			c.Keys = append(c.Keys, key)
+		}
+		return &c
+	case *ImportExpression:
+		c := *exp
+		if exp.Path != nil {
+			path := *exp.Path
+			c.Path = &path
+		}
+		return &c
+	default:
+		return exp
+	}
+}
@@ -0,0 +1,44 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/tneuqole/monkey-go/token"
+)
+
+func TestCopy(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1} }
+	key := &StringLiteral{Value: "k"}
+	program := &Program{Statements: []Statement{
+		&LetStatement{Name: &Identifier{Value: "f"}, Value: &FunctionLiteral{
+			Parameters: []*Identifier{{Value: "x"}},
+			Body: &BlockStatement{Statements: []Statement{
+				&ReturnStatement{ReturnValue: &InfixExpression{Operator: "+", Left: one(), Right: one()}},
+			}},
+		}},
+		&ExpressionStatement{Expression: &IfExpression{
+			Condition:   &PrefixExpression{Operator: "!", Right: &Boolean{Value: true}},
+			Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+		}},
+		&ExpressionStatement{Expression: &CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one()}}},
+		&ExpressionStatement{Expression: &IndexExpression{Left: &ArrayLiteral{Elements: []Expression{one()}}, Index: one()}},
+		&ExpressionStatement{Expression: &HashLiteral{Pairs: map[Expression]Expression{key: one()}, Keys: []Expression{key}}},
+	}}
+	want := program.String()
+
+	copied := Copy(program)
+	if got := copied.String(); got != want {
+		t.Fatalf("copy is %q, want %q", got, want)
+	}
+
+	Modify(copied, func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok {
+			integer.Token.Literal = "2"
+			integer.Value = 2
+		}
+		return node
+	})
+	if got := program.String(); got != want {
+		t.Errorf("modifying the copy changed the original to %q, want %q", got, want)
+	}
+}
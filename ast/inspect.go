@@ -0,0 +1,79 @@
+package ast
+
+import "reflect"
+
+// Inspect traverses the AST in depth-first order, calling f for each node.
+// If f returns false, the children of that node are skipped.
+func Inspect(node Node, f func(Node) bool) {
+	if IsNil(node) || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, f)
+		}
+	case *ExpressionStatement:
+		Inspect(node.Expression, f)
+	case *InfixExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Right, f)
+	case *PrefixExpression:
+		Inspect(node.Right, f)
+	case *IndexExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Index, f)
+	case *IfExpression:
+		Inspect(node.Condition, f)
+		Inspect(node.Consequence, f)
+		if node.Alternative != nil {
+			Inspect(node.Alternative, f)
+		}
+	case *BlockStatement:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, f)
+		}
+	case *ReturnStatement:
+		Inspect(node.ReturnValue, f)
+	case *LetStatement:
+		Inspect(node.Name, f)
+		Inspect(node.Value, f)
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			Inspect(p, f)
+		}
+		Inspect(node.Body, f)
+	case *MacroLiteral:
+		for _, p := range node.Parameters {
+			Inspect(p, f)
+		}
+		Inspect(node.Body, f)
+	case *CallExpression:
+		Inspect(node.Function, f)
+		for _, arg := range node.Arguments {
+			Inspect(arg, f)
+		}
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			Inspect(el, f)
+		}
+	case *HashLiteral:
+		for _, k := range node.OrderedKeys() {
+			Inspect(k, f)
+			Inspect(node.Pairs[k], f)
+		}
+	case *ImportExpression:
+		Inspect(node.Path, f)
+	}
+}
+
+// IsNil reports whether node is nil or a typed nil pointer, which the
+// parser leaves behind for parts of the program it failed to parse.
+func IsNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
@@ -40,12 +40,15 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		}
 	case *HashLiteral:
 		newPairs := make(map[Expression]Expression)
-		for k, v := range node.Pairs {
+		newKeys := make([]Expression, 0, len(node.Pairs))
+		for _, k := range node.OrderedKeys() {
 			key, _ := Modify(k, modifier).(Expression)
-			val, _ := Modify(v, modifier).(Expression)
+			val, _ := Modify(node.Pairs[k], modifier).(Expression)
 			newPairs[key] = val
+			newKeys = append(newKeys, key)
 		}
 		node.Pairs = newPairs
+		node.Keys = newKeys
 	}
 
 	return modifier(node)
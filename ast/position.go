@@ -0,0 +1,62 @@
+package ast
+
+import "github.com/tneuqole/monkey-go/token"
+
+// Start returns the first token of node in the source. Infix, call and index
+// expressions are keyed by their operator token, so Start descends into
+// their left operand.
+func Start(node Node) token.Token {
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) > 0 {
+			return Start(node.Statements[0])
+		}
+	case *LetStatement:
+		return node.Token
+	case *ReturnStatement:
+		return node.Token
+	case *ExpressionStatement:
+		return node.Token
+	case *BlockStatement:
+		return node.Token
+	case *Identifier:
+		return node.Token
+	case *IntegerLiteral:
+		return node.Token
+	case *StringLiteral:
+		return node.Token
+	case *Boolean:
+		return node.Token
+	case *PrefixExpression:
+		return node.Token
+	case *IfExpression:
+		return node.Token
+	case *FunctionLiteral:
+		return node.Token
+	case *MacroLiteral:
+		return node.Token
+	case *ArrayLiteral:
+		return node.Token
+	case *HashLiteral:
+		return node.Token
+	case *ImportExpression:
+		return node.Token
+	case *InfixExpression:
+		if node.Left != nil {
+			return Start(node.Left)
+		}
+		return node.Token
+	case *CallExpression:
+		if node.Function != nil {
+			return Start(node.Function)
+		}
+		return node.Token
+	case *IndexExpression:
+		if node.Left != nil {
+			return Start(node.Left)
+		}
+		return node.Token
+	}
+
+	return token.Token{}
+}
@@ -1,70 +1,110 @@
+// Command benchmark runs a suite of Monkey programs in the VM and the
+// evaluator and reports the time and allocations of each run. With -json
+// it writes the results for -compare to check a later run against.
+//
+// The same suite runs as Go benchmarks with
+//
+//	go test -bench . -benchmem ./benchmark
 package main
 
 import (
 	"flag"
 	"fmt"
+	"os"
+	"regexp"
 	"time"
-
-	"github.com/tneuqole/monkey-go/compiler"
-	"github.com/tneuqole/monkey-go/evaluator"
-	"github.com/tneuqole/monkey-go/lexer"
-	"github.com/tneuqole/monkey-go/object"
-	"github.com/tneuqole/monkey-go/parser"
-	"github.com/tneuqole/monkey-go/vm"
 )
 
-var engine = flag.String("engine", "vm", "use 'vm' or 'eval'")
-
-var input = `
-	let fibonacci = fn(x) {
-		if (x == 0) {
-			0
-		} else {
-			if (x == 1) {
-				return 1;
-			} else {
-				fibonacci(x - 1) + fibonacci(x - 2);
-			}
-		}
-	};
-	fibonacci(35);
-`
-
 func main() {
-	flag.Parse()
-
-	var duration time.Duration
-	var result object.Object
+	os.Exit(run())
+}
 
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
+func run() int {
+	engine := flag.String("engine", "", "run only in `engine` vm or eval")
+	pattern := flag.String("run", "", "run only programs matching `regexp`")
+	benchtime := flag.Duration("benchtime", time.Second, "run each program for at least `duration`")
+	asJSON := flag.Bool("json", false, "write the results as JSON")
+	compare := flag.String("compare", "", "compare the results to those of an earlier -json run in `file`")
+	threshold := flag.Float64("threshold", 10, "report a regression when time or allocations grow by more than `percent`")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: benchmark [-engine vm|eval] [-run regexp] [-benchtime d] [-json] [-compare old.json [-threshold percent]] [new.json]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-	if *engine == "vm" {
-		comp := compiler.New()
-		err := comp.Compile(program)
-		if err != nil {
-			fmt.Printf("compiler error: %s", err)
-			return
+	if flag.NArg() > 1 || (flag.NArg() == 1 && *compare == "") {
+		flag.Usage()
+		return 2
+	}
+	var re *regexp.Regexp
+	if *pattern != "" {
+		var err error
+		if re, err = regexp.Compile(*pattern); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -run: %v\n", err)
+			return 2
 		}
+	}
+	selected := []Engine{}
+	for _, e := range engines {
+		if *engine == "" || *engine == e.Name {
+			selected = append(selected, e)
+		}
+	}
+	if len(selected) == 0 {
+		fmt.Fprintf(os.Stderr, "unknown engine %q\n", *engine)
+		return 2
+	}
 
-		machine := vm.New(comp.Bytecode())
-		start := time.Now()
-
-		err = machine.Run()
-		if err != nil {
-			fmt.Printf("vm error: %s", err)
-			return
+	var old []Result
+	if *compare != "" {
+		var err error
+		if old, err = readResults(*compare); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
 		}
+	}
 
-		duration = time.Since(start)
-		result = machine.LastPoppedStackElem()
+	var results []Result
+	if flag.NArg() == 1 {
+		// compare two earlier runs instead of measuring
+		var err error
+		if results, err = readResults(flag.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
 	} else {
-		env := object.NewEnvironment()
-		start := time.Now()
-		result = evaluator.Eval(program, env)
-		duration = time.Since(start)
+		for _, p := range programs {
+			if re != nil && !re.MatchString(p.Name) {
+				continue
+			}
+			for _, e := range selected {
+				r, err := measure(e, p, *benchtime)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					return 1
+				}
+				results = append(results, r)
+			}
+		}
 	}
 
-	fmt.Printf("engine=%s, result=%s, duration=%s\n", *engine, result.Inspect(), duration)
+	if *compare != "" {
+		changes := Compare(old, results, *threshold)
+		WriteComparison(os.Stdout, changes)
+		for _, c := range changes {
+			if c.Regression {
+				return 1
+			}
+		}
+		return 0
+	}
+	if *asJSON {
+		if err := WriteJSON(os.Stdout, results); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	WriteText(os.Stdout, results)
+	return 0
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Result is what one engine measured for one program, per run.
+type Result struct {
+	Program     string `json:"program"`
+	Engine      string `json:"engine"`
+	Runs        int    `json:"runs"`
+	NsPerOp     int64  `json:"ns_per_op"`
+	BytesPerOp  int64  `json:"bytes_per_op"`
+	AllocsPerOp int64  `json:"allocs_per_op"`
+}
+
+// measure runs p in e repeatedly for at least benchtime, after one run to
+// check its value, and averages the time and allocations of the runs.
+func measure(e Engine, p Program, benchtime time.Duration) (Result, error) {
+	result, err := e.Run(p.Source)
+	if err != nil {
+		return Result{}, fmt.Errorf("%s in %s: %w", p.Name, e.Name, err)
+	}
+	if got := result.Inspect(); got != p.Want {
+		return Result{}, fmt.Errorf("%s in %s: got %s, want %s", p.Name, e.Name, got, p.Want)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	runs := 0
+	for runs == 0 || time.Since(start) < benchtime {
+		e.Run(p.Source)
+		runs++
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	return Result{
+		Program:     p.Name,
+		Engine:      e.Name,
+		Runs:        runs,
+		NsPerOp:     elapsed.Nanoseconds() / int64(runs),
+		BytesPerOp:  int64(after.TotalAlloc-before.TotalAlloc) / int64(runs),
+		AllocsPerOp: int64(after.Mallocs-before.Mallocs) / int64(runs),
+	}, nil
+}
+
+// WriteText writes results as a table and, for programs run in both
+// engines, how many times slower the evaluator is than the VM.
+func WriteText(w io.Writer, results []Result) {
+	fmt.Fprintf(w, "%-12s %-6s %8s %14s %12s %12s\n", "program", "engine", "runs", "ns/op", "B/op", "allocs/op")
+	for _, r := range results {
+		fmt.Fprintf(w, "%-12s %-6s %8d %14d %12d %12d\n", r.Program, r.Engine, r.Runs, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp)
+	}
+
+	times := make(map[[2]string]int64)
+	for _, r := range results {
+		times[[2]string{r.Program, r.Engine}] = r.NsPerOp
+	}
+	var ratios []float64
+	for _, r := range results {
+		if r.Engine != "vm" {
+			continue
+		}
+		if eval, ok := times[[2]string{r.Program, "eval"}]; ok && r.NsPerOp > 0 {
+			if len(ratios) == 0 {
+				fmt.Fprintf(w, "\n%-12s %8s\n", "program", "eval/vm")
+			}
+			ratio := float64(eval) / float64(r.NsPerOp)
+			ratios = append(ratios, ratio)
+			fmt.Fprintf(w, "%-12s %7.2fx\n", r.Program, ratio)
+		}
+	}
+	if len(ratios) > 1 {
+		fmt.Fprintf(w, "%-12s %7.2fx\n", "geomean", geomean(ratios))
+	}
+}
+
+func geomean(xs []float64) float64 {
+	sum := 0.0
+	for _, x := range xs {
+		sum += math.Log(x)
+	}
+	return math.Exp(sum / float64(len(xs)))
+}
+
+// WriteJSON writes results as a JSON array, which -compare reads back.
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+func readResults(filename string) ([]Result, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return results, nil
+}
+
+// Change is how a result differs between two runs of the suite, in percent
+// of the old one.
+type Change struct {
+	Old, New Result
+	Time     float64
+	Allocs   float64
+	// Regression is set if the time or allocations grew by more than the
+	// threshold.
+	Regression bool
+}
+
+// Compare matches the results of new to those of old by program and engine.
+// Results that are in only one of them are left out.
+func Compare(old, new []Result, threshold float64) []Change {
+	byKey := make(map[[2]string]Result)
+	for _, r := range old {
+		byKey[[2]string{r.Program, r.Engine}] = r
+	}
+	changes := []Change{}
+	for _, r := range new {
+		o, ok := byKey[[2]string{r.Program, r.Engine}]
+		if !ok {
+			continue
+		}
+		c := Change{Old: o, New: r, Time: delta(o.NsPerOp, r.NsPerOp), Allocs: delta(o.AllocsPerOp, r.AllocsPerOp)}
+		c.Regression = c.Time > threshold || c.Allocs > threshold
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func delta(old, new int64) float64 {
+	if old == 0 {
+		if new == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return 100 * float64(new-old) / float64(old)
+}
+
+// WriteComparison writes changes as a table, marking the regressions.
+func WriteComparison(w io.Writer, changes []Change) {
+	fmt.Fprintf(w, "%-12s %-6s %14s %14s %8s %12s %12s %8s\n", "program", "engine", "old ns/op", "new ns/op", "delta", "old allocs", "new allocs", "delta")
+	for _, c := range changes {
+		mark := ""
+		if c.Regression {
+			mark = "  REGRESSION"
+		}
+		fmt.Fprintf(w, "%-12s %-6s %14d %14d %+7.1f%% %12d %12d %+7.1f%%%s\n",
+			c.New.Program, c.New.Engine, c.Old.NsPerOp, c.New.NsPerOp, c.Time, c.Old.AllocsPerOp, c.New.AllocsPerOp, c.Allocs, mark)
+	}
+}
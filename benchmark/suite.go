@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/compiler"
+	"github.com/tneuqole/monkey-go/evaluator"
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/object"
+	"github.com/tneuqole/monkey-go/parser"
+	"github.com/tneuqole/monkey-go/vm"
+)
+
+// Program is a benchmark: Monkey source and the Inspect of the value it must
+// evaluate to.
+type Program struct {
+	Name   string
+	Source string
+	Want   string
+}
+
+// Engine runs source from scratch: parsing, expanding macros, compiling if
+// it compiles, and running it, so that each engine is measured for all the
+// work it does.
+type Engine struct {
+	Name string
+	Run  func(source string) (object.Object, error)
+}
+
+var engines = []Engine{
+	{"vm", runVM},
+	{"eval", runEvaluator},
+}
+
+// programs is the suite, each a few milliseconds in the VM.
+var programs = []Program{
+	{"fibonacci", `
+		let fibonacci = fn(x) {
+			if (x == 0) {
+				0
+			} else {
+				if (x == 1) {
+					return 1;
+				} else {
+					fibonacci(x - 1) + fibonacci(x - 2);
+				}
+			}
+		};
+		fibonacci(20);
+	`, "6765"},
+	{"closures", `
+		let compose = fn(f, g) { fn(x) { g(f(x)) } };
+		let adder = fn(n) { fn(x) { x + n } };
+		let chain = fn(i, f) {
+			if (i == 0) { f } else { chain(i - 1, compose(f, adder(i))) }
+		};
+		let run = fn(i, acc) {
+			if (i == 0) { acc } else { run(i - 1, acc + chain(200, fn(x) { x })(i)) }
+		};
+		run(20, 0);
+	`, "402210"},
+	{"arrays", `
+		let build = fn(i, xs) {
+			if (i == 0) { xs } else { build(i - 1, push(xs, i)) }
+		};
+		let sum = fn(xs, acc) {
+			if (len(xs) == 0) { acc } else { sum(rest(xs), acc + first(xs)) }
+		};
+		let run = fn(i, acc) {
+			if (i == 0) { acc } else {
+				let xs = build(200, []);
+				run(i - 1, acc + sum(xs, 0) + xs[0] - xs[len(xs) - 1])
+			}
+		};
+		run(5, 0);
+	`, "101495"},
+	{"hashes", `
+		let point = fn(x, y) { {"x": x, "y": y} };
+		let table = fn(i, h) {
+			if (i == 0) { h } else { table(i - 1, merge(h, {i: point(i, i * i)})) }
+		};
+		let h = table(100, {});
+		let sum = fn(i, acc) {
+			if (i == 0) { acc } else { sum(i - 1, acc + h[i]["y"] - h[i]["x"]) }
+		};
+		sum(100, 0) + len(keys(h));
+	`, "333400"},
+	{"strings", `
+		let build = fn(i, s) {
+			if (i == 0) { s } else { build(i - 1, s + "ab" + "c") }
+		};
+		let s = build(200, "");
+		let line = fn(i, s) {
+			if (i == 0) { s } else { line(i - 1, s + format("{}={} ", i, i * i)) }
+		};
+		len(s) + len(replace(upper(s), "AB", "x")) + len(split(trim(line(200, "")), " "));
+	`, "1200"},
+	{"builtins", `
+		let xs = range(1000);
+		let evens = filter(xs, fn(x) { x / 2 * 2 == x });
+		let squares = map(evens, fn(x) { x * x });
+		let total = reduce(reverse(sort(squares)), fn(acc, x) { acc + x }, 0);
+		total + len(uniq(map(xs, fn(x) { x / 10 }))) + index_of(xs, 999);
+	`, "166168099"},
+	{"macros", macroProgram(200), "59700"},
+}
+
+// macroProgram returns a program that expands two macros n times each.
+func macroProgram(n int) string {
+	var b strings.Builder
+	b.WriteString(`
+		let unless = macro(cond, cons, alt) {
+			quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) })
+		};
+		let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+	`)
+	fmt.Fprintf(&b, "let %s = 0;\n", variable(0))
+	// macro calls in the arguments of others are not expanded
+	for i := 1; i < n; i++ {
+		fmt.Fprintf(&b, "let %s = %s + unless(%d > %d, %d, 0);\n", variable(2*i-1), variable(2*i-2), i, n, i)
+		fmt.Fprintf(&b, "let %s = %s + twice(%d);\n", variable(2*i), variable(2*i-1), i)
+	}
+	fmt.Fprintf(&b, "%s;\n", variable(2*n-2))
+	return b.String()
+}
+
+// variable names the ith variable of macroProgram with letters, as
+// identifiers cannot have digits.
+func variable(i int) string {
+	name := ""
+	for {
+		name = string(rune('a'+i%26)) + name
+		i /= 26
+		if i == 0 {
+			return "v" + name
+		}
+	}
+}
+
+func expand(source string) (*ast.Program, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, fmt.Errorf("parser errors: %s", strings.Join(errs, "; "))
+	}
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	node, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		return nil, err
+	}
+	return node.(*ast.Program), nil
+}
+
+func runVM(source string) (object.Object, error) {
+	program, err := expand(source)
+	if err != nil {
+		return nil, err
+	}
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+	machine := vm.New(c.Bytecode())
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+	return machine.LastPoppedStackElem(), nil
+}
+
+func runEvaluator(source string) (object.Object, error) {
+	program, err := expand(source)
+	if err != nil {
+		return nil, err
+	}
+	result := evaluator.Eval(program, object.NewEnvironment())
+	if err, ok := result.(*object.Error); ok {
+		return nil, fmt.Errorf("%s", err.Message)
+	}
+	return result, nil
+}
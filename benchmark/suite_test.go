@@ -0,0 +1,103 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPrograms(t *testing.T) {
+	for _, p := range programs {
+		for _, e := range engines {
+			result, err := e.Run(p.Source)
+			if err != nil {
+				t.Errorf("%s in %s: %v", p.Name, e.Name, err)
+				continue
+			}
+			if got := result.Inspect(); got != p.Want {
+				t.Errorf("%s in %s: got %s, want %s", p.Name, e.Name, got, p.Want)
+			}
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	old := []Result{
+		{Program: "fibonacci", Engine: "vm", NsPerOp: 1000, AllocsPerOp: 10},
+		{Program: "fibonacci", Engine: "eval", NsPerOp: 3000, AllocsPerOp: 100},
+		{Program: "arrays", Engine: "vm", NsPerOp: 1000, AllocsPerOp: 0},
+		{Program: "gone", Engine: "vm", NsPerOp: 1000},
+	}
+	new := []Result{
+		{Program: "fibonacci", Engine: "vm", NsPerOp: 1050, AllocsPerOp: 10},
+		{Program: "fibonacci", Engine: "eval", NsPerOp: 2000, AllocsPerOp: 120},
+		{Program: "arrays", Engine: "vm", NsPerOp: 1200, AllocsPerOp: 0},
+		{Program: "added", Engine: "vm", NsPerOp: 1000},
+	}
+
+	changes := Compare(old, new, 10)
+	want := []struct {
+		program, engine string
+		time, allocs    float64
+		regression      bool
+	}{
+		{"fibonacci", "vm", 5, 0, false},
+		{"fibonacci", "eval", -100.0 / 3, 20, true},
+		{"arrays", "vm", 20, 0, true},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.New.Program != w.program || c.New.Engine != w.engine || c.Old.Program != w.program {
+			t.Errorf("change %d is for %s in %s, want %s in %s", i, c.New.Program, c.New.Engine, w.program, w.engine)
+		}
+		if int(c.Time*100) != int(w.time*100) || c.Allocs != w.allocs || c.Regression != w.regression {
+			t.Errorf("%s in %s: got time %.2f%% allocs %.2f%% regression %t, want %.2f%% %.2f%% %t",
+				w.program, w.engine, c.Time, c.Allocs, c.Regression, w.time, w.allocs, w.regression)
+		}
+	}
+
+	var b strings.Builder
+	WriteComparison(&b, changes)
+	if got := strings.Count(b.String(), "REGRESSION"); got != 2 {
+		t.Errorf("got %d regressions in\n%s", got, b.String())
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var b strings.Builder
+	WriteText(&b, []Result{
+		{Program: "fibonacci", Engine: "vm", Runs: 10, NsPerOp: 1000},
+		{Program: "fibonacci", Engine: "eval", Runs: 5, NsPerOp: 3000},
+		{Program: "arrays", Engine: "vm", Runs: 10, NsPerOp: 1000},
+		{Program: "arrays", Engine: "eval", Runs: 10, NsPerOp: 1200},
+	})
+	for _, want := range []string{`fibonacci +3.00x`, `arrays +1.20x`, `geomean +1.90x`} {
+		if !regexp.MustCompile(want).MatchString(b.String()) {
+			t.Errorf("missing %q in\n%s", want, b.String())
+		}
+	}
+}
+
+func BenchmarkVM(b *testing.B) {
+	benchmark(b, engines[0])
+}
+
+func BenchmarkEval(b *testing.B) {
+	benchmark(b, engines[1])
+}
+
+func benchmark(b *testing.B, e Engine) {
+	for _, p := range programs {
+		b.Run(p.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := e.Run(p.Source); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tneuqole/monkey-go/dap"
+)
+
+// runDap implements `monkey dap`, a debug adapter speaking DAP over stdio.
+func runDap(args []string) int {
+	server := dap.NewServer(os.Stdin, os.Stdout)
+	if err := server.Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
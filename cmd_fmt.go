@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tneuqole/monkey-go/format"
+)
+
+// runFmt implements `monkey fmt [-w] [-d] [files]`. Without files it formats
+// stdin to stdout.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write result to source file instead of stdout")
+	diff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return formatFile("<stdin>", src, false, *diff)
+	}
+
+	status := 0
+	for _, filename := range flags.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		if formatFile(filename, src, *write, *diff) != 0 {
+			status = 1
+		}
+	}
+
+	return status
+}
+
+func formatFile(filename string, src []byte, write, diff bool) int {
+	res, err := format.Source(string(src))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+		return 1
+	}
+
+	if diff {
+		if res != string(src) {
+			fmt.Print(unifiedDiff(filename, string(src), res))
+		}
+	}
+
+	if write {
+		if res == string(src) {
+			return 0
+		}
+		if err := os.WriteFile(filename, []byte(res), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else if !diff {
+		fmt.Print(res)
+	}
+
+	return 0
+}
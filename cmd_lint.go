@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tneuqole/monkey-go/lint"
+)
+
+// runLint implements `monkey lint [-checks list] [files]`. Without files it
+// checks stdin. It exits with status 1 if any diagnostic was reported.
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	only := flags.String("checks", "", "comma separated list of checks to run (default all)")
+	list := flags.Bool("list", false, "list available checks and exit")
+	flags.Parse(args)
+
+	if *list {
+		for _, c := range lint.Checks {
+			fmt.Printf("%-12s %s\n", c.Name, c.Doc)
+		}
+		return 0
+	}
+
+	checks := lint.Checks
+	if *only != "" {
+		checks = nil
+		for _, name := range strings.Split(*only, ",") {
+			c := lookupCheck(name)
+			if c == nil {
+				fmt.Fprintf(os.Stderr, "unknown check %q\n", name)
+				return 2
+			}
+			checks = append(checks, c)
+		}
+	}
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return lintFile("<stdin>", string(src), checks)
+	}
+
+	status := 0
+	for _, filename := range flags.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		if lintFile(filename, string(src), checks) != 0 {
+			status = 1
+		}
+	}
+
+	return status
+}
+
+func lintFile(filename, src string, checks []*lint.Check) int {
+	program, errs := parseSource(src)
+	if len(errs) != 0 {
+		for _, msg := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, msg)
+		}
+		return 1
+	}
+
+	diagnostics := lint.Run(program, checks)
+	for _, d := range diagnostics {
+		fmt.Printf("%s:%s\n", filename, d)
+	}
+
+	if len(diagnostics) != 0 {
+		return 1
+	}
+	return 0
+}
+
+func lookupCheck(name string) *lint.Check {
+	for _, c := range lint.Checks {
+		if c.Name == strings.TrimSpace(name) {
+			return c
+		}
+	}
+	return nil
+}
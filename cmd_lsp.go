@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tneuqole/monkey-go/lsp"
+)
+
+// runLsp implements `monkey lsp`, a language server speaking LSP over stdio.
+func runLsp(args []string) int {
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/tneuqole/monkey-go/coverage"
+	"github.com/tneuqole/monkey-go/mktest"
+)
+
+// runTest implements `monkey test [-run regexp] [-v] [-format text|json|tap]
+// [-cover] [-coverprofile file] [-coverhtml file] [paths]`. Without paths
+// it runs the test files below the current directory. It exits with status
+// 1 if any test failed.
+func runTest(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	pattern := flags.String("run", "", "run only tests matching `regexp`")
+	verbose := flags.Bool("v", false, "list every test, not just failures")
+	format := flags.String("format", "text", "output `format`: text, json or tap")
+	cover := flags.Bool("cover", false, "report the percentage of lines covered by the tests")
+	coverProfile := flags.String("coverprofile", "", "write an LCOV coverage profile to `file`")
+	coverHTML := flags.String("coverhtml", "", "write the source annotated with coverage as HTML to `file`")
+	flags.Parse(args)
+
+	var opts mktest.Options
+	if *pattern != "" {
+		var err error
+		opts.Run, err = regexp.Compile(*pattern)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -run: %v\n", err)
+			return 2
+		}
+	}
+	if *format != "text" && *format != "json" && *format != "tap" {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		return 2
+	}
+	if *cover || *coverProfile != "" || *coverHTML != "" {
+		opts.Coverage = coverage.NewProfile()
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	filenames, err := mktest.Discover(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(filenames) == 0 {
+		fmt.Fprintln(os.Stderr, "no test files")
+		return 0
+	}
+
+	status := 0
+	files := make([]mktest.File, len(filenames))
+	for i, filename := range filenames {
+		files[i] = mktest.RunFile(context.Background(), filename, opts)
+		if !files[i].Passed() {
+			status = 1
+		}
+	}
+
+	switch *format {
+	case "json":
+		if err := mktest.WriteJSON(os.Stdout, files); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	case "tap":
+		mktest.WriteTAP(os.Stdout, files)
+	default:
+		mktest.WriteText(os.Stdout, files, *verbose)
+	}
+
+	if *cover {
+		// keep the output of the other formats parseable
+		var w io.Writer = os.Stdout
+		if *format != "text" {
+			w = os.Stderr
+		}
+		coverage.WriteText(w, opts.Coverage)
+	}
+	if *coverProfile != "" {
+		if err := writeCoverage(*coverProfile, opts.Coverage, coverage.WriteLCOV); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if *coverHTML != "" {
+		if err := writeCoverage(*coverHTML, opts.Coverage, coverage.WriteHTML); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return status
+}
+
+func writeCoverage(filename string, profile *coverage.Profile, write func(io.Writer, *coverage.Profile) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := write(f, profile); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
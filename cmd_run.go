@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tneuqole/monkey-go/monkey"
+	"github.com/tneuqole/monkey-go/vm"
+)
+
+// runRun implements `monkey run [-trace] [-profile] [-pprof file] [-sample n]
+// file`. It runs the program in the VM and exits with status 1 if it fails.
+// -trace prints every instruction with the top of the stack to stderr.
+// -profile prints the calls, instructions and time of each function and
+// the executions of each opcode to stderr when the program ends, and -pprof
+// writes samples of its call stack for `go tool pprof`.
+func runRun(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	trace := flags.Bool("trace", false, "print every instruction executed to stderr")
+	profile := flags.Bool("profile", false, "print a profile of the program's functions and opcodes to stderr")
+	pprof := flags.String("pprof", "", "write a pprof profile of the program to `file`")
+	sample := flags.Int("sample", vm.DefaultSampleInterval, "take a pprof sample every `n` instructions")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: monkey run [-trace] [-profile] [-pprof file] [-sample n] file")
+		return 2
+	}
+	if *sample <= 0 {
+		fmt.Fprintf(os.Stderr, "invalid -sample %d\n", *sample)
+		return 2
+	}
+	filename := flags.Arg(0)
+
+	rt := monkey.New()
+	if *trace {
+		tracer := vm.NewTextTracer(os.Stderr)
+		tracer.Main = filename
+		rt.SetTracer(tracer)
+	}
+	var profiler *vm.Profiler
+	if *profile || *pprof != "" {
+		profiler = vm.NewProfiler()
+		profiler.SampleInterval = *sample
+		profiler.Main = filename
+		rt.SetProfiler(profiler)
+	}
+
+	status := 0
+	program, err := rt.CompileFile(filename)
+	if err == nil {
+		_, err = rt.Run(context.Background(), program)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, describeError(filename, err))
+		status = 1
+	}
+
+	if profiler == nil {
+		return status
+	}
+	result := profiler.Profile()
+	if *profile {
+		result.WriteText(os.Stderr)
+	}
+	if *pprof != "" {
+		f, err := os.Create(*pprof)
+		if err == nil {
+			err = result.WritePprof(f)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return status
+}
+
+// describeError prefixes the positions in err that are in the file at path
+// with it.
+func describeError(path string, err error) string {
+	var (
+		syntaxErr  *monkey.SyntaxError
+		compileErr *monkey.CompileError
+		runtimeErr *monkey.RuntimeError
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		msgs := make([]string, len(syntaxErr.Errors))
+		for i, e := range syntaxErr.Errors {
+			msgs[i] = path + ":" + e.Error()
+		}
+		return strings.Join(msgs, "\n")
+	case errors.As(err, &compileErr):
+		msgs := make([]string, len(compileErr.Diagnostics))
+		for i, d := range compileErr.Diagnostics {
+			msgs[i] = d.Error()
+			if d.File == "" {
+				msgs[i] = path + ":" + msgs[i]
+			}
+		}
+		return strings.Join(msgs, "\n")
+	case errors.As(err, &runtimeErr) && runtimeErr.File == "" && runtimeErr.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", path, runtimeErr.Line, runtimeErr.Err)
+	default:
+		return err.Error()
+	}
+}
@@ -37,6 +37,11 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpImport
+	OpModule
+	// OpTailCall is an OpCall whose value the calling function returns, so
+	// the callee can take the caller's frame.
+	OpTailCall
 )
 
 type Opcode byte
@@ -77,6 +82,9 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpImport:         {"OpImport", []int{2}},
+	OpModule:         {"OpModule", []int{2}},
+	OpTailCall:       {"OpTailCall", []int{1}},
 }
 
 type Instructions []byte
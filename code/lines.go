@@ -0,0 +1,42 @@
+package code
+
+import "sort"
+
+// LineEntry maps the instructions starting at Offset to a source line.
+type LineEntry struct {
+	Offset int
+	Line   int
+	// Stmt reports whether a statement starts at Offset
+	Stmt bool
+}
+
+// LineTable maps instruction offsets to source lines. Entries are sorted by
+// offset and added where the line changes or a statement starts.
+type LineTable []LineEntry
+
+// Line returns the source line of the instruction at offset, or 0 if the
+// offset precedes every entry.
+func (lt LineTable) Line(offset int) int {
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset > offset })
+	if i == 0 {
+		return 0
+	}
+	return lt[i-1].Line
+}
+
+// IsStmt reports whether a statement starts at offset.
+func (lt LineTable) IsStmt(offset int) bool {
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset >= offset })
+	return i < len(lt) && lt[i].Offset == offset && lt[i].Stmt
+}
+
+// StmtLines returns the lines on which statements start.
+func (lt LineTable) StmtLines() []int {
+	lines := []int{}
+	for _, e := range lt {
+		if e.Stmt {
+			lines = append(lines, e.Line)
+		}
+	}
+	return lines
+}
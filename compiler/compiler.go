@@ -2,16 +2,18 @@ package compiler
 
 import (
 	"fmt"
-	"sort"
+	"sync"
 
 	"github.com/tneuqole/monkey-go/ast"
 	"github.com/tneuqole/monkey-go/code"
 	"github.com/tneuqole/monkey-go/object"
+	"github.com/tneuqole/monkey-go/token"
 )
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	Lines        code.LineTable
 }
 
 type EmittedInstruction struct {
@@ -23,6 +25,9 @@ type CompilationScope struct {
 	instructions    code.Instructions
 	lastInstruction EmittedInstruction
 	prevInstruction EmittedInstruction
+	lines           code.LineTable
+	// whether the next instruction emitted starts a statement
+	stmtPending bool
 }
 
 type Compiler struct {
@@ -30,9 +35,43 @@ type Compiler struct {
 	symbolTable *SymbolTable
 	scopes      []CompilationScope
 	scopeIdx    int
+	diagnostics Diagnostics
+
+	// source line of the statement being compiled, recorded in line tables
+	line int
+
+	// path of the file being compiled, which imports are relative to
+	path string
+	// constant index of the init function of every imported module, and
+	// the chain of imports being compiled
+	modules map[string]int
+	loading []string
+
+	// symbol of every identifier compiled, for tools like the language server
+	symbols map[*ast.Identifier]Symbol
 }
 
 func New() *Compiler {
+	return NewWithBuiltins(standardBuiltins())
+}
+
+var (
+	standardOnce     sync.Once
+	standardRegistry *object.Registry
+)
+
+// standardBuiltins returns the registry of compilers made by New. They
+// share one, as compiling only reads it.
+func standardBuiltins() *object.Registry {
+	standardOnce.Do(func() {
+		standardRegistry = object.NewStandardRegistry()
+	})
+	return standardRegistry
+}
+
+// NewWithBuiltins returns a compiler for programs that can call the
+// builtins of r. The VM running them must use r too.
+func NewWithBuiltins(r *object.Registry) *Compiler {
 	scope := CompilationScope{
 		instructions:    code.Instructions{},
 		lastInstruction: EmittedInstruction{},
@@ -40,14 +79,16 @@ func New() *Compiler {
 	}
 
 	s := NewSymbolTable()
-	for i, fn := range object.Builtins {
-		s.DefineBuiltin(i, fn.Name)
+	for i, b := range r.All() {
+		s.DefineBuiltin(i, b.Name)
 	}
 	return &Compiler{
 		constants:   []object.Object{},
 		symbolTable: s,
 		scopes:      []CompilationScope{scope},
 		scopeIdx:    0,
+		symbols:     make(map[*ast.Identifier]Symbol),
+		modules:     make(map[string]int),
 	}
 }
 
@@ -58,44 +99,57 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	return c
 }
 
+// SetPath sets the path of the file being compiled. Imports are resolved
+// relative to it, or to the working directory if it is not set.
+func (c *Compiler) SetPath(path string) {
+	c.path = path
+}
+
+// Compile compiles node. Compilation continues past errors so that every
+// problem in the program is reported; if there were any, Compile returns
+// them as Diagnostics and the bytecode must not be run.
 func (c *Compiler) Compile(node ast.Node) error {
+	c.diagnostics = nil
+	c.compile(node)
+	if len(c.diagnostics) != 0 {
+		return c.diagnostics
+	}
+
+	return nil
+}
+
+func (c *Compiler) compile(node ast.Node) {
+	// programs that failed to parse have nil expressions, which were
+	// already reported by the parser
+	if ast.IsNil(node) {
+		return
+	}
+
+	if line := statementLine(node); line > 0 {
+		prev := c.line
+		c.line = line
+		c.scopes[c.scopeIdx].stmtPending = true
+		defer func() { c.line = prev }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
-			err := c.Compile(s)
-			if err != nil {
-				return err
-			}
+			c.compile(s)
 		}
 	case *ast.ExpressionStatement:
-		err := c.Compile(node.Expression)
-		if err != nil {
-			return err
-		}
+		c.compile(node.Expression)
 		c.emit(code.OpPop)
 	case *ast.InfixExpression:
 		if node.Operator == "<" {
-			err := c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-			err = c.Compile(node.Left)
-			if err != nil {
-				return err
-			}
+			c.compile(node.Right)
+			c.compile(node.Left)
 			c.emit(code.OpGreaterThan)
-			return nil
-		}
-
-		err := c.Compile(node.Left)
-		if err != nil {
-			return err
+			return
 		}
 
-		err = c.Compile(node.Right)
-		if err != nil {
-			return err
-		}
+		c.compile(node.Left)
+		c.compile(node.Right)
 
 		switch node.Operator {
 		case "+":
@@ -113,13 +167,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case "!=":
 			c.emit(code.OpNotEqual)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			c.errorf(node.Token, "unknown operator %s", node.Operator)
 		}
 	case *ast.PrefixExpression:
-		err := c.Compile(node.Right)
-		if err != nil {
-			return err
-		}
+		c.compile(node.Right)
 
 		switch node.Operator {
 		case "-":
@@ -127,7 +178,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case "!":
 			c.emit(code.OpBang)
 		default:
-			return fmt.Errorf("unknown prefix operator %s ", node.Operator)
+			c.errorf(node.Token, "unknown prefix operator %s", node.Operator)
 		}
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
@@ -142,23 +193,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpFalse)
 		}
 	case *ast.IfExpression:
-		err := c.Compile(node.Condition)
-		if err != nil {
-			return err
-		}
+		c.compile(node.Condition)
 
 		// emit with bad offset
 		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
 
-		err = c.Compile(node.Consequence)
-		if err != nil {
-			return err
-		}
-
-		// only pop conditional value, not consequence value
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastInstruction()
-		}
+		c.compileBranch(node.Consequence)
 
 		jumpPos := c.emit(code.OpJump, 9999)
 		afterConsequencePos := len(c.currentInstructions())
@@ -166,33 +206,24 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if node.Alternative == nil {
 			c.emit(code.OpNull)
 		} else {
-			err = c.Compile(node.Alternative)
-			if err != nil {
-				return err
-			}
-
-			// only pop conditional value, not alternative value
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastInstruction()
-			}
-
+			c.compileBranch(node.Alternative)
 		}
 
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
-			err := c.Compile(s)
-			if err != nil {
-				return err
-			}
+			c.compile(s)
 		}
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
-		err := c.Compile(node.Value)
-		if err != nil {
-			return err
+		// redefining a name in the same scope assigns to it, so its old
+		// value is still visible while compiling the new one
+		symbol, ok := c.symbolTable.Lookup(node.Name.Value)
+		if !ok {
+			symbol = c.symbolTable.Define(node.Name.Value)
 		}
+		c.recordSymbol(node.Name, symbol)
+		c.compile(node.Value)
 		if symbol.Scope == GlobalScope {
 			c.emit(code.OpSetGlobal, symbol.Index)
 		} else {
@@ -201,47 +232,25 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			c.errorf(node.Token, "undefined variable %s", node.Value)
+			return
 		}
+		c.recordSymbol(node, symbol)
 		c.loadSymbol(symbol)
 	case *ast.ArrayLiteral:
 		for _, el := range node.Elements {
-			err := c.Compile(el)
-			if err != nil {
-				return err
-			}
+			c.compile(el)
 		}
 		c.emit(code.OpArray, len(node.Elements))
 	case *ast.HashLiteral:
-		keys := make([]ast.Expression, 0, len(node.Pairs))
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-		for _, k := range keys {
-			err := c.Compile(k)
-			if err != nil {
-				return err
-			}
-
-			err = c.Compile(node.Pairs[k])
-			if err != nil {
-				return err
-			}
+		for _, k := range node.OrderedKeys() {
+			c.compile(k)
+			c.compile(node.Pairs[k])
 		}
 		c.emit(code.OpHash, len(node.Pairs)*2)
 	case *ast.IndexExpression:
-		err := c.Compile(node.Left)
-		if err != nil {
-			return err
-		}
-
-		err = c.Compile(node.Index)
-		if err != nil {
-			return err
-		}
+		c.compile(node.Left)
+		c.compile(node.Index)
 		c.emit(code.OpIndex)
 	case *ast.FunctionLiteral:
 		c.enterScope()
@@ -251,13 +260,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Value)
+			c.recordSymbol(p, c.symbolTable.Define(p.Value))
 		}
 
-		err := c.Compile(node.Body)
-		if err != nil {
-			return err
-		}
+		c.compile(node.Body)
 
 		if c.lastInstructionIs(code.OpPop) {
 			c.replaceLastInstruction(code.OpReturnValue)
@@ -266,11 +272,19 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if !c.lastInstructionIs(code.OpReturnValue) {
 			c.emit(code.OpReturn)
 		}
+		c.markTailCalls()
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		localNames := c.symbolTable.Names()
+		lines := c.scopes[c.scopeIdx].lines
 		ins := c.leaveScope()
 
+		freeNames := make([]string, len(freeSymbols))
+		for i, s := range freeSymbols {
+			freeNames[i] = s.Name
+		}
+
 		for _, s := range freeSymbols {
 			c.loadSymbol(s)
 		}
@@ -279,35 +293,92 @@ func (c *Compiler) Compile(node ast.Node) error {
 			Instructions:  ins,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			File:          c.file(),
+			Lines:         lines,
+			LocalNames:    localNames,
+			FreeNames:     freeNames,
 		}
 		c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
 	case *ast.ReturnStatement:
-		err := c.Compile(node.ReturnValue)
-		if err != nil {
-			return err
+		if len(c.loading) != 0 && c.symbolTable.Outer == nil {
+			c.errorf(node.Token, "return outside function")
 		}
+		c.compile(node.ReturnValue)
 		c.emit(code.OpReturnValue)
+	case *ast.MacroLiteral:
+		c.errorf(node.Token, "macro literals must be defined and expanded before compiling")
 	case *ast.CallExpression:
-		err := c.Compile(node.Function)
-		if err != nil {
-			return err
+		if ast.IsNil(node.Function) {
+			return
 		}
-		for _, arg := range node.Arguments {
-
-			err = c.Compile(arg)
-			if err != nil {
-				return err
+		if name := node.Function.TokenLiteral(); name == "quote" || name == "unquote" {
+			if _, ok := c.symbolTable.Resolve(name); !ok {
+				c.errorf(ast.Start(node), "%s can only be used inside a macro", name)
+				return
 			}
 		}
+
+		c.compile(node.Function)
+		for _, arg := range node.Arguments {
+			c.compile(arg)
+		}
 		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.ImportExpression:
+		c.compileImport(node)
 	}
-	return nil
+}
+
+func (c *Compiler) errorf(tok token.Token, format string, a ...interface{}) {
+	c.diagnostics = append(c.diagnostics, &Diagnostic{
+		File:    c.file(),
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// file returns the path of the imported module being compiled, or an empty
+// string for the main program.
+func (c *Compiler) file() string {
+	if len(c.loading) == 0 {
+		return ""
+	}
+	return c.path
+}
+
+// statementLine returns the source line of statement nodes, or 0 for any
+// other node.
+func statementLine(node ast.Node) int {
+	switch node.(type) {
+	case *ast.LetStatement, *ast.ReturnStatement, *ast.ExpressionStatement:
+		return ast.Start(node).Line
+	}
+	return 0
+}
+
+// SymbolTable returns the compiler's current symbol table.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+// recordSymbol remembers the symbol of an identifier of the main program.
+func (c *Compiler) recordSymbol(ident *ast.Identifier, symbol Symbol) {
+	if len(c.loading) == 0 {
+		c.symbols[ident] = symbol
+	}
+}
+
+// Symbols returns the symbol each identifier compiled so far resolved to.
+func (c *Compiler) Symbols() map[*ast.Identifier]Symbol {
+	return c.symbols
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		Lines:        c.scopes[c.scopeIdx].lines,
 	}
 }
 
@@ -320,9 +391,22 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
 	c.setLastInstruction(op, pos)
+	c.addLine(pos)
 	return pos
 }
 
+// addLine records that the instruction at pos belongs to the current line.
+func (c *Compiler) addLine(pos int) {
+	scope := &c.scopes[c.scopeIdx]
+	stmt := scope.stmtPending
+	scope.stmtPending = false
+
+	if c.line == 0 || !stmt && len(scope.lines) != 0 && scope.lines[len(scope.lines)-1].Line == c.line {
+		return
+	}
+	scope.lines = append(scope.lines, code.LineEntry{Offset: pos, Line: c.line, Stmt: stmt})
+}
+
 func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
 	prev := c.scopes[c.scopeIdx].lastInstruction
 	last := EmittedInstruction{Opcode: op, Position: pos}
@@ -339,6 +423,12 @@ func (c *Compiler) removeLastInstruction() {
 
 	c.scopes[c.scopeIdx].instructions = newIns
 	c.scopes[c.scopeIdx].lastInstruction = prev
+
+	lines := c.scopes[c.scopeIdx].lines
+	for len(lines) != 0 && lines[len(lines)-1].Offset >= last.Position {
+		lines = lines[:len(lines)-1]
+	}
+	c.scopes[c.scopeIdx].lines = lines
 }
 
 func (c *Compiler) addInstruction(ins []byte) int {
@@ -347,6 +437,59 @@ func (c *Compiler) addInstruction(ins []byte) int {
 	return posNewInstruction
 }
 
+// compileBranch compiles a branch of an if expression so that it leaves its
+// value on the stack, which is null if the block does not end with an
+// expression.
+func (c *Compiler) compileBranch(block *ast.BlockStatement) {
+	start := len(c.currentInstructions())
+	c.compile(block)
+
+	switch {
+	case len(c.currentInstructions()) > start && c.lastInstructionIs(code.OpPop):
+		// only pop conditional value, not branch value
+		c.removeLastInstruction()
+	case len(c.currentInstructions()) > start && c.lastInstructionIs(code.OpReturnValue):
+	default:
+		c.emit(code.OpNull)
+	}
+}
+
+// markTailCalls turns the calls of the current function whose value it
+// returns into tail calls: those followed by OpReturnValue, right away or
+// after jumps, as a call at the end of a branch of an if is.
+func (c *Compiler) markTailCalls() {
+	ins := c.currentInstructions()
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return
+		}
+		_, read := code.ReadOperands(def, ins[i+1:])
+		next := i + 1 + read
+		if code.Opcode(ins[i]) == code.OpCall && returnsAt(ins, next) {
+			ins[i] = byte(code.OpTailCall)
+		}
+		i = next
+	}
+}
+
+// returnsAt reports whether the instructions at pos return the value on
+// top of the stack without touching it.
+func returnsAt(ins code.Instructions, pos int) bool {
+	for pos < len(ins) {
+		switch code.Opcode(ins[pos]) {
+		case code.OpReturnValue:
+			return true
+		case code.OpJump:
+			// jumps of ifs only go forward
+			pos = int(code.ReadUint16(ins[pos+1:]))
+		default:
+			return false
+		}
+	}
+	return false
+}
+
 func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
 	return len(c.currentInstructions()) != 0 && c.scopes[c.scopeIdx].lastInstruction.Opcode == op
 }
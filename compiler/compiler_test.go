@@ -2,6 +2,9 @@ package compiler
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/tneuqole/monkey-go/ast"
@@ -31,7 +34,7 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 				1,
@@ -60,7 +63,7 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 				1,
@@ -69,7 +72,7 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpSetLocal, 0),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 2),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -85,6 +88,67 @@ func TestRecursiveFunctions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(f) { if (f) { f() } else { f() + 1 } }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpJumpNotTruthy, 12),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpJump, 20),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(f) { return f(); 1 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(f) { let x = f(); x }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestClosures(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -233,7 +297,7 @@ func TestBuiltins(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpGetBuiltin, 0),
 					code.Make(code.OpArray, 0),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -929,6 +993,228 @@ func TestLetStatementScopes(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"x", []string{"1:1: undefined variable x"}},
+		{
+			"let a = b + c;\nlet f = fn(x) { x + y };\nf(z);",
+			[]string{
+				"1:9: undefined variable b",
+				"1:13: undefined variable c",
+				"2:21: undefined variable y",
+				"3:3: undefined variable z",
+			},
+		},
+		{
+			"let m = macro(a) { quote(unquote(a)) };\nquote(1);",
+			[]string{
+				"1:9: macro literals must be defined and expanded before compiling",
+				"2:1: quote can only be used inside a macro",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compile errors for %q", tt.input)
+		}
+
+		diagnostics, ok := err.(Diagnostics)
+		if !ok {
+			t.Fatalf("err not Diagnostics. got=%T (%+v)", err, err)
+		}
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Fatalf("wrong number of diagnostics. want=%d, got=%d (%s)", len(tt.expected), len(diagnostics), err)
+		}
+
+		for i, d := range diagnostics {
+			if d.Error() != tt.expected[i] {
+				t.Errorf("wrong diagnostic. want=%q, got=%q", tt.expected[i], d.Error())
+			}
+		}
+	}
+}
+
+func FuzzCompile(f *testing.F) {
+	for _, seed := range []string{
+		"let x = 5; let f = fn(a) { a + x }; f(1)",
+		`if (true) { {"a": [1, 2]}["a"][0] } else { puts(len("")) }`,
+		"let m = macro(a) { quote(unquote(a)) }; m(1)",
+		"let = ; fn(1) { [1, } {: }",
+		"let x = fn() { let y = ; y }; x(",
+		"-if (1) { }",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		// programs that failed to parse still compile, as the language
+		// server does, even though their trees have holes
+		program := parser.New(lexer.New(input)).ParseProgram()
+		New().Compile(program)
+	})
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := t.TempDir()
+	modules := map[string]string{
+		"a.mk":   `import "b";`,
+		"b.mk":   `import "a";`,
+		"bad.mk": "let x = 1;\nlet y = z;\nreturn x;",
+		"ok.mk":  `export let x = 1;`,
+	}
+	for name, src := range modules {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`import "DIR/a"`, []string{
+			"DIR/b.mk:1:1: import cycle: DIR/a.mk -> DIR/b.mk -> DIR/a.mk",
+			"DIR/a.mk:1:1: imported module DIR/b.mk has errors",
+			"1:1: imported module DIR/a.mk has errors",
+		}},
+		{`import "DIR/bad"`, []string{
+			"DIR/bad.mk:2:9: undefined variable z",
+			"DIR/bad.mk:3:1: return outside function",
+			"1:1: imported module DIR/bad.mk has errors",
+		}},
+		{`import "DIR/missing"`, []string{
+			`1:1: cannot import "DIR/missing": open DIR/missing.mk: no such file or directory`,
+		}},
+		{"let m = import \"DIR/ok\";\ny", []string{"2:1: undefined variable y"}},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(strings.ReplaceAll(tt.input, "DIR", dir)))
+		if err == nil {
+			t.Fatalf("expected compile errors for %q", tt.input)
+		}
+
+		expected := strings.ReplaceAll(strings.Join(tt.expected, "\n"), "DIR", dir)
+		if err.Error() != expected {
+			t.Errorf("wrong errors.\nwant=%s\ngot =%s", expected, err)
+		}
+	}
+}
+
+func TestModuleGlobals(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "m.mk"), []byte("let a = 1;\nexport let b = a;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	compiler := New()
+	compiler.SetPath(filepath.Join(dir, "main.mk"))
+	if err := compiler.Compile(parse(`let a = import "m"; let c = 2;`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	// module globals get their own indexes after the main program's a
+	names := compiler.SymbolTable().Names()
+	if fmt.Sprint(names) != "[a   c]" {
+		t.Errorf("wrong global names. got=%q", names)
+	}
+
+	// the init function follows the module's constants
+	fn := compiler.Bytecode().Constants[3].(*object.CompiledFunction)
+	expected := []code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetGlobal, 1),
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpSetGlobal, 2),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpGetGlobal, 2),
+		code.Make(code.OpModule, 1),
+		code.Make(code.OpReturnValue),
+	}
+	if err := testInstructions(expected, fn.Instructions); err != nil {
+		t.Errorf("wrong module instructions: %s", err)
+	}
+	if fn.File != filepath.Join(dir, "m.mk") {
+		t.Errorf("wrong module file. got=%q", fn.File)
+	}
+}
+
+func TestUnknownOperator(t *testing.T) {
+	program := parse("1 + 2")
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	stmt.Expression.(*ast.InfixExpression).Operator = "%"
+
+	err := New().Compile(program)
+	if err == nil || err.Error() != "1:3: unknown operator %" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+}
+
+func TestLineTables(t *testing.T) {
+	input := `let x = 1;
+if (x > 0) {
+  x
+} else { 2 };
+let f = fn(a) {
+  let b = a;
+  b
+};`
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	expected := code.LineTable{
+		{Offset: 0, Line: 1, Stmt: true},
+		{Offset: 6, Line: 2, Stmt: true},
+		{Offset: 16, Line: 3, Stmt: true},
+		{Offset: 19, Line: 2},
+		{Offset: 22, Line: 4, Stmt: true},
+		{Offset: 25, Line: 2},
+		{Offset: 26, Line: 5, Stmt: true},
+	}
+	testLineTable(t, expected, bytecode.Lines)
+
+	fn := bytecode.Constants[len(bytecode.Constants)-1].(*object.CompiledFunction)
+	testLineTable(t, code.LineTable{
+		{Offset: 0, Line: 6, Stmt: true},
+		{Offset: 4, Line: 7, Stmt: true},
+	}, fn.Lines)
+
+	if fn.Name != "f" || fmt.Sprint(fn.LocalNames) != "[a b]" {
+		t.Errorf("wrong debug names. name=%q, locals=%v", fn.Name, fn.LocalNames)
+	}
+
+	if line := bytecode.Lines.Line(20); line != 2 {
+		t.Errorf("wrong line for offset 20. want=2, got=%d", line)
+	}
+}
+
+func testLineTable(t *testing.T, expected, actual code.LineTable) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("wrong line table.\nwant=%+v\ngot =%+v", expected, actual)
+	}
+	for i, e := range expected {
+		if actual[i] != e {
+			t.Errorf("wrong line entry %d. want=%+v, got=%+v", i, e, actual[i])
+		}
+	}
+}
+
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
 
@@ -0,0 +1,33 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diagnostic is a compile error at a position in the source. File is set
+// for errors in imported modules and empty for the main program.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d *Diagnostic) Error() string {
+	if d.File != "" {
+		return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// Diagnostics is every error found while compiling a program.
+type Diagnostics []*Diagnostic
+
+func (ds Diagnostics) Error() string {
+	msgs := make([]string, len(ds))
+	for i, d := range ds {
+		msgs[i] = d.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
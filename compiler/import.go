@@ -0,0 +1,100 @@
+package compiler
+
+import (
+	"errors"
+
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/code"
+	"github.com/tneuqole/monkey-go/evaluator"
+	"github.com/tneuqole/monkey-go/module"
+	"github.com/tneuqole/monkey-go/object"
+)
+
+// compileImport compiles each imported module once, into an init function
+// that runs the module's statements with its own global symbol table and
+// returns its exports. OpImport calls the init function the first time it
+// runs and pushes the cached module after that.
+func (c *Compiler) compileImport(node *ast.ImportExpression) {
+	path := module.Resolve(c.path, node.Path.Value)
+
+	if index, ok := c.modules[path]; ok {
+		c.emit(code.OpImport, index)
+		return
+	}
+
+	if err := module.CheckCycle(c.loading, path); err != nil {
+		c.errorf(node.Token, "%s", err)
+		return
+	}
+
+	program, err := module.Parse(path)
+	if err != nil {
+		var perr *module.ParseError
+		if !errors.As(err, &perr) {
+			c.errorf(node.Token, "cannot import %q: %s", node.Path.Value, err)
+			return
+		}
+		for _, e := range perr.Errors {
+			c.diagnostics = append(c.diagnostics, &Diagnostic{File: path, Line: e.Line, Column: e.Column, Message: e.Message})
+		}
+		c.errorf(node.Token, "imported module %s has errors", path)
+		return
+	}
+
+	// macros are local to the module that defines them
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	if _, err := evaluator.ExpandMacros(program, macroEnv); err != nil {
+		merr := err.(*evaluator.MacroError)
+		c.diagnostics = append(c.diagnostics, &Diagnostic{File: path, Line: merr.Line, Column: merr.Column, Message: merr.Message})
+		c.errorf(node.Token, "imported module %s has errors", path)
+		return
+	}
+
+	numErrors := len(c.diagnostics)
+	fn := c.compileModule(path, program)
+	if len(c.diagnostics) != numErrors {
+		c.errorf(node.Token, "imported module %s has errors", path)
+	}
+
+	index := c.addConstant(fn)
+	c.modules[path] = index
+	c.emit(code.OpImport, index)
+}
+
+func (c *Compiler) compileModule(path string, program *ast.Program) *object.CompiledFunction {
+	prevPath, prevTable, prevLine := c.path, c.symbolTable, c.line
+	c.path, c.line = path, 0
+	c.loading = append(c.loading, path)
+
+	c.symbolTable = NewModuleSymbolTable(prevTable)
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIdx++
+
+	c.compile(program)
+
+	// the module evaluates to its path and exported bindings
+	exports := module.Exports(program)
+	c.emit(code.OpConstant, c.addConstant(&object.String{Value: path}))
+	for _, name := range exports {
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: name}))
+		symbol, _ := c.symbolTable.Resolve(name)
+		c.loadSymbol(symbol)
+	}
+	c.emit(code.OpModule, len(exports))
+	c.emit(code.OpReturnValue)
+
+	fn := &object.CompiledFunction{
+		Instructions: c.currentInstructions(),
+		Name:         path,
+		File:         path,
+		Lines:        c.scopes[c.scopeIdx].lines,
+	}
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIdx--
+	c.loading = c.loading[:len(c.loading)-1]
+	c.path, c.symbolTable, c.line = prevPath, prevTable, prevLine
+
+	return fn
+}
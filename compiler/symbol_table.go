@@ -21,15 +21,37 @@ type SymbolTable struct {
 	numDefinitions int
 	FreeSymbols    []Symbol
 	Outer          *SymbolTable
+
+	// global indexes are shared by the tables of all modules of a program
+	numGlobals *int
+	// builtins defined in this table, which modules can also use
+	builtins []Symbol
 }
 
 func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{
 		store:       make(map[string]Symbol),
 		FreeSymbols: []Symbol{},
+		numGlobals:  new(int),
 	}
 }
 
+// NewModuleSymbolTable returns the global symbol table of an imported
+// module. It has its own names and the builtins of s, but allocates global
+// indexes after those of s and every other module of the program.
+func NewModuleSymbolTable(s *SymbolTable) *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	m := NewSymbolTable()
+	m.numGlobals = s.numGlobals
+	for _, b := range s.builtins {
+		m.DefineBuiltin(b.Index, b.Name)
+	}
+	return m
+}
+
 func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	s := NewSymbolTable()
 	s.Outer = outer
@@ -42,14 +64,29 @@ func (s *SymbolTable) Define(name string) Symbol {
 		scope = LocalScope
 	}
 	symbol := Symbol{Name: name, Scope: scope, Index: s.numDefinitions}
+	if scope == GlobalScope {
+		symbol.Index = *s.numGlobals
+		*s.numGlobals++
+	}
 	s.store[name] = symbol
 	s.numDefinitions++
 	return symbol
 }
 
+// Lookup returns the global or local variable name defined in this table
+// itself, ignoring builtins and enclosing tables.
+func (s *SymbolTable) Lookup(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if !ok || (symbol.Scope != GlobalScope && symbol.Scope != LocalScope) {
+		return Symbol{}, false
+	}
+	return symbol, true
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
 	s.store[name] = symbol
+	s.builtins = append(s.builtins, symbol)
 	return symbol
 }
 
@@ -77,3 +114,20 @@ func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	s.store[original.Name] = symbol
 	return symbol
 }
+
+// Names returns the names of the variables defined in this table, indexed
+// by symbol index. Names of shadowed definitions are empty.
+func (s *SymbolTable) Names() []string {
+	size := s.numDefinitions
+	if s.Outer == nil {
+		size = *s.numGlobals
+	}
+
+	names := make([]string, size)
+	for _, symbol := range s.store {
+		if symbol.Scope == GlobalScope || symbol.Scope == LocalScope {
+			names[symbol.Index] = symbol.Name
+		}
+	}
+	return names
+}
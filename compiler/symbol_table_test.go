@@ -228,6 +228,34 @@ func TestResolveGlobal(t *testing.T) {
 	}
 }
 
+func TestLookup(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+	local := NewEnclosedSymbolTable(global)
+	local.Define("b")
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+		ok       bool
+	}{
+		{global, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}, true},
+		{global, "len", Symbol{}, false},
+		{local, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0}, true},
+		{local, "a", Symbol{}, false},
+	}
+
+	for _, tt := range tests {
+		result, ok := tt.table.Lookup(tt.name)
+		if ok != tt.ok || result != tt.expected {
+			t.Errorf("wrong lookup of %s. want=%+v, %t, got=%+v, %t",
+				tt.name, tt.expected, tt.ok, result, ok)
+		}
+	}
+}
+
 func TestResolveLocal(t *testing.T) {
 	global := NewSymbolTable()
 	global.Define("a")
@@ -0,0 +1,108 @@
+// Package coverage records which lines of Monkey source files ran and
+// reports them as a text summary, LCOV or annotated HTML.
+//
+// A line is executable if a statement starts on it. The VM and the
+// evaluator each have a hook that fills a Profile as a program runs, see
+// vm.Coverage and evaluator.CoverageHook.
+package coverage
+
+import "sort"
+
+// Line is an executable line and how many times statements starting on it
+// ran.
+type Line struct {
+	Number int
+	Count  int
+}
+
+// Profile holds the executable lines of files and their counts, keyed by
+// path. The zero value is not usable; call NewProfile.
+type Profile struct {
+	files map[string]map[int]int
+}
+
+func NewProfile() *Profile {
+	return &Profile{files: make(map[string]map[int]int)}
+}
+
+// AddLines marks lines of file as executable, so that they are reported
+// even if they never run.
+func (p *Profile) AddLines(file string, lines ...int) {
+	if len(lines) == 0 {
+		return
+	}
+	counts := p.file(file)
+	for _, line := range lines {
+		if _, ok := counts[line]; !ok {
+			counts[line] = 0
+		}
+	}
+}
+
+// Hit records that a statement starting on line of file ran.
+func (p *Profile) Hit(file string, line int) {
+	p.file(file)[line]++
+}
+
+func (p *Profile) file(path string) map[int]int {
+	counts, ok := p.files[path]
+	if !ok {
+		counts = make(map[int]int)
+		p.files[path] = counts
+	}
+	return counts
+}
+
+// Merge adds the lines and counts of other to p.
+func (p *Profile) Merge(other *Profile) {
+	for path, lines := range other.files {
+		counts := p.file(path)
+		for line, n := range lines {
+			counts[line] += n
+		}
+	}
+}
+
+// Delete removes file from the profile.
+func (p *Profile) Delete(file string) {
+	delete(p.files, file)
+}
+
+// Files returns the paths of the profiled files in order.
+func (p *Profile) Files() []string {
+	paths := make([]string, 0, len(p.files))
+	for path := range p.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Lines returns the executable lines of file in order.
+func (p *Profile) Lines(file string) []Line {
+	lines := make([]Line, 0, len(p.files[file]))
+	for number, count := range p.files[file] {
+		lines = append(lines, Line{Number: number, Count: count})
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Number < lines[j].Number })
+	return lines
+}
+
+// Covered returns how many executable lines of file ran, and how many there
+// are.
+func (p *Profile) Covered(file string) (covered, total int) {
+	for _, count := range p.files[file] {
+		if count > 0 {
+			covered++
+		}
+	}
+	return covered, len(p.files[file])
+}
+
+// Percent returns covered as a percentage of total, 100 for no lines.
+func Percent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
@@ -0,0 +1,110 @@
+package coverage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testProfile() *Profile {
+	p := NewProfile()
+	p.AddLines("b.mk", 1, 2, 4)
+	p.Hit("b.mk", 1)
+	p.Hit("b.mk", 4)
+	p.Hit("b.mk", 4)
+	p.AddLines("a.mk", 3)
+	p.AddLines("empty.mk")
+	return p
+}
+
+func TestProfile(t *testing.T) {
+	p := testProfile()
+	if files := fmt.Sprint(p.Files()); files != "[a.mk b.mk]" {
+		t.Errorf("wrong files. got=%s", files)
+	}
+	if lines := fmt.Sprint(p.Lines("b.mk")); lines != "[{1 1} {2 0} {4 2}]" {
+		t.Errorf("wrong lines. got=%s", lines)
+	}
+	if covered, total := p.Covered("b.mk"); covered != 2 || total != 3 {
+		t.Errorf("wrong coverage. got=%d/%d", covered, total)
+	}
+
+	other := NewProfile()
+	other.AddLines("b.mk", 2, 5)
+	other.Hit("b.mk", 4)
+	p.Merge(other)
+	if lines := fmt.Sprint(p.Lines("b.mk")); lines != "[{1 1} {2 0} {4 3} {5 0}]" {
+		t.Errorf("wrong merged lines. got=%s", lines)
+	}
+
+	p.Delete("a.mk")
+	if files := fmt.Sprint(p.Files()); files != "[b.mk]" {
+		t.Errorf("wrong files after delete. got=%s", files)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	WriteText(&buf, testProfile())
+	want := "a.mk\t  0.0% (0/1 lines)\nb.mk\t 66.7% (2/3 lines)\ntotal:\t 50.0% (2/4 lines)\n"
+	if buf.String() != want {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", want, buf.String())
+	}
+}
+
+func TestWriteLCOV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteLCOV(&buf, testProfile()); err != nil {
+		t.Fatal(err)
+	}
+	want := `TN:
+SF:a.mk
+DA:3,0
+LF:1
+LH:0
+end_of_record
+SF:b.mk
+DA:1,1
+DA:2,0
+DA:4,2
+LF:3
+LH:2
+end_of_record
+`
+	if buf.String() != want {
+		t.Errorf("wrong output.\nwant=%s\ngot= %s", want, buf.String())
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lib.mk")
+	os.WriteFile(path, []byte("let a = 1;\nif (a < 0) {\n  puts(a);\n}\n"), 0o644)
+
+	p := NewProfile()
+	p.AddLines(path, 1, 2, 3)
+	p.Hit(path, 1)
+	p.Hit(path, 2)
+	p.AddLines("missing.mk", 1)
+
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, p); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, want := range []string{
+		`<h2 id="` + path + `">` + path + ` (66.7%)</h2>`,
+		`<tr class="covered"><td class="n">1</td><td class="n">1</td><td class="src">let a = 1;</td></tr>`,
+		`<tr class="covered"><td class="n">2</td><td class="n">1</td><td class="src">if (a &lt; 0) {</td></tr>`,
+		`<tr class="uncovered"><td class="n">3</td><td class="n">0</td><td class="src">  puts(a);</td></tr>`,
+		`<tr class=""><td class="n">4</td><td class="n"></td><td class="src">}</td></tr>`,
+		`<h2 id="missing.mk">missing.mk (0.0%)</h2>`,
+		`<p>open missing.mk: no such file or directory</p>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("output does not contain %s\n%s", want, html)
+		}
+	}
+}
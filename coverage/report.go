@@ -0,0 +1,116 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+)
+
+// WriteText writes the percentage of lines covered in each file of p and
+// in total.
+func WriteText(w io.Writer, p *Profile) {
+	var covered, total int
+	for _, path := range p.Files() {
+		c, t := p.Covered(path)
+		covered += c
+		total += t
+		fmt.Fprintf(w, "%s\t%5.1f%% (%d/%d lines)\n", path, Percent(c, t), c, t)
+	}
+	fmt.Fprintf(w, "total:\t%5.1f%% (%d/%d lines)\n", Percent(covered, total), covered, total)
+}
+
+// WriteLCOV writes p in the LCOV tracefile format read by genhtml and most
+// editors and CI services.
+func WriteLCOV(w io.Writer, p *Profile) error {
+	var b strings.Builder
+	b.WriteString("TN:\n")
+	for _, path := range p.Files() {
+		fmt.Fprintf(&b, "SF:%s\n", path)
+		for _, line := range p.Lines(path) {
+			fmt.Fprintf(&b, "DA:%d,%d\n", line.Number, line.Count)
+		}
+		covered, total := p.Covered(path)
+		fmt.Fprintf(&b, "LF:%d\nLH:%d\nend_of_record\n", total, covered)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type htmlFile struct {
+	Path    string
+	Percent float64
+	// Err is set if the source could not be read
+	Err   error
+	Lines []htmlLine
+}
+
+type htmlLine struct {
+	Number int
+	Source string
+	// Class is "covered", "uncovered" or empty for lines that are not
+	// executable
+	Class string
+	Count int
+}
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Monkey coverage</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; font-family: monospace; }
+td { padding: 0 8px; white-space: pre; }
+td.n { color: #888; text-align: right; }
+tr.covered td.src { background: #dfd; }
+tr.uncovered td.src { background: #fdd; }
+</style>
+</head>
+<body>
+{{range .}}<h2 id="{{.Path}}">{{.Path}} ({{printf "%.1f" .Percent}}%)</h2>
+{{if .Err}}<p>{{.Err}}</p>
+{{else}}<table>
+{{range .Lines}}<tr class="{{.Class}}"><td class="n">{{.Number}}</td><td class="n">{{if .Class}}{{.Count}}{{end}}</td><td class="src">{{.Source}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes the source of each file of p with executed lines in
+// green, executable lines that never ran in red and how many times each
+// ran. The sources are read from the paths in p.
+func WriteHTML(w io.Writer, p *Profile) error {
+	var files []htmlFile
+	for _, path := range p.Files() {
+		covered, total := p.Covered(path)
+		file := htmlFile{Path: path, Percent: Percent(covered, total)}
+
+		src, err := os.ReadFile(path)
+		if err != nil {
+			file.Err = err
+			files = append(files, file)
+			continue
+		}
+
+		counts := make(map[int]int)
+		for _, line := range p.Lines(path) {
+			counts[line.Number] = line.Count
+		}
+		for i, text := range strings.Split(strings.TrimSuffix(string(src), "\n"), "\n") {
+			line := htmlLine{Number: i + 1, Source: text}
+			if count, ok := counts[line.Number]; ok {
+				line.Count = count
+				line.Class = "uncovered"
+				if count > 0 {
+					line.Class = "covered"
+				}
+			}
+			file.Lines = append(file.Lines, line)
+		}
+		files = append(files, file)
+	}
+	return htmlTemplate.Execute(w, files)
+}
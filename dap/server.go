@@ -0,0 +1,451 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/tneuqole/monkey-go/compiler"
+	"github.com/tneuqole/monkey-go/evaluator"
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/object"
+	"github.com/tneuqole/monkey-go/parser"
+	"github.com/tneuqole/monkey-go/vm"
+)
+
+// the VM runs a single thread
+const threadID = 1
+
+// Variable references encode the frame and kind of a scope in their low
+// bits; references to arrays and hashes start at handleBase.
+const (
+	localsScope = iota + 1
+	freeScope
+	globalsScope
+
+	handleBase = 1 << 20
+)
+
+type handler func(s *Server, args json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":        (*Server).initialize,
+	"launch":            (*Server).launch,
+	"setBreakpoints":    (*Server).setBreakpoints,
+	"configurationDone": (*Server).configurationDone,
+	"threads":           (*Server).threads,
+	"stackTrace":        (*Server).stackTrace,
+	"scopes":            (*Server).scopes,
+	"variables":         (*Server).variables,
+	"continue":          resumeWith((*vm.Debugger).Continue),
+	"next":              resumeWith((*vm.Debugger).StepOver),
+	"stepIn":            resumeWith((*vm.Debugger).StepIn),
+	"stepOut":           resumeWith((*vm.Debugger).StepOut),
+	"pause":             (*Server).pause,
+	"terminate":         (*Server).terminate,
+	"disconnect":        (*Server).terminate,
+}
+
+// Server is a Debug Adapter Protocol server that runs a Monkey program in
+// the VM, speaking DAP over a pair of streams, usually stdin and stdout.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	writeMu sync.Mutex
+	seq     int
+
+	program     string
+	breakpoints []int
+	debugger    *vm.Debugger
+	finished    chan struct{}
+
+	// arrays and hashes handed out as variable references since the
+	// program last stopped
+	handles []object.Object
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+}
+
+// Serve handles requests until the client disconnects or closes the input.
+func (s *Server) Serve() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err == io.EOF {
+			s.stop()
+			return nil
+		}
+		if errors.Is(err, errInvalidMessage) {
+			// there is no request to respond to, so tell the user
+			if err := s.event("output", OutputEventBody{Category: "console", Output: err.Error() + "\n"}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			s.stop()
+			return err
+		}
+
+		if msg.Type != "request" {
+			continue
+		}
+
+		if err := s.respond(msg); err != nil {
+			return err
+		}
+
+		switch msg.Command {
+		case "initialize":
+			if err := s.event("initialized", nil); err != nil {
+				return err
+			}
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+func (s *Server) respond(req *message) error {
+	resp := &message{Type: "response", Command: req.Command, RequestSeq: req.Seq}
+	success := false
+	resp.Success = &success
+
+	h, ok := handlers[req.Command]
+	if !ok {
+		resp.Message = "unsupported request: " + req.Command
+		return s.send(resp)
+	}
+
+	body, err := h(s, req.Arguments)
+	if err != nil {
+		resp.Message = err.Error()
+		return s.send(resp)
+	}
+
+	if body != nil {
+		if resp.Body, err = json.Marshal(body); err != nil {
+			resp.Message = err.Error()
+			return s.send(resp)
+		}
+	}
+
+	success = true
+	return s.send(resp)
+}
+
+func (s *Server) event(name string, body interface{}) error {
+	msg := &message{Type: "event", Event: name}
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		msg.Body = raw
+	}
+	return s.send(msg)
+}
+
+func (s *Server) send(msg *message) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.seq++
+	msg.Seq = s.seq
+	return writeMessage(s.out, msg)
+}
+
+// outputWriter forwards everything written to it to the client as program
+// output of category, "stdout" or "stderr".
+type outputWriter struct {
+	s        *Server
+	category string
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	if err := w.s.event("output", OutputEventBody{Category: w.category, Output: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func unmarshalArgs(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	return json.Unmarshal(args, v)
+}
+
+func (s *Server) initialize(args json.RawMessage) (interface{}, error) {
+	return Capabilities{
+		SupportsConfigurationDoneRequest: true,
+		SupportsTerminateRequest:         true,
+	}, nil
+}
+
+func (s *Server) launch(args json.RawMessage) (interface{}, error) {
+	var a LaunchArguments
+	if err := unmarshalArgs(args, &a); err != nil {
+		return nil, err
+	}
+	if s.debugger != nil {
+		return nil, errors.New("program already launched")
+	}
+
+	src, err := os.ReadFile(a.Program)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if errs := p.ErrorDetails(); len(errs) != 0 {
+		return nil, fmt.Errorf("%s:%s", a.Program, errs[0])
+	}
+
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", a.Program, err)
+	}
+
+	c := compiler.New()
+	c.SetPath(a.Program)
+	if err := c.Compile(expanded); err != nil {
+		return nil, fmt.Errorf("%s: compilation failed:\n%s", a.Program, err)
+	}
+
+	s.program = a.Program
+	machine := vm.New(c.Bytecode())
+	// the protocol owns stdin and stdout, so the program gets no input and
+	// its output goes to the client
+	machine.SetIO(object.NewIO(nil, outputWriter{s, "stdout"}, outputWriter{s, "stderr"}))
+	s.debugger = vm.NewDebugger(machine, a.StopOnEntry)
+	s.debugger.GlobalNames = c.SymbolTable().Names()
+	s.debugger.SetBreakpoints(s.breakpoints)
+	return nil, nil
+}
+
+func (s *Server) setBreakpoints(args json.RawMessage) (interface{}, error) {
+	var a SetBreakpointsArguments
+	if err := unmarshalArgs(args, &a); err != nil {
+		return nil, err
+	}
+
+	s.breakpoints = make([]int, len(a.Breakpoints))
+	for i, bp := range a.Breakpoints {
+		s.breakpoints[i] = bp.Line
+	}
+
+	// breakpoints set before launch are verified once the program compiles
+	verified := make([]bool, len(s.breakpoints))
+	if s.debugger != nil {
+		verified = s.debugger.SetBreakpoints(s.breakpoints)
+	}
+
+	body := SetBreakpointsResponseBody{Breakpoints: []Breakpoint{}}
+	for i, line := range s.breakpoints {
+		body.Breakpoints = append(body.Breakpoints, Breakpoint{Verified: verified[i], Line: line})
+	}
+	return body, nil
+}
+
+// configurationDone starts the launched program.
+func (s *Server) configurationDone(args json.RawMessage) (interface{}, error) {
+	if s.debugger == nil {
+		return nil, errors.New("no program launched")
+	}
+	if s.finished != nil {
+		return nil, nil
+	}
+
+	s.finished = make(chan struct{})
+	s.debugger.Start()
+	go s.forwardEvents(s.debugger, s.finished)
+	return nil, nil
+}
+
+// forwardEvents reports the stops and the end of the program to the client.
+func (s *Server) forwardEvents(d *vm.Debugger, finished chan struct{}) {
+	defer close(finished)
+
+	for stop := range d.Stops() {
+		s.event("stopped", StoppedEventBody{
+			Reason:            string(stop.Reason),
+			ThreadID:          threadID,
+			AllThreadsStopped: true,
+		})
+	}
+
+	exitCode := 0
+	if err := <-d.Done(); err != nil {
+		exitCode = 1
+		if err != vm.ErrTerminated {
+			s.event("output", OutputEventBody{Category: "stderr", Output: "vm failed: " + err.Error() + "\n"})
+		}
+	}
+
+	s.event("exited", ExitedEventBody{ExitCode: exitCode})
+	s.event("terminated", nil)
+}
+
+// stopped returns the debugger if the program is stopped.
+func (s *Server) stopped() (*vm.Debugger, error) {
+	if s.debugger == nil || !s.debugger.Stopped() {
+		return nil, errors.New("program is not stopped")
+	}
+	return s.debugger, nil
+}
+
+func (s *Server) threads(args json.RawMessage) (interface{}, error) {
+	return ThreadsResponseBody{Threads: []Thread{{ID: threadID, Name: "main"}}}, nil
+}
+
+func (s *Server) stackTrace(args json.RawMessage) (interface{}, error) {
+	d, err := s.stopped()
+	if err != nil {
+		return nil, err
+	}
+
+	body := StackTraceResponseBody{StackFrames: []StackFrame{}}
+	for i, f := range d.StackFrames() {
+		path := s.program
+		if f.File != "" {
+			path = f.File
+		}
+
+		body.StackFrames = append(body.StackFrames, StackFrame{
+			ID:     i + 1,
+			Name:   f.Name,
+			Source: Source{Name: filepath.Base(path), Path: path},
+			Line:   f.Line,
+			Column: 1,
+		})
+	}
+	body.TotalFrames = len(body.StackFrames)
+	return body, nil
+}
+
+func (s *Server) scopes(args json.RawMessage) (interface{}, error) {
+	var a ScopesArguments
+	if err := unmarshalArgs(args, &a); err != nil {
+		return nil, err
+	}
+
+	return ScopesResponseBody{Scopes: []Scope{
+		{Name: "Locals", VariablesReference: a.FrameID<<2 | localsScope},
+		{Name: "Free Variables", VariablesReference: a.FrameID<<2 | freeScope},
+		{Name: "Globals", VariablesReference: a.FrameID<<2 | globalsScope},
+	}}, nil
+}
+
+func (s *Server) variables(args json.RawMessage) (interface{}, error) {
+	var a VariablesArguments
+	if err := unmarshalArgs(args, &a); err != nil {
+		return nil, err
+	}
+
+	d, err := s.stopped()
+	if err != nil {
+		return nil, err
+	}
+
+	ref := a.VariablesReference
+	if ref >= handleBase {
+		if ref-handleBase >= len(s.handles) {
+			return nil, fmt.Errorf("unknown variables reference %d", ref)
+		}
+		return VariablesResponseBody{Variables: s.children(s.handles[ref-handleBase])}, nil
+	}
+
+	var vars []vm.Variable
+	frame := ref>>2 - 1
+	switch ref & 3 {
+	case localsScope:
+		vars = d.Locals(frame)
+	case freeScope:
+		vars = d.FreeVariables(frame)
+	case globalsScope:
+		vars = d.Globals()
+	}
+
+	body := VariablesResponseBody{Variables: []Variable{}}
+	for _, v := range vars {
+		body.Variables = append(body.Variables, s.variable(v.Name, v.Value))
+	}
+	return body, nil
+}
+
+func (s *Server) variable(name string, value object.Object) Variable {
+	v := Variable{Name: name, Value: value.Inspect(), Type: string(value.Type())}
+	switch value.(type) {
+	case *object.Array, *object.Hash:
+		s.handles = append(s.handles, value)
+		v.VariablesReference = handleBase + len(s.handles) - 1
+	}
+	return v
+}
+
+// children returns the elements of an array or the pairs of a hash.
+func (s *Server) children(value object.Object) []Variable {
+	vars := []Variable{}
+	switch value := value.(type) {
+	case *object.Array:
+		for i, el := range value.Elements {
+			vars = append(vars, s.variable("["+strconv.Itoa(i)+"]", el))
+		}
+	case *object.Hash:
+		for _, pair := range value.Items() {
+			vars = append(vars, s.variable(pair.Key.Inspect(), pair.Value))
+		}
+	}
+	return vars
+}
+
+// resumeWith returns a handler resuming a stopped program with step.
+func resumeWith(step func(*vm.Debugger)) handler {
+	return func(s *Server, args json.RawMessage) (interface{}, error) {
+		d, err := s.stopped()
+		if err != nil {
+			return nil, err
+		}
+
+		s.handles = nil
+		step(d)
+		return nil, nil
+	}
+}
+
+func (s *Server) pause(args json.RawMessage) (interface{}, error) {
+	if s.debugger == nil {
+		return nil, errors.New("no program launched")
+	}
+	s.debugger.Pause()
+	return nil, nil
+}
+
+func (s *Server) terminate(args json.RawMessage) (interface{}, error) {
+	s.stop()
+	return nil, nil
+}
+
+// stop terminates the program and waits until its end has been reported.
+func (s *Server) stop() {
+	if s.debugger == nil || s.finished == nil {
+		return
+	}
+	s.debugger.Terminate()
+	<-s.finished
+}
@@ -0,0 +1,304 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const testProgram = `let add = fn(a, b) {
+  let sum = [a, b];
+  sum
+};
+let x = add(1, 2);
+puts(x);
+`
+
+// client drives a Server over in-memory pipes the way an editor would.
+type client struct {
+	t      *testing.T
+	w      io.WriteCloser
+	r      *bufio.Reader
+	seq    int
+	events []*message
+	done   chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{t: t, w: clientOut, r: bufio.NewReader(clientIn), done: make(chan error, 1)}
+	go func() {
+		err := NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+		c.done <- err
+	}()
+
+	return c
+}
+
+func (c *client) read() *message {
+	c.t.Helper()
+	msg, err := readMessage(c.r)
+	if err != nil {
+		c.t.Fatalf("read failed: %s", err)
+	}
+	return msg
+}
+
+// request sends a request and decodes the body of its response into body,
+// collecting any events that arrive first.
+func (c *client) request(command string, args, body interface{}) *message {
+	c.t.Helper()
+
+	c.seq++
+	raw, _ := json.Marshal(args)
+
+	// the server may be busy sending events, so write without blocking the
+	// reads below, as a buffered pipe would
+	written := make(chan error, 1)
+	go func() {
+		written <- writeMessage(c.w, &message{Seq: c.seq, Type: "request", Command: command, Arguments: raw})
+	}()
+	defer func() {
+		if err := <-written; err != nil {
+			c.t.Fatalf("write failed: %s", err)
+		}
+	}()
+
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+
+		if msg.Type != "response" || msg.RequestSeq != c.seq || msg.Command != command {
+			c.t.Fatalf("expected response to %s, got %+v", command, msg)
+		}
+		if body != nil && msg.Body != nil {
+			if err := json.Unmarshal(msg.Body, body); err != nil {
+				c.t.Fatalf("decoding %s body failed: %s", command, err)
+			}
+		}
+		return msg
+	}
+}
+
+func (c *client) mustRequest(command string, args, body interface{}) {
+	c.t.Helper()
+	if resp := c.request(command, args, body); !*resp.Success {
+		c.t.Fatalf("%s failed: %s", command, resp.Message)
+	}
+}
+
+// event returns the next event with the given name, skipping others.
+func (c *client) event(name string, body interface{}) {
+	c.t.Helper()
+
+	for {
+		var msg *message
+		if len(c.events) != 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.read()
+		}
+
+		if msg.Type == "event" && msg.Event == name {
+			if body != nil {
+				if err := json.Unmarshal(msg.Body, body); err != nil {
+					c.t.Fatalf("decoding %s event failed: %s", name, err)
+				}
+			}
+			return
+		}
+	}
+}
+
+func (c *client) expectStopped(reason string, line int) {
+	c.t.Helper()
+
+	var stopped StoppedEventBody
+	c.event("stopped", &stopped)
+	if stopped.Reason != reason || stopped.ThreadID != threadID {
+		c.t.Fatalf("wrong stopped event. want reason %s, got=%+v", reason, stopped)
+	}
+
+	var trace StackTraceResponseBody
+	c.mustRequest("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	if len(trace.StackFrames) == 0 || trace.StackFrames[0].Line != line {
+		c.t.Fatalf("wrong stack trace, expected to be on line %d: %+v", line, trace.StackFrames)
+	}
+}
+
+func (c *client) variables(ref int) map[string]Variable {
+	c.t.Helper()
+
+	var body VariablesResponseBody
+	c.mustRequest("variables", VariablesArguments{VariablesReference: ref}, &body)
+
+	vars := make(map[string]Variable)
+	for _, v := range body.Variables {
+		vars[v.Name] = v
+	}
+	return vars
+}
+
+func (c *client) launch(program string, stopOnEntry bool) {
+	c.t.Helper()
+
+	path := filepath.Join(c.t.TempDir(), "test.mk")
+	if err := os.WriteFile(path, []byte(program), 0o644); err != nil {
+		c.t.Fatal(err)
+	}
+
+	var caps Capabilities
+	c.mustRequest("initialize", map[string]string{"adapterID": "monkey"}, &caps)
+	if !caps.SupportsConfigurationDoneRequest {
+		c.t.Errorf("missing capabilities: %+v", caps)
+	}
+	c.event("initialized", nil)
+
+	c.mustRequest("launch", LaunchArguments{Program: path, StopOnEntry: stopOnEntry}, nil)
+}
+
+func (c *client) close() {
+	c.t.Helper()
+	c.mustRequest("disconnect", nil, nil)
+	if err := <-c.done; err != nil {
+		c.t.Fatalf("server failed: %s", err)
+	}
+}
+
+func TestBreakpointsAndVariables(t *testing.T) {
+	c := newClient(t)
+	c.launch(testProgram, false)
+
+	var bps SetBreakpointsResponseBody
+	c.mustRequest("setBreakpoints", SetBreakpointsArguments{
+		Breakpoints: []SourceBreakpoint{{Line: 3}, {Line: 4}},
+	}, &bps)
+	if len(bps.Breakpoints) != 2 || !bps.Breakpoints[0].Verified || bps.Breakpoints[1].Verified {
+		t.Errorf("wrong breakpoints: %+v", bps.Breakpoints)
+	}
+
+	c.mustRequest("configurationDone", nil, nil)
+	c.expectStopped("breakpoint", 3)
+
+	var trace StackTraceResponseBody
+	c.mustRequest("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	if len(trace.StackFrames) != 2 || trace.StackFrames[0].Name != "add" ||
+		trace.StackFrames[1].Name != "main" || trace.StackFrames[1].Line != 5 {
+		t.Fatalf("wrong stack trace: %+v", trace.StackFrames)
+	}
+
+	var scopes ScopesResponseBody
+	c.mustRequest("scopes", ScopesArguments{FrameID: trace.StackFrames[0].ID}, &scopes)
+	if len(scopes.Scopes) != 3 {
+		t.Fatalf("wrong scopes: %+v", scopes.Scopes)
+	}
+
+	locals := c.variables(scopes.Scopes[0].VariablesReference)
+	if locals["a"].Value != "1" || locals["b"].Value != "2" || locals["sum"].Value != "[1, 2]" {
+		t.Fatalf("wrong locals: %+v", locals)
+	}
+
+	elements := c.variables(locals["sum"].VariablesReference)
+	if elements["[1]"].Value != "2" || elements["[1]"].Type != "INTEGER" {
+		t.Errorf("wrong elements: %+v", elements)
+	}
+
+	globals := c.variables(scopes.Scopes[2].VariablesReference)
+	if _, ok := globals["add"]; !ok || len(globals) != 1 {
+		t.Errorf("wrong globals: %+v", globals)
+	}
+
+	c.mustRequest("stepOut", map[string]int{"threadId": threadID}, nil)
+	c.expectStopped("step", 6)
+
+	c.mustRequest("continue", map[string]int{"threadId": threadID}, nil)
+
+	var exited ExitedEventBody
+	c.event("exited", &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("wrong exit code: %d", exited.ExitCode)
+	}
+	c.event("terminated", nil)
+
+	if resp := c.request("stackTrace", map[string]int{"threadId": threadID}, nil); *resp.Success {
+		t.Errorf("expected stackTrace to fail after the program ended")
+	}
+
+	c.close()
+}
+
+func TestStepping(t *testing.T) {
+	c := newClient(t)
+	c.launch(testProgram, true)
+	c.mustRequest("configurationDone", nil, nil)
+
+	c.expectStopped("entry", 1)
+	c.mustRequest("next", map[string]int{"threadId": threadID}, nil)
+	c.expectStopped("step", 5)
+	c.mustRequest("stepIn", map[string]int{"threadId": threadID}, nil)
+	c.expectStopped("step", 2)
+	c.mustRequest("next", map[string]int{"threadId": threadID}, nil)
+	c.expectStopped("step", 3)
+
+	// disconnecting terminates the stopped program
+	c.close()
+}
+
+func TestLaunchErrors(t *testing.T) {
+	c := newClient(t)
+
+	c.mustRequest("initialize", nil, nil)
+	resp := c.request("launch", LaunchArguments{Program: filepath.Join(t.TempDir(), "missing.mk")}, nil)
+	if *resp.Success {
+		t.Errorf("expected launch of a missing file to fail")
+	}
+
+	path := filepath.Join(t.TempDir(), "bad.mk")
+	os.WriteFile(path, []byte("let x = y;"), 0o644)
+	resp = c.request("launch", LaunchArguments{Program: path}, nil)
+	if *resp.Success || resp.Message != path+": compilation failed:\n1:9: undefined variable y" {
+		t.Errorf("wrong launch failure: %q", resp.Message)
+	}
+
+	if resp := c.request("evaluate", nil, nil); *resp.Success {
+		t.Errorf("expected unsupported request to fail")
+	}
+
+	c.close()
+}
+
+func TestInvalidMessages(t *testing.T) {
+	c := newClient(t)
+
+	body := `{"seq": 1, "type":`
+	if _, err := io.WriteString(c.w, "Content-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"+body); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+	var output OutputEventBody
+	c.event("output", &output)
+	if output.Category != "console" || output.Output != "invalid message: unexpected end of JSON input\n" {
+		t.Errorf("wrong output for an invalid message: %+v", output)
+	}
+
+	// the server keeps serving
+	c.mustRequest("initialize", nil, nil)
+	c.close()
+
+	c = newClient(t)
+	if _, err := io.WriteString(c.w, "Content-Length: -5\r\n\r\n"); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+	if err := <-c.done; err == nil || err.Error() != "invalid Content-Length: -5, want 0 to 67108864" {
+		t.Errorf("wrong error for a negative length: %v", err)
+	}
+}
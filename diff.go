@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+type diffLine struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// unifiedDiff returns the differences between a and b in unified diff format.
+func unifiedDiff(filename, a, b string) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s.orig\n+++ %s\n", filename, filename)
+
+	for start := 0; start < len(lines); {
+		// find the next change and the extent of its hunk
+		first := start
+		for first < len(lines) && lines[first].kind == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+
+		from := max(first-diffContext, start)
+		end := first
+		for unchanged := 0; end < len(lines) && unchanged <= 2*diffContext; end++ {
+			if lines[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		to := end
+		for to > first && lines[to-1].kind == ' ' {
+			to--
+		}
+		to = min(to+diffContext, len(lines))
+
+		writeHunk(&out, lines, from, to)
+		start = to
+	}
+
+	return out.String()
+}
+
+func writeHunk(out *bytes.Buffer, lines []diffLine, from, to int) {
+	aStart, bStart := 1, 1
+	for _, l := range lines[:from] {
+		if l.kind != '+' {
+			aStart++
+		}
+		if l.kind != '-' {
+			bStart++
+		}
+	}
+
+	aLen, bLen := 0, 0
+	for _, l := range lines[from:to] {
+		if l.kind != '+' {
+			aLen++
+		}
+		if l.kind != '-' {
+			bLen++
+		}
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+	for _, l := range lines[from:to] {
+		out.WriteByte(l.kind)
+		out.WriteString(l.text)
+		out.WriteByte('\n')
+	}
+}
+
+// diffLines computes a line diff of a and b from their longest common
+// subsequence.
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+
+	return lines
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
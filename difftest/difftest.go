@@ -0,0 +1,219 @@
+// Package difftest checks that the evaluator and the VM agree. Compare runs
+// a program in both engines, and Generate writes random programs for it to
+// run.
+package difftest
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/compiler"
+	"github.com/tneuqole/monkey-go/coverage"
+	"github.com/tneuqole/monkey-go/evaluator"
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/object"
+	"github.com/tneuqole/monkey-go/parser"
+	"github.com/tneuqole/monkey-go/vm"
+)
+
+// Result is the outcome of running a program in one engine.
+type Result struct {
+	// Value is the value of the last statement in canonical form, or empty
+	// if the program failed or does not end with an expression statement.
+	Value string
+	// Err is the error message if the program failed.
+	Err string
+	// Output is what the program wrote to stdout and stderr.
+	Output string
+	// Coverage lists the executable lines of the program and how many times
+	// each ran, as line:count.
+	Coverage string
+	// Panic is the panic value and stack if the engine panicked.
+	Panic string
+}
+
+// Failed reports whether the program failed or the engine panicked.
+func (r Result) Failed() bool { return r.Err != "" || r.Panic != "" }
+
+// Mismatch is a program the engines disagree on.
+type Mismatch struct {
+	Source    string
+	Evaluator Result
+	VM        Result
+}
+
+func (m *Mismatch) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "engines disagree on:\n%s\n", m.Source)
+	for _, r := range []struct {
+		name   string
+		result Result
+	}{{"evaluator", m.Evaluator}, {"vm", m.VM}} {
+		fmt.Fprintf(&b, "%s:", r.name)
+		switch {
+		case r.result.Panic != "":
+			fmt.Fprintf(&b, " panic: %s", r.result.Panic)
+		case r.result.Err != "":
+			fmt.Fprintf(&b, " error: %s", r.result.Err)
+		default:
+			fmt.Fprintf(&b, " %s", r.result.Value)
+		}
+		fmt.Fprintf(&b, "\n  output: %q\n  coverage: %s\n", r.result.Output, r.result.Coverage)
+	}
+	return b.String()
+}
+
+// Compare runs source in both engines and returns a *Mismatch if either
+// panics or they disagree on its value, on whether it fails, on its output
+// or on the lines it executes. Error messages are not compared, as the engines word them
+// differently. Source that does not parse is skipped.
+func Compare(source string) error {
+	program, ok := parse(source)
+	if !ok {
+		return nil
+	}
+	evaluated := RunEvaluator(program)
+	program, _ = parse(source)
+	executed := RunVM(program)
+
+	agree := evaluated.Panic == "" && executed.Panic == "" &&
+		evaluated.Failed() == executed.Failed() &&
+		evaluated.Value == executed.Value
+	if agree && !evaluated.Failed() {
+		agree = evaluated.Output == executed.Output && evaluated.Coverage == executed.Coverage
+	}
+	if agree {
+		return nil
+	}
+	return &Mismatch{Source: source, Evaluator: evaluated, VM: executed}
+}
+
+func parse(source string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	return program, len(p.Errors()) == 0
+}
+
+// RunEvaluator runs program with the evaluator.
+func RunEvaluator(program *ast.Program) (result Result) {
+	var out strings.Builder
+	defer recoverPanic(&result, &out)
+
+	env := object.NewEnvironment()
+	env.SetIO(object.NewIO(nil, &out, &out))
+	profile := coverage.NewProfile()
+	env.SetHook(evaluator.CoverageHook(profile, ""))
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	node, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	expanded := node.(*ast.Program)
+
+	evaluated := evaluator.Eval(expanded, env)
+	result.Output = out.String()
+	result.Coverage = formatCoverage(profile)
+	if err, ok := evaluated.(*object.Error); ok {
+		result.Err = err.Message
+	} else if endsWithExpression(expanded) {
+		result.Value = Canonical(evaluated)
+	}
+	return result
+}
+
+// RunVM compiles program and runs it in the VM.
+func RunVM(program *ast.Program) (result Result) {
+	var out strings.Builder
+	defer recoverPanic(&result, &out)
+
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	node, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	expanded := node.(*ast.Program)
+
+	c := compiler.New()
+	if err := c.Compile(expanded); err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	bytecode := c.Bytecode()
+	machine := vm.New(bytecode)
+	machine.SetIO(object.NewIO(nil, &out, &out))
+	profile := coverage.NewProfile()
+	cov := vm.NewCoverage(profile, "")
+	cov.Add(bytecode)
+	machine.SetHook(cov.Hook)
+	err = machine.Run()
+	result.Output = out.String()
+	result.Coverage = formatCoverage(profile)
+	if err != nil {
+		result.Err = err.Error()
+	} else if endsWithExpression(expanded) {
+		result.Value = Canonical(machine.LastPoppedStackElem())
+	}
+	return result
+}
+
+func formatCoverage(profile *coverage.Profile) string {
+	lines := []string{}
+	for _, line := range profile.Lines("") {
+		lines = append(lines, fmt.Sprintf("%d:%d", line.Number, line.Count))
+	}
+	return strings.Join(lines, " ")
+}
+
+func recoverPanic(result *Result, out *strings.Builder) {
+	if r := recover(); r != nil {
+		*result = Result{Output: out.String(), Panic: fmt.Sprintf("%v\n%s", r, debug.Stack())}
+	}
+}
+
+func endsWithExpression(program *ast.Program) bool {
+	n := len(program.Statements)
+	if n == 0 {
+		return false
+	}
+	_, ok := program.Statements[n-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+// Canonical returns obj in a form that is the same for equal values in
+// either engine. Unlike Inspect it quotes strings and hides how each engine
+// represents functions.
+func Canonical(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "<nil>"
+	case *object.String:
+		return strconv.Quote(obj.Value)
+	case *object.Integer, *object.Boolean, *object.Null:
+		return obj.Inspect()
+	case *object.Array:
+		elems := make([]string, len(obj.Elements))
+		for i, elem := range obj.Elements {
+			elems[i] = Canonical(elem)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case *object.Hash:
+		pairs := []string{}
+		for _, pair := range obj.Items() {
+			pairs = append(pairs, Canonical(pair.Key)+": "+Canonical(pair.Value))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *object.Function, *object.Closure, *object.CompiledFunction:
+		return "<function>"
+	case *object.Builtin:
+		return "<builtin " + obj.Name + ">"
+	default:
+		return "<" + string(obj.Type()) + ">"
+	}
+}
@@ -0,0 +1,62 @@
+package difftest
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// regressions are programs the engines once disagreed on.
+var regressions = []string{
+	"1 / 0",
+	`puts("a"); 1 / 0; puts("b")`,
+	`puts("a"); len(1); puts("b")`,
+	"if (true) { }",
+	"if (true) { let a = 1; }",
+	"if (false) { 1 }",
+	"fn() { 1 + if (true) { return 2 } else { 3 } }()",
+	"fn() { [1, if (true) { return 2 }] }()",
+	"return 5; 6",
+	"let a = 1; let a = a + 1; a",
+	"fn() { let b = 1; let b = b * 2; b }()",
+	`"a" == "a"`,
+	"[1, [2]] == [1, [2]]",
+	`{"b": 1, "a": 2}`,
+	`{[1, "a"]: 1}[[1, "a"]]`,
+	"let f = fn(x) { let y = x; }; f(1)",
+	"map([1, 2], fn(x) { x / 0 })",
+	"let a = -a; a",
+	"let f = fn() { let x = 5; x }; f(); fn() { let a = -a; a }()",
+	"let m = macro() { 1 }; m()",
+	"let f = fn(x) {\n  if (x) {\n    return 1;\n  }\n  puts(x);\n  2\n};\nf(false);\nf(true);\nlet g = fn() {\n  3\n};",
+}
+
+func TestRegressions(t *testing.T) {
+	for _, source := range regressions {
+		if err := Compare(source); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	seeds := int64(2000)
+	if testing.Short() {
+		seeds = 200
+	}
+	for seed := int64(0); seed < seeds; seed++ {
+		if err := Compare(Generate(rand.New(rand.NewSource(seed)))); err != nil {
+			t.Fatalf("seed %d: %s", seed, err)
+		}
+	}
+}
+
+func FuzzDifferential(f *testing.F) {
+	for _, seed := range []int64{0, 1, 42, 1 << 32, -7} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		if err := Compare(Generate(rand.New(rand.NewSource(seed)))); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,249 @@
+package difftest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// maxDepth bounds the nesting of generated expressions.
+const maxDepth = 4
+
+// Generate returns a random program for Compare. Its bindings are only used
+// where both engines agree they are defined and it has no recursion, so it
+// always terminates, but it may well fail with a runtime error.
+func Generate(r *rand.Rand) string {
+	g := &generator{r: r, scopes: [][]binding{nil}}
+
+	var b strings.Builder
+	for i := g.r.Intn(6); i > 0; i-- {
+		b.WriteString(g.statement(maxDepth))
+		b.WriteString("\n")
+	}
+	b.WriteString(g.expression(maxDepth))
+	b.WriteString(";\n")
+	return b.String()
+}
+
+type generator struct {
+	r *rand.Rand
+	// bindings visible in each enclosing function, innermost last
+	scopes [][]binding
+	// number of names used so far
+	names int
+}
+
+// binding is a name defined by a let statement or parameter. arity is the
+// number of parameters if it is bound to a function, or -1.
+type binding struct {
+	name  string
+	arity int
+}
+
+func (g *generator) define(arity int) string {
+	name := fmt.Sprintf("v%d", g.names)
+	g.names++
+	scope := &g.scopes[len(g.scopes)-1]
+	*scope = append(*scope, binding{name, arity})
+	return name
+}
+
+func (g *generator) visible() []binding {
+	var all []binding
+	for _, scope := range g.scopes {
+		all = append(all, scope...)
+	}
+	return all
+}
+
+// statement returns a statement ending with a semicolon.
+func (g *generator) statement(depth int) string {
+	switch g.r.Intn(6) {
+	case 0, 1:
+		value := g.expression(depth)
+		return fmt.Sprintf("let %s = %s;", g.define(-1), value)
+	case 2:
+		n := g.r.Intn(3)
+		value := g.function(n, depth)
+		return fmt.Sprintf("let %s = %s;", g.define(n), value)
+	case 3:
+		return fmt.Sprintf("puts(%s);", g.expression(depth))
+	default:
+		return g.expression(depth) + ";"
+	}
+}
+
+// block returns the statements of a block ending with an expression, in
+// their own scope for let statements.
+func (g *generator) block(depth int) string {
+	scope := len(g.scopes) - 1
+	defined := len(g.scopes[scope])
+	defer func() { g.scopes[scope] = g.scopes[scope][:defined] }()
+
+	var stmts []string
+	for i := g.r.Intn(3); i > 0; i-- {
+		stmts = append(stmts, g.statement(depth))
+	}
+	switch g.r.Intn(8) {
+	case 0:
+		// an empty block, or one ending with a let statement
+	case 1:
+		stmts = append(stmts, fmt.Sprintf("return %s;", g.expression(depth)))
+	default:
+		stmts = append(stmts, g.expression(depth))
+	}
+	return "{ " + strings.Join(stmts, " ") + " }"
+}
+
+// function returns a function literal with n parameters.
+func (g *generator) function(n, depth int) string {
+	g.scopes = append(g.scopes, nil)
+	defer func() { g.scopes = g.scopes[:len(g.scopes)-1] }()
+
+	params := make([]string, n)
+	for i := range params {
+		params[i] = g.define(-1)
+	}
+	return fmt.Sprintf("fn(%s) %s", strings.Join(params, ", "), g.block(depth-1))
+}
+
+func (g *generator) expressions(n, depth int) string {
+	exprs := make([]string, n)
+	for i := range exprs {
+		exprs[i] = g.expression(depth)
+	}
+	return strings.Join(exprs, ", ")
+}
+
+var (
+	prefixOperators = []string{"!", "-"}
+	infixOperators  = []string{"+", "-", "*", "/", "<", ">", "==", "!="}
+	strs            = []string{"", "a", "b", "ab", "héllo", "{}", "1"}
+	// builtins called by generated programs, with arguments from
+	// builtinArgs
+	builtins = []string{
+		"len", "first", "last", "rest", "push", "reverse", "sort", "contains",
+		"index_of", "uniq", "flatten", "keys", "values", "merge", "join",
+		"upper", "json_stringify", "range", "slice", "format", "map", "filter",
+		"reduce", "sort_by",
+	}
+)
+
+func (g *generator) pick(options []string) string {
+	return options[g.r.Intn(len(options))]
+}
+
+// expression returns an expression, parenthesized unless it is atomic.
+func (g *generator) expression(depth int) string {
+	if depth <= 0 || g.r.Intn(4) == 0 {
+		return g.atom()
+	}
+	depth--
+
+	switch g.r.Intn(11) {
+	case 0:
+		return fmt.Sprintf("(%s%s)", g.pick(prefixOperators), g.expression(depth))
+	case 1, 2:
+		return fmt.Sprintf("(%s %s %s)", g.expression(depth), g.pick(infixOperators), g.expression(depth))
+	case 3:
+		expr := fmt.Sprintf("if (%s) %s", g.expression(depth), g.block(depth))
+		if g.r.Intn(2) == 0 {
+			expr += " else " + g.block(depth)
+		}
+		return "(" + expr + ")"
+	case 4:
+		return fmt.Sprintf("[%s]", g.expressions(g.r.Intn(4), depth))
+	case 5:
+		pairs := make([]string, g.r.Intn(4))
+		for i := range pairs {
+			pairs[i] = g.key(depth) + ": " + g.expression(depth)
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case 6:
+		return fmt.Sprintf("(%s[%s])", g.expression(depth), g.expression(depth))
+	case 7:
+		// an immediately called function, with a wrong number of arguments
+		// now and then
+		n := g.r.Intn(3)
+		args := n
+		if g.r.Intn(10) == 0 {
+			args = g.r.Intn(3)
+		}
+		return fmt.Sprintf("(%s(%s))", g.function(n, depth), g.expressions(args, depth))
+	case 8:
+		// a closure over a parameter of the function returning it
+		g.scopes = append(g.scopes, nil)
+		outer := g.define(-1)
+		inner := g.function(1, depth)
+		g.scopes = g.scopes[:len(g.scopes)-1]
+		return fmt.Sprintf("(fn(%s) { %s }(%s)(%s))", outer, inner, g.expression(depth), g.expression(depth))
+	case 9:
+		var fns []binding
+		for _, b := range g.visible() {
+			if b.arity >= 0 {
+				fns = append(fns, b)
+			}
+		}
+		if len(fns) == 0 {
+			return g.atom()
+		}
+		fn := fns[g.r.Intn(len(fns))]
+		return fmt.Sprintf("%s(%s)", fn.name, g.expressions(fn.arity, depth))
+	default:
+		name := g.pick(builtins)
+		return fmt.Sprintf("%s(%s)", name, g.builtinArgs(name, depth))
+	}
+}
+
+// builtinArgs returns arguments for the builtin name, which are of the
+// right number and often of the right type.
+func (g *generator) builtinArgs(name string, depth int) string {
+	switch name {
+	case "push", "contains", "index_of", "merge", "join":
+		return g.expressions(2, depth)
+	case "range":
+		return fmt.Sprintf("%d, %d", g.r.Intn(5)-2, g.r.Intn(10)-2)
+	case "slice":
+		return fmt.Sprintf("%s, %d", g.expression(depth), g.r.Intn(7)-3)
+	case "format":
+		return fmt.Sprintf(`"{} and {}", %s`, g.expressions(2, depth))
+	case "map", "filter":
+		return g.expression(depth) + ", " + g.function(1+g.r.Intn(2), depth)
+	case "reduce":
+		return g.expressions(2, depth) + ", " + g.function(2, depth)
+	case "sort_by":
+		return g.expression(depth) + ", " + g.function(1, depth)
+	default:
+		return g.expression(depth)
+	}
+}
+
+// key returns an expression usable as a hash key most of the time.
+func (g *generator) key(depth int) string {
+	switch g.r.Intn(6) {
+	case 0:
+		return g.expression(depth)
+	case 1:
+		return fmt.Sprintf("[%d, %q]", g.r.Intn(3), g.pick(strs))
+	default:
+		return g.atom()
+	}
+}
+
+func (g *generator) atom() string {
+	switch g.r.Intn(6) {
+	case 0:
+		if names := g.visible(); len(names) > 0 {
+			return names[g.r.Intn(len(names))].name
+		}
+		return "0"
+	case 1:
+		return g.pick([]string{"true", "false"})
+	case 2:
+		return fmt.Sprintf("%q", g.pick(strs))
+	case 3:
+		return g.pick([]string{"9223372036854775807", "4294967296"})
+	default:
+		return fmt.Sprint(g.r.Intn(10))
+	}
+}
@@ -0,0 +1,46 @@
+package evaluator
+
+import (
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/coverage"
+	"github.com/tneuqole/monkey-go/object"
+)
+
+// CoverageHook returns a hook recording in profile the lines whose
+// statements run, reporting the lines of the main program under the path
+// main. Install it with the SetHook method of the program's environment.
+func CoverageHook(profile *coverage.Profile, main string) object.EvalHook {
+	return func(node ast.Node, env *object.Environment) error {
+		file, _ := env.Module()
+		if file == "" {
+			file = main
+		}
+
+		if program, ok := node.(*ast.Program); ok {
+			// every statement of a program is executable, including those
+			// of functions that are never called
+			ast.Inspect(program, func(n ast.Node) bool {
+				if isStatement(n) {
+					profile.AddLines(file, ast.Start(n).Line)
+				}
+				return true
+			})
+			return nil
+		}
+
+		if isStatement(node) {
+			profile.Hit(file, ast.Start(node).Line)
+		}
+		return nil
+	}
+}
+
+// isStatement reports whether node is a statement the compiler records in
+// its line tables, so that both engines agree on the executable lines.
+func isStatement(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.LetStatement, *ast.ReturnStatement, *ast.ExpressionStatement:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package evaluator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tneuqole/monkey-go/coverage"
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/object"
+	"github.com/tneuqole/monkey-go/parser"
+)
+
+func TestCoverageHook(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.mk")
+	os.WriteFile(lib, []byte("export let sign = fn(x) {\n  if (x < 0) {\n    return -1;\n  }\n  1\n};\n"), 0o644)
+	main := filepath.Join(dir, "main.mk")
+
+	program := parser.New(lexer.New(`let lib = import "` + lib + `";
+let sum = 0;
+let count = fn(n) {
+  if (n == 0) { return 0; }
+  count(n - 1) + 1
+};
+count(3);
+let never = fn() {
+  puts("never");
+};`)).ParseProgram()
+
+	profile := coverage.NewProfile()
+	env := object.NewEnvironment()
+	env.SetHook(CoverageHook(profile, main))
+	if result := Eval(program, env); isError(result) {
+		t.Fatalf("eval error: %s", result.Inspect())
+	}
+
+	// the same as the VM records, see vm.TestCoverage
+	tests := map[string]string{
+		main: "[{1 1} {2 1} {3 1} {4 5} {5 3} {7 1} {8 1} {9 0}]",
+		lib:  "[{1 1} {2 0} {3 0} {5 0}]",
+	}
+	for file, want := range tests {
+		if got := fmt.Sprint(profile.Lines(file)); got != want {
+			t.Errorf("wrong lines of %s.\nwant=%s\ngot= %s", file, want, got)
+		}
+	}
+}
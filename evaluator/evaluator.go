@@ -8,12 +8,16 @@ import (
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := runHook(node, env); err != nil {
+		return err
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node.Statements, env)
@@ -25,17 +29,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if returnsEarly(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if returnsEarly(left) {
 			return left
 		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if returnsEarly(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
@@ -45,13 +49,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalIfExpression(node, env)
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		if returnsEarly(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if returnsEarly(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
@@ -61,40 +65,45 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
 	case *ast.CallExpression:
 		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments to quote: want=1, got=%d", len(node.Arguments))
+			}
 			return quote(node.Arguments[0], env)
 		}
 		fn := Eval(node.Function, env)
-		if isError(fn) {
+		if returnsEarly(fn) {
 			return fn
 		}
 
 		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && returnsEarly(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(fn, args)
+		return applyFunction(fn, args, env.IO())
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
-		if isError(elements[0]) {
+		if len(elements) == 1 && returnsEarly(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if returnsEarly(left) {
 			return left
 		}
 		i := Eval(node.Index, env)
-		if isError(i) {
+		if returnsEarly(i) {
 			return i
 		}
 
 		return evalIndexExpression(left, i)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+	case *ast.ImportExpression:
+		return evalImportExpression(node, env)
 	}
 
 	return nil
@@ -129,6 +138,10 @@ func evalBlockStatement(stmts []ast.Statement, env *object.Environment) object.O
 		}
 	}
 
+	// blocks that are empty or end with a let statement are null
+	if result == nil {
+		return NULL
+	}
 	return result
 }
 
@@ -179,9 +192,9 @@ func evalInfixExpression(op string, left, right object.Object) object.Object {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(op, left, right)
 	case op == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equal(left, right))
 	case op == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s", left.Type(), op, right.Type())
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
@@ -213,6 +226,9 @@ func evalIntegerInfixExpression(op string, left, right object.Object) object.Obj
 	case "*":
 		return &object.Integer{Value: lval * rval}
 	case "/":
+		if rval == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: lval / rval}
 	case "<":
 		return nativeBoolToBooleanObject(lval < rval)
@@ -229,7 +245,7 @@ func evalIntegerInfixExpression(op string, left, right object.Object) object.Obj
 
 func evalIfExpression(exp *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(exp.Condition, env)
-	if isError(condition) {
+	if returnsEarly(condition) {
 		return condition
 	}
 
@@ -255,6 +271,19 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
+// runHook calls the hook of the program env belongs to, if it has one, and
+// returns its error as an ERROR.
+func runHook(node ast.Node, env *object.Environment) *object.Error {
+	hook := env.Hook()
+	if hook == nil || node == nil {
+		return nil
+	}
+	if err := hook(node, env); err != nil {
+		return newError("%s", err)
+	}
+	return nil
+}
+
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -266,12 +295,23 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// returnsEarly reports whether obj is an error or return value, which stop
+// the evaluation of everything around them up to the enclosing function or
+// program.
+func returnsEarly(obj object.Object) bool {
+	if obj != nil {
+		rt := obj.Type()
+		return rt == object.ERROR_OBJ || rt == object.RETURN_VALUE_OBJ
+	}
+	return false
+}
+
 func evalIdentifier(id *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(id.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[id.Value]; ok {
+	if builtin, ok := env.Builtins().Lookup(id.Value); ok {
 		return builtin
 	}
 
@@ -282,7 +322,7 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	var result []object.Object
 	for _, exp := range exps {
 		evaluated := Eval(exp, env)
-		if isError(evaluated) {
+		if returnsEarly(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -291,14 +331,24 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func applyFunction(fnobj object.Object, args []object.Object) object.Object {
+func applyFunction(fnobj object.Object, args []object.Object, streams *object.IO) object.Object {
 	switch fn := fnobj.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		// call the functions the body ends with here, not in evalTail, so
+		// that recursion through tail calls runs in constant space
+		for {
+			if len(args) != len(fn.Parameters) {
+				return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+			}
+			evaluated := unwrapReturnValue(evalTail(fn.Body, extendFunctionEnv(fn, args)))
+			call, ok := evaluated.(*tailCall)
+			if !ok {
+				return evaluated
+			}
+			fn, args = call.fn, call.args
+		}
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		if result := fn.Call(host{streams}, args...); result != nil {
 			return result
 		}
 		return NULL
@@ -307,6 +357,22 @@ func applyFunction(fnobj object.Object, args []object.Object) object.Object {
 	}
 }
 
+// host is the Host passed to builtins.
+type host struct{ io *object.IO }
+
+func (h host) Call(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args, h.io)
+}
+
+// Try is the same as Call, as failures in the evaluator are only values.
+func (h host) Try(fn object.Object, args ...object.Object) object.Object {
+	return h.Call(fn, args...)
+}
+
+func (h host) IO() *object.IO {
+	return h.io
+}
+
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
 	env := object.NewEnclosedEnvironment(fn.Env)
 	for i, p := range fn.Parameters {
@@ -329,6 +395,8 @@ func evalIndexExpression(left, index object.Object) object.Object {
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return evalModuleIndexExpression(left, index)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -337,17 +405,26 @@ func evalIndexExpression(left, index object.Object) object.Object {
 func evalHashIndexExpression(obj, index object.Object) object.Object {
 	hash := obj.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
+	key, ok := object.AsHashable(index)
 	if !ok {
 		return newError("not hashable: %s", index.Type())
 	}
 
-	pair, ok := hash.Pairs[key.HashKey()]
+	val, ok := hash.Get(key)
 	if !ok {
 		return NULL
 	}
 
-	return pair.Value
+	return val
+}
+
+func evalModuleIndexExpression(mod, name object.Object) object.Object {
+	m := mod.(*object.Module)
+	val, ok := m.Exports[name.(*object.String).Value]
+	if !ok {
+		return newError("%s has no export %s", m.Inspect(), name.(*object.String).Value)
+	}
+	return val
 }
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
@@ -363,27 +440,26 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
-	for keyNode, valNode := range node.Pairs {
+	for _, keyNode := range node.OrderedKeys() {
 		key := Eval(keyNode, env)
-		if isError(key) {
+		if returnsEarly(key) {
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.AsHashable(key)
 		if !ok {
 			return newError("not hashable: %s", key.Type())
 		}
 
-		val := Eval(valNode, env)
-		if isError(val) {
+		val := Eval(node.Pairs[keyNode], env)
+		if returnsEarly(val) {
 			return val
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: val}
+		hash.Set(hashKey, val)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
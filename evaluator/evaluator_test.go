@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/tneuqole/monkey-go/lexer"
@@ -59,6 +60,17 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true}, {"1 != 1", false},
+		{`"a" == "a"`, true},
+		{`"a" + "b" == "ab"`, true},
+		{`"a" != "b"`, true},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, [2]] != [1, [3]]", true},
+		{"[1, 2] == [1]", false},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{"first([]) == first([])", true},
+		{`1 == "1"`, false},
+		{"[1] == 1", false},
 	}
 
 	for _, tt := range tests {
@@ -98,6 +110,8 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (true) { }", nil},
+		{"if (true) { let a = 1; }", nil},
 	}
 
 	for _, tt := range tests {
@@ -121,6 +135,8 @@ func TestReturnStatements(t *testing.T) {
 		{"return 2 * 5; 9;", 10},
 		{"9; return 2 * 5; 9;", 10},
 		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+		{"fn() { 1 + if (true) { return 2 } else { 3 } }()", 2},
+		{"fn() { [1, if (true) { return 2 }] }()", 2},
 	}
 
 	for _, tt := range tests {
@@ -172,6 +188,12 @@ func TestErrorHandling(t *testing.T) {
 		{"foobar", "identifier not found: foobar"},
 		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
 		{`{"name": "Monkey"}[fn(x) {x}];`, "not hashable: FUNCTION"},
+		{
+			"let f = fn(x) { x }; f(1, 2)",
+			"wrong number of arguments: want=1, got=2",
+		},
+		{"1 / 0", "division by zero"},
+		{"len(1); 5", "argument to `len` not supported, got=INTEGER"},
 	}
 
 	for _, tt := range tests {
@@ -197,6 +219,7 @@ func TestLetStatements(t *testing.T) {
 		{"let a = 5 * 5; a;", 25},
 		{"let a = 5; let b = a; b;", 5},
 		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let a = 5; let a = a + 1; a;", 6},
 	}
 
 	for _, tt := range tests {
@@ -243,6 +266,37 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(1000000, 0)", 1000000},
+		{`
+		let even = fn(n) { if (n == 0) { true } else { return odd(n - 1); } };
+		let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+		even(100001)`, false},
+		{"let f = fn(n) { if (n > 0) { return f(n - 1); } 7 }; f(3)", 7},
+		{"let f = fn(xs) { if (len(xs) > 2) { len(xs) } else { f(push(xs, 0)) } }; f([])", 3},
+		{"let add = fn(a, b) { a + b }; let f = fn(x) { add(x) }; f(1)", "wrong number of arguments: want=2, got=1"},
+		{"let f = fn(n) { if (n == 0) { -true } else { f(n - 1) } }; f(10)", "unknown operator: -BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			err, ok := evaluated.(*object.Error)
+			if !ok || err.Message != expected {
+				t.Errorf("got %s, want error %q", evaluated.Inspect(), expected)
+			}
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 		let newAdder = fn(x) {
@@ -289,6 +343,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`let s = "héllo"; len(s) - len(chars(s))`, 0},
 		{`len(1)`, "argument to `len` not supported, got=INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
@@ -312,6 +368,298 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestCustomBuiltins(t *testing.T) {
+	r := object.NewStandardRegistry("puts")
+	r.Register("double", object.Exactly(1), func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`double(len("four"))`, 8},
+		{`let f = fn(g) { g(2) }; f(double)`, 4},
+		{`let double = fn(x) { x }; double(3)`, 3},
+		{`double(1, 2)`, "wrong number of arguments. got=2, want=1"},
+		{`puts(1)`, "identifier not found: puts"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := Eval(program, object.NewEnvironmentWithBuiltins(r))
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("wrong result for %q. want error %q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	r := object.NewStandardRegistry()
+	r.RegisterHost("apply", object.Exactly(2), func(host object.Host, args ...object.Object) object.Object {
+		arr := args[0].(*object.Array)
+		result := make([]object.Object, len(arr.Elements))
+		for i, elem := range arr.Elements {
+			result[i] = host.Call(args[1], elem)
+			if _, ok := result[i].(*object.Error); ok {
+				return result[i]
+			}
+		}
+		return &object.Array{Elements: result}
+	})
+	r.RegisterFunc("count_if", func(arr []int, pred func(int) (bool, error)) (int, error) {
+		n := 0
+		for _, x := range arr {
+			ok, err := pred(x)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				n++
+			}
+		}
+		return n, nil
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`apply([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`let n = 10; apply([1, 2], fn(x) { x + n })`, "[11, 12]"},
+		{`apply([[1], [2, 3]], len)`, "[1, 2]"},
+		{`apply([1, 2], fn(x) { apply([x], fn(y) { y * 10 })[0] + 1 })`, "[11, 21]"},
+		{`apply([1], fn(x) { return x; 99 })`, "[1]"},
+		{`count_if([1, 2, 3, 4], fn(x) { x > 2 })`, "2"},
+		{`apply([1], fn(x) { -true })`, "ERROR: unknown operator: -BOOLEAN"},
+		{`apply([1], fn(x, y) { x })`, "ERROR: wrong number of arguments: want=2, got=1"},
+		{`apply([1], 5)`, "ERROR: not a function: INTEGER"},
+		{`count_if([1], fn(x) { x + true })`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := Eval(program, object.NewEnvironmentWithBuiltins(r))
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`let n = 10; map([1, 2], fn(x) { x + n })`, "[11, 12]"},
+		{`map([[1], [2, 3]], len)`, "[1, 2]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`map(1, fn(x) { x })`, "ERROR: argument to `map` must be ARRAY or HASH, got=INTEGER"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`filter([1, 2], fn(x) { if (x > 1) { "yes" } })`, "[2]"},
+		{`reduce([1, 2, 3], fn(acc, x) { acc + x })`, "6"},
+		{`reduce([1, 2, 3], fn(acc, x) { push(acc, x * x) }, [])`, "[1, 4, 9]"},
+		{`reduce([], fn(acc, x) { acc + x }, 0)`, "0"},
+		{`reduce([], fn(acc, x) { acc + x })`, "ERROR: `reduce` of empty ARRAY with no initial value"},
+		{`each([1, 2], fn(x) { x })`, "null"},
+		{`range(4)`, "[0, 1, 2, 3]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`range(5, 0, -2)`, "[5, 3, 1]"},
+		{`range(3, 1)`, "[]"},
+		{`range(0, 1, 0)`, "ERROR: `range` step must not be 0"},
+		{`range(0, 9223372036854775807, 4611686018427387904)`, "[0, 4611686018427387904]"},
+		{`range(-9223372036854775807, 9223372036854775807, -1)`, "[]"},
+		{`range(4611686018427387904)`, "ERROR: `range` would have more than 67108864 elements, got=4611686018427387904"},
+		{`range(9223372036854775807, -9223372036854775807, -2)`, "ERROR: `range` would have more than 67108864 elements, got=9223372036854775807"},
+		{`range(1, "a")`, "ERROR: argument 2 to `range` must be INTEGER, got=STRING"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`zip([1], [2], [3])`, "[[1, 2, 3]]"},
+		{`enumerate(["a", "b"])`, "[[0, a], [1, b]]"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([1, "a"])`, "ERROR: `sort` cannot compare INTEGER and STRING"},
+		{`sort([[1]])`, "ERROR: `sort` cannot compare ARRAY"},
+		{`sort_by(["ccc", "a", "bb"], len)`, "[a, bb, ccc]"},
+		{`sort_by([[2, "a"], [1, "b"], [2, "c"]], first)`, "[[1, b], [2, a], [2, c]]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`reverse("abc")`, "cba"},
+		{`slice([1, 2, 3, 4], 1, 3)`, "[2, 3]"},
+		{`slice([1, 2, 3, 4], -2)`, "[3, 4]"},
+		{`slice([1, 2], 5)`, "[]"},
+		{`slice("hello", 1, -1)`, "ell"},
+		{`contains([1, "a"], "a")`, "true"},
+		{`contains([1, 2], 3)`, "false"},
+		{`contains("hello", "ell")`, "true"},
+		{`contains({"a": 1}, "a")`, "true"},
+		{`index_of([1, 2, 3], 3)`, "2"},
+		{`index_of([1, 2, 3], 4)`, "-1"},
+		{`index_of("hello", "l")`, "2"},
+		{`flatten([1, [2, [3]], []])`, "[1, 2, [3]]"},
+		{`flatten([1, [2, [3]]], 2)`, "[1, 2, 3]"},
+		{`uniq([1, 2, 1, "a", "a", true, true])`, "[1, 2, a, true]"},
+		{`let f = fn(xs) { map(filter(xs, fn(x) { x > 1 }), fn(x) { x * 10 }) }; f(range(4))`, "[20, 30]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, 3: true}`, "{b: 1,a: 2,3: true}"},
+		{`keys({"b": 1, "a": 2})`, "[b, a]"},
+		{`values({"b": 1, "a": 2})`, "[1, 2]"},
+		{`items({"b": 1, "a": 2})`, "[[b, 1], [a, 2]]"},
+		{`keys({})`, "[]"},
+		{`keys([1])`, "ERROR: argument to `keys` must be HASH, got=ARRAY"},
+		{`has_key({"a": 1}, "a")`, "true"},
+		{`has_key({"a": 1}, "b")`, "false"},
+		{`has_key({"a": 1}, [{}])`, "ERROR: not hashable: ARRAY"},
+		{`delete({"a": 1, "b": 2, "c": 3}, "b")`, "{a: 1,c: 3}"},
+		{`let h = {"a": 1}; delete(h, "a"); h`, "{a: 1}"},
+		{`merge({"a": 1, "b": 2}, {"b": 3, "c": 4})`, "{a: 1,b: 3,c: 4}"},
+		{`merge({"a": 1}, 2)`, "ERROR: argument 2 to `merge` must be HASH, got=INTEGER"},
+		{`len({"a": 1, "b": 2})`, "2"},
+		{`map({"a": 1, "b": 2}, fn(k, v) { k + "=" + format("{}", v) })`, "[a=1, b=2]"},
+		{`filter({"a": 1, "b": 2, "c": 3}, fn(k, v) { v != 2 })`, "{a: 1,c: 3}"},
+		{`let total = fn(h) { reduce(values(h), fn(acc, v) { acc + v }, 0) }; total({"a": 1, "b": 2})`, "3"},
+		{`each({"a": 1}, fn(k, v) { v })`, "null"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_stringify({"b": [1, true, first([])], "a": "x"})`, `{"b":[1,true,null],"a":"x"}`},
+		{`json_parse(json_stringify({"b": [1, {}], "a": "x"}))`, "{b: [1, {}],a: x}"},
+		{`json_stringify([len])`, "ERROR: json_stringify: cannot serialize BUILTIN"},
+		{`json_parse("[1, 2")`, "ERROR: json_parse: unexpected end of JSON input"},
+		{`json_parse(1)`, "ERROR: argument to `json_parse` must be STRING, got=INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{`split("  a b  c ")`, "[a, b, c]"},
+		{`split(1, ",")`, "ERROR: argument to `split` must be STRING, got=INTEGER"},
+		{`join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`join([1, true, "x"])`, "1truex"},
+		{`join(["a"], 1)`, "ERROR: argument 2 to `join` must be STRING, got=INTEGER"},
+		{`trim("  hi  ")`, "hi"},
+		{`trim("xxhixx", "x")`, "hi"},
+		{`upper("héllo")`, "HÉLLO"},
+		{`lower("HeLLo")`, "hello"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`replace("a-b-c", "-", "+", 1)`, "a+b-c"},
+		{`replace("abc", "b", 1)`, "ERROR: argument 3 to `replace` must be STRING, got=INTEGER"},
+		{`contains("hello", "ell")`, "true"},
+		{`starts_with("hello", "he")`, "true"},
+		{`ends_with("hello", "he")`, "false"},
+		{`starts_with("hello", ["he"])`, "ERROR: argument 2 to `starts_with` must be STRING, got=ARRAY"},
+		{`index_of("héllo", "l")`, "2"},
+		{`index_of("hello", "z")`, "-1"},
+		{`substring("héllo", 1, 3)`, "él"},
+		{`substring("héllo", -2)`, "lo"},
+		{`substring([1], 0)`, "ERROR: argument to `substring` must be STRING, got=ARRAY"},
+		{`slice("日本語", 1)`, "本語"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", -1)`, "ERROR: `repeat` count must not be negative, got=-1"},
+		{`repeat("ab", 4611686018427387904)`, "ERROR: `repeat` of 2 bytes 4611686018427387904 times would have more than 67108864 bytes"},
+		{`len(repeat("ab", 33554432))`, "67108864"},
+		{`repeat("", 4611686018427387904)`, ""},
+		{`replace(repeat("a", 10000), "", repeat("b", 10000))`, "ERROR: `replace` of 10001 matches would have more than 67108864 bytes"},
+		{`len(replace(repeat("a", 3000), "", repeat("b", 3000), 2))`, "9000"},
+		{`len(replace(repeat("ab", 16777216), "a", "xyz"))`, "67108864"},
+		{`replace(repeat("ab", 16777216), "a", "wxyz")`, "ERROR: `replace` of 16777216 matches would have more than 67108864 bytes"},
+		{`chars("héy")`, "[h, é, y]"},
+		{`char(97)`, "a"},
+		{`char(-1)`, "ERROR: `char` of invalid code point -1"},
+		{`ord("é")`, "233"},
+		{`ord("ab")`, `ERROR: argument to ` + "`ord`" + ` must be a single character, got="ab"`},
+		{`format("{} is {}", "x", 1)`, "x is 1"},
+		{`format("{{}} {}", [1, 2])`, "{} [1, 2]"},
+		{`format("{}")`, "ERROR: `format` has more placeholders than arguments (0)"},
+		{`format("{}", 1, 2)`, "ERROR: `format` has 1 placeholders but 2 arguments"},
+		{`format("{x}", 1)`, `ERROR: ` + "`format`" + ` has unmatched '{' at offset 0`},
+		{`format(1)`, "ERROR: argument to `format` must be STRING, got=INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestIOBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		stdin    string
+		expected string
+		stdout   string
+		stderr   string
+	}{
+		{`puts("a", 1)`, "", "null", "a\n1\n", ""},
+		{`print("a", 1, [2])`, "", "null", "a 1 [2]\n", ""},
+		{`eprint("oops")`, "", "null", "", "oops\n"},
+		{`readline(); readline()`, "one\r\ntwo", "two", "", ""},
+		{`readline()`, "", "null", "", ""},
+		{`input("name? ")`, "bob\n", "bob", "name? ", ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr strings.Builder
+		env := object.NewEnvironment()
+		env.SetIO(object.NewIO(strings.NewReader(tt.stdin), &stdout, &stderr))
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("wrong stdout for %q. want=%q, got=%q", tt.input, tt.stdout, stdout.String())
+		}
+		if stderr.String() != tt.stderr {
+			t.Errorf("wrong stderr for %q. want=%q, got=%q", tt.input, tt.stderr, stderr.String())
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	evaluated := testEval(input)
@@ -457,6 +805,14 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{[1, "a"]: 5, [1]: 6}[[1, "a"]]`,
+			5,
+		},
+		{
+			`{[1]: 5}[[2]]`,
+			nil,
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -0,0 +1,58 @@
+package evaluator
+
+import (
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/module"
+	"github.com/tneuqole/monkey-go/object"
+)
+
+// evalImportExpression loads a module the first time it is imported by the
+// program, evaluating it in its own global environment, and returns the
+// cached module after that.
+func evalImportExpression(node *ast.ImportExpression, env *object.Environment) object.Object {
+	from, modules := env.Module()
+	path := module.Resolve(from, node.Path.Value)
+
+	if mod, ok := modules.Loaded[path]; ok {
+		return mod
+	}
+	if err := module.CheckCycle(modules.Loading, path); err != nil {
+		return newError("%s", err)
+	}
+
+	program, err := module.Parse(path)
+	if err != nil {
+		return newError("cannot import %q: %s", node.Path.Value, err)
+	}
+	modules.Loading = append(modules.Loading, path)
+	defer func() { modules.Loading = modules.Loading[:len(modules.Loading)-1] }()
+
+	// macros are local to the module that defines them
+	macroEnv := object.NewEnvironment()
+	DefineMacros(program, macroEnv)
+	expanded, err := ExpandMacros(program, macroEnv)
+	if err != nil {
+		return newError("%s:%s", path, err)
+	}
+	// after expanding, as macros may return
+	if err := module.CheckTopLevel(expanded.(*ast.Program)); err != nil {
+		return newError("%s:%s", path, err)
+	}
+
+	modEnv := object.NewModuleEnvironment(path, env)
+	if result := Eval(expanded, modEnv); isError(result) {
+		return result
+	}
+
+	mod := &object.Module{Path: path, Names: module.Exports(program), Exports: make(map[string]object.Object)}
+	for _, name := range mod.Names {
+		value, ok := modEnv.Get(name)
+		if !ok {
+			return newError("%s: export %s has no value", path, name)
+		}
+		mod.Exports[name] = value
+	}
+
+	modules.Loaded[path] = mod
+	return mod
+}
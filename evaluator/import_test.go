@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tneuqole/monkey-go/object"
+)
+
+var testModules = map[string]string{
+	"math.mk": `let square = fn(x) { x * x };
+let secret = 7;
+let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) };
+export let cube = fn(x) { square(x) * x };
+export let answer = secret * 6;
+export let sign = fn(x) { unless(x > 0, "negative", "positive") };`,
+	"lib/util.mk": `let m = import "../math";
+export let math = m;
+export let nine = m["cube"](3) / 3;`,
+	"cycle_a.mk": `import "cycle_b";`,
+	"cycle_b.mk": `import "cycle_a";`,
+	"broken.mk":  `let x = ;`,
+	"returns.mk": "if (true) { return 1; }\nexport let v = 2;",
+}
+
+// writeModules writes the test modules to a temporary directory and returns
+// it.
+func writeModules(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, src := range testModules {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestImports(t *testing.T) {
+	dir := writeModules(t)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let m = import "DIR/math"; m["cube"](3)`, 27},
+		{`import "DIR/math"["answer"]`, 42},
+		{`let secret = 1; let m = import "DIR/math"; secret + m["answer"]`, 43},
+		{`let m = import "DIR/math"; let u = import "DIR/lib/util"; m == u["math"]`, true},
+		{`import "DIR/lib/util"["nine"]`, 9},
+		{`import "DIR/math"["sign"](-1)`, "negative"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(strings.ReplaceAll(tt.input, "DIR", dir))
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if str, ok := evaluated.(*object.String); !ok || str.Value != expected {
+				t.Errorf("wrong value for %q. want=%q, got=%v", tt.input, expected, evaluated)
+			}
+		}
+	}
+
+	mod := testEval(`import "` + dir + `/math"`)
+	if expected := `module("` + dir + `/math.mk")`; mod.Inspect() != expected {
+		t.Errorf("wrong module. want=%q, got=%q", expected, mod.Inspect())
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := writeModules(t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "DIR/math"["square"]`, `module("DIR/math.mk") has no export square`},
+		{`import "DIR/cycle_a"`, "import cycle: DIR/cycle_a.mk -> DIR/cycle_b.mk -> DIR/cycle_a.mk"},
+		{`import "DIR/missing"`, `cannot import "DIR/missing": open DIR/missing.mk: no such file or directory`},
+		{`import "DIR/broken"`, `cannot import "DIR/broken": DIR/broken.mk:1:9: no prefix parse function for ; found`},
+		{`let r = import "DIR/returns"; r["v"] + 1`, "DIR/returns.mk:1:13: return outside function"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(strings.ReplaceAll(tt.input, "DIR", dir))
+
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if expected := strings.ReplaceAll(tt.expected, "DIR", dir); err.Message != expected {
+			t.Errorf("wrong error message. want=%q, got=%q", expected, err.Message)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package evaluator
 
 import (
+	"fmt"
+
 	"github.com/tneuqole/monkey-go/ast"
 	"github.com/tneuqole/monkey-go/object"
 )
@@ -24,8 +26,24 @@ func DefineMacros(program *ast.Program, env *object.Environment) {
 	}
 }
 
-func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
-	return ast.Modify(program, func(node ast.Node) ast.Node {
+// MacroError is returned by ExpandMacros for a macro call that fails or
+// does not return a quote.
+type MacroError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *MacroError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// ExpandMacros replaces every call of a macro defined in env with the code
+// it returns. A call that fails is left as it is, and the first failure is
+// returned as a *MacroError.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var err *MacroError
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
 		callExp, ok := node.(*ast.CallExpression)
 		if !ok {
 			return node
@@ -36,18 +54,37 @@ func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
 			return node
 		}
 
+		fail := func(format string, a ...interface{}) ast.Node {
+			if err == nil {
+				tok := ast.Start(callExp)
+				err = &MacroError{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, a...)}
+			}
+			return node
+		}
+
+		if len(callExp.Arguments) != len(macro.Parameters) {
+			return fail("wrong number of arguments to macro %s: want=%d, got=%d",
+				callExp.Function, len(macro.Parameters), len(callExp.Arguments))
+		}
+
 		args := quoteArgs(callExp)
 		evalEnv := extendMacroEnv(macro, args)
 
-		evaluated := Eval(macro.Body, evalEnv)
-
-		quote, ok := evaluated.(*object.Quote)
-		if !ok {
-			panic("we only support returning AST nodes from macros")
+		evaluated := unwrapReturnValue(Eval(macro.Body, evalEnv))
+		switch evaluated := evaluated.(type) {
+		case *object.Quote:
+			return evaluated.Node
+		case *object.Error:
+			return fail("macro %s failed: %s", callExp.Function, evaluated.Message)
+		default:
+			return fail("macro %s must return a quote, got %s", callExp.Function, evaluated.Type())
 		}
-
-		return quote.Node
 	})
+
+	if err != nil {
+		return expanded, err
+	}
+	return expanded, nil
 }
 
 func isMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
@@ -90,6 +90,14 @@ func TestExpandMacros(t *testing.T) {
 			`,
 			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") };`,
 		},
+		{
+			`
+			let twice = macro(x) { quote(unquote(x) + unquote(x)); };
+			twice(1);
+			twice(2);
+			`,
+			`(1 + 1); (2 + 2);`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -98,7 +106,10 @@ func TestExpandMacros(t *testing.T) {
 
 		env := object.NewEnvironment()
 		DefineMacros(program, env)
-		expanded := ExpandMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("ExpandMacros failed: %s", err)
+		}
 
 		if expanded.String() != expected.String() {
 			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
@@ -106,6 +117,35 @@ func TestExpandMacros(t *testing.T) {
 	}
 }
 
+func TestExpandMacroErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let m = macro() { 1 };\nm();", "2:1: macro m must return a quote, got INTEGER"},
+		{"let m = macro() { 1 + true };\nm();", "2:1: macro m failed: type mismatch: INTEGER + BOOLEAN"},
+		{"let m = macro(a) { quote(a) };\nm();", "2:1: wrong number of arguments to macro m: want=1, got=0"},
+		{"let m = macro() { quote() };\nm();", "2:1: macro m failed: wrong number of arguments to quote: want=1, got=0"},
+		{"let m = macro() { quote(unquote([1])) };\nm();", "2:1: macro m failed: cannot unquote ARRAY"},
+		{"let m = macro() { return quote(1); };\nm() + m(true);", "2:7: wrong number of arguments to macro m: want=0, got=1"},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("expected an error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
 func testParseProgram(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -8,14 +8,22 @@ import (
 	"github.com/tneuqole/monkey-go/token"
 )
 
+// quote returns node with its unquote calls evaluated. It changes a copy,
+// as node is the code of a macro or function that may run again.
 func quote(node ast.Node, env *object.Environment) object.Object {
-	node = evalUnquotedCalls(node, env)
+	node, err := evalUnquotedCalls(ast.Copy(node), env)
+	if err != nil {
+		return err
+	}
 	return &object.Quote{Node: node}
 }
 
-func evalUnquotedCalls(quoted ast.Node, env *object.Environment) ast.Node {
-	return ast.Modify(quoted, func(node ast.Node) ast.Node {
-		if !isUnquoteCall(node) {
+// evalUnquotedCalls replaces the unquote calls in quoted with the code for
+// their values. It fails if a value has no code, such as an array.
+func evalUnquotedCalls(quoted ast.Node, env *object.Environment) (ast.Node, object.Object) {
+	var err object.Object
+	quoted = ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if err != nil || !isUnquoteCall(node) {
 			return node
 		}
 
@@ -29,8 +37,18 @@ func evalUnquotedCalls(quoted ast.Node, env *object.Environment) ast.Node {
 		}
 
 		unquoted := Eval(call.Arguments[0], env)
-		return convertObjectToAstNode(unquoted)
+		if isError(unquoted) {
+			err = unquoted
+			return node
+		}
+		converted := convertObjectToAstNode(unquoted)
+		if converted == nil {
+			err = newError("cannot unquote %s", unquoted.Type())
+			return node
+		}
+		return converted
 	})
+	return quoted, err
 }
 
 func isUnquoteCall(node ast.Node) bool {
@@ -0,0 +1,93 @@
+package evaluator
+
+import (
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/object"
+)
+
+// tailCall is a call of a function whose value the calling function
+// returns. evalTail returns it instead of making the call, for
+// applyFunction to make once the caller is done.
+type tailCall struct {
+	fn   *object.Function
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// evalTail evaluates node, the body of a function or a part of it whose
+// value the function returns, as Eval does but returning a *tailCall for
+// a call of a function in the position of that value.
+func evalTail(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		if err := runHook(node, env); err != nil {
+			return err
+		}
+		var result object.Object
+		for i, stmt := range node.Statements {
+			_, ret := stmt.(*ast.ReturnStatement)
+			if ret || i == len(node.Statements)-1 {
+				result = evalTail(stmt, env)
+			} else {
+				result = Eval(stmt, env)
+			}
+			if returnsEarly(result) {
+				return result
+			}
+		}
+		if result == nil {
+			return NULL
+		}
+		return result
+	case *ast.ExpressionStatement:
+		if err := runHook(node, env); err != nil {
+			return err
+		}
+		return evalTail(node.Expression, env)
+	case *ast.ReturnStatement:
+		if err := runHook(node, env); err != nil {
+			return err
+		}
+		val := evalTail(node.ReturnValue, env)
+		if returnsEarly(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	case *ast.IfExpression:
+		if err := runHook(node, env); err != nil {
+			return err
+		}
+		condition := Eval(node.Condition, env)
+		if returnsEarly(condition) {
+			return condition
+		}
+		if isTruthy(condition) {
+			return evalTail(node.Consequence, env)
+		} else if node.Alternative != nil {
+			return evalTail(node.Alternative, env)
+		}
+		return NULL
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			break
+		}
+		if err := runHook(node, env); err != nil {
+			return err
+		}
+		fn := Eval(node.Function, env)
+		if returnsEarly(fn) {
+			return fn
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && returnsEarly(args[0]) {
+			return args[0]
+		}
+		if fn, ok := fn.(*object.Function); ok {
+			return &tailCall{fn: fn, args: args}
+		}
+		return applyFunction(fn, args, env.IO())
+	}
+	return Eval(node, env)
+}
@@ -0,0 +1,31 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/object"
+)
+
+// TraceHook returns a hook writing a line to w for every node the
+// evaluator evaluates: its position, the module it is in if not the main
+// program, its kind and the start of its source.
+func TraceHook(w io.Writer) object.EvalHook {
+	return func(node ast.Node, env *object.Environment) error {
+		pos := ast.Start(node)
+		where := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+		if file, _ := env.Module(); file != "" {
+			where = file + ":" + where
+		}
+
+		kind := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+		source := []rune(node.String())
+		if len(source) > 60 {
+			source = append(source[:57], []rune("...")...)
+		}
+		_, err := fmt.Fprintf(w, "%-10s %-20s %s\n", where, kind, string(source))
+		return err
+	}
+}
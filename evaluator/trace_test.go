@@ -0,0 +1,61 @@
+package evaluator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/object"
+	"github.com/tneuqole/monkey-go/parser"
+)
+
+func TestHook(t *testing.T) {
+	env := object.NewEnvironment()
+	var seen []string
+	env.SetHook(func(node ast.Node, env *object.Environment) error {
+		seen = append(seen, strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+		if lit, ok := node.(*ast.IntegerLiteral); ok && lit.Value == 2 {
+			return errors.New("stopped")
+		}
+		return nil
+	})
+
+	program := parser.New(lexer.New(`let f = fn() { 1; 2 }; f(); 3`)).ParseProgram()
+	result := Eval(program, env)
+	if err, ok := result.(*object.Error); !ok || err.Message != "stopped" {
+		t.Fatalf("wrong result. got=%v", result)
+	}
+
+	want := "[Program LetStatement FunctionLiteral ExpressionStatement CallExpression Identifier " +
+		"BlockStatement ExpressionStatement IntegerLiteral ExpressionStatement IntegerLiteral]"
+	if got := fmt.Sprint(seen); got != want {
+		t.Errorf("wrong nodes.\nwant=%s\ngot= %s", want, got)
+	}
+}
+
+func TestTraceHook(t *testing.T) {
+	var buf bytes.Buffer
+	env := object.NewEnvironment()
+	env.SetHook(TraceHook(&buf))
+
+	program := parser.New(lexer.New("let x = 1;\nx + 2")).ParseProgram()
+	if result := Eval(program, env); result.Inspect() != "3" {
+		t.Fatalf("wrong result. got=%s", result.Inspect())
+	}
+
+	want := `1:1        Program              let x = 1;(x + 2)
+1:1        LetStatement         let x = 1;
+1:9        IntegerLiteral       1
+2:1        ExpressionStatement  (x + 2)
+2:1        InfixExpression      (x + 2)
+2:1        Identifier           x
+2:5        IntegerLiteral       2
+`
+	if buf.String() != want {
+		t.Errorf("wrong trace.\nwant=%s\ngot= %s", want, buf.String())
+	}
+}
@@ -0,0 +1,361 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/parser"
+	"github.com/tneuqole/monkey-go/token"
+)
+
+const indentation = "    "
+
+const (
+	_ int = iota
+	lowest
+	equals
+	lessGreater
+	sum
+	product
+	prefix
+	call
+	index
+)
+
+var precedences = map[string]int{
+	"==": equals,
+	"!=": equals,
+	"<":  lessGreater,
+	">":  lessGreater,
+	"+":  sum,
+	"-":  sum,
+	"/":  product,
+	"*":  product,
+}
+
+// Source parses src and returns it in canonical Monkey style, keeping
+// comments. The result parses to the same program as src.
+func Source(src string) (string, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	pr := &printer{comments: l.Comments(), lines: strings.Split(src, "\n")}
+	pr.statements(program.Statements, false)
+	pr.flushComments(token.Token{Line: len(pr.lines) + 1})
+	if pr.buf.Len() > 0 {
+		pr.write("\n")
+	}
+
+	return pr.buf.String(), nil
+}
+
+// Node returns node formatted as Monkey source, without comments.
+func Node(node ast.Node) string {
+	pr := &printer{}
+	switch node := node.(type) {
+	case *ast.Program:
+		pr.statements(node.Statements, false)
+		pr.write("\n")
+	case *ast.BlockStatement:
+		pr.block(node)
+	case ast.Statement:
+		pr.statement(node, false)
+	case ast.Expression:
+		pr.expression(node, lowest)
+	}
+
+	return pr.buf.String()
+}
+
+type printer struct {
+	buf      bytes.Buffer
+	indent   int
+	comments []token.Token
+	lines    []string
+
+	// last source line printed, used to keep blank lines between statements
+	lastLine int
+}
+
+func (p *printer) write(s string) {
+	p.buf.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.write("\n")
+	p.write(strings.Repeat(indentation, p.indent))
+}
+
+// startLine begins a new output line for something found on line in the
+// source, keeping at most one blank line from the source.
+func (p *printer) startLine(line int) {
+	if p.buf.Len() == 0 {
+		p.lastLine = line
+		return
+	}
+
+	if p.lastLine > 0 && line > p.lastLine+1 {
+		p.write("\n")
+	}
+	p.newline()
+	p.lastLine = line
+}
+
+func (p *printer) statements(stmts []ast.Statement, inBlock bool) {
+	for i, s := range stmts {
+		start := ast.Start(s)
+		p.flushComments(start)
+		p.startLine(start.Line)
+
+		p.statement(s, inBlock && i == len(stmts)-1)
+		if end := endLine(s); end > p.lastLine {
+			p.lastLine = end
+		}
+		p.trailingComment(s)
+	}
+}
+
+// statement prints s followed by a semicolon, except for the final
+// expression of a block whose value is the value of the block.
+func (p *printer) statement(s ast.Statement, last bool) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		if s.Export {
+			p.write("export ")
+		}
+		p.write("let " + s.Name.Value + " = ")
+		p.expression(s.Value, lowest)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(s.ReturnValue, lowest)
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression, lowest)
+		if !last {
+			p.write(";")
+		}
+	}
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	if len(b.Statements) == 0 && !p.hasCommentBefore(b.End) {
+		p.write("{}")
+		return
+	}
+
+	if p.fitsOnOneLine(b) {
+		p.write("{ ")
+		p.statement(b.Statements[0], true)
+		p.write(" }")
+		return
+	}
+
+	p.write("{")
+	p.lastLine = b.Token.Line
+	p.indent++
+	p.statements(b.Statements, true)
+	p.flushComments(b.End)
+	p.indent--
+	p.newline()
+	p.write("}")
+	p.lastLine = b.End.Line
+}
+
+// fitsOnOneLine reports whether b was a single expression written on one
+// line in the source, like the body of fn(x) { x * 2 }.
+func (p *printer) fitsOnOneLine(b *ast.BlockStatement) bool {
+	if len(b.Statements) != 1 || b.Token.Line == 0 || b.Token.Line != b.End.Line {
+		return false
+	}
+
+	s, ok := b.Statements[0].(*ast.ExpressionStatement)
+	if !ok || p.hasCommentBefore(b.End) {
+		return false
+	}
+
+	return !strings.Contains(Node(s.Expression), "\n")
+}
+
+func (p *printer) expression(e ast.Expression, precedence int) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.write(e.Value)
+	case *ast.IntegerLiteral:
+		p.write(fmt.Sprintf("%d", e.Value))
+	case *ast.Boolean:
+		p.write(fmt.Sprintf("%t", e.Value))
+	case *ast.StringLiteral:
+		p.write(`"` + e.Value + `"`)
+	case *ast.ImportExpression:
+		p.write(`import "` + e.Path.Value + `"`)
+	case *ast.PrefixExpression:
+		p.parenthesize(precedence > prefix, func() {
+			p.write(e.Operator)
+			// -(-x) reads better than --x
+			if _, ok := e.Right.(*ast.PrefixExpression); ok {
+				p.expression(e.Right, prefix+1)
+			} else {
+				p.expression(e.Right, prefix)
+			}
+		})
+	case *ast.InfixExpression:
+		prec := precedences[e.Operator]
+		p.parenthesize(precedence > prec, func() {
+			p.expression(e.Left, prec)
+			p.write(" " + e.Operator + " ")
+			// operators are left associative, so a right operand of equal
+			// precedence needs parentheses
+			p.expression(e.Right, prec+1)
+		})
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(e.Condition, lowest)
+		p.write(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.write("fn")
+		p.parameters(e.Parameters)
+		p.write(" ")
+		p.block(e.Body)
+	case *ast.MacroLiteral:
+		p.write("macro")
+		p.parameters(e.Parameters)
+		p.write(" ")
+		p.block(e.Body)
+	case *ast.CallExpression:
+		p.expression(e.Function, call)
+		p.write("(")
+		p.expressionList(e.Arguments)
+		p.write(")")
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.expressionList(e.Elements)
+		p.write("]")
+	case *ast.IndexExpression:
+		p.expression(e.Left, index)
+		p.write("[")
+		p.expression(e.Index, lowest)
+		p.write("]")
+	case *ast.HashLiteral:
+		p.write("{")
+		for i, k := range e.OrderedKeys() {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(k, lowest)
+			p.write(": ")
+			p.expression(e.Pairs[k], lowest)
+		}
+		p.write("}")
+	}
+}
+
+func (p *printer) parenthesize(paren bool, f func()) {
+	if paren {
+		p.write("(")
+	}
+	f()
+	if paren {
+		p.write(")")
+	}
+}
+
+func (p *printer) parameters(params []*ast.Identifier) {
+	names := make([]string, 0, len(params))
+	for _, param := range params {
+		names = append(names, param.Value)
+	}
+
+	p.write("(" + strings.Join(names, ", ") + ")")
+}
+
+func (p *printer) expressionList(exps []ast.Expression) {
+	for i, exp := range exps {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(exp, lowest)
+	}
+}
+
+func (p *printer) hasCommentBefore(tok token.Token) bool {
+	return len(p.comments) > 0 && before(p.comments[0], tok)
+}
+
+// flushComments prints every pending comment positioned before tok on its
+// own line.
+func (p *printer) flushComments(tok token.Token) {
+	for p.hasCommentBefore(tok) {
+		p.startLine(p.comments[0].Line)
+		p.write(p.comments[0].Literal)
+		p.comments = p.comments[1:]
+	}
+}
+
+// trailingComment prints a comment that follows s on its last line.
+func (p *printer) trailingComment(s ast.Statement) {
+	if len(p.comments) == 0 {
+		return
+	}
+
+	c := p.comments[0]
+	if c.Line != endLine(s) || !p.followsCode(c) {
+		return
+	}
+
+	p.write(" " + c.Literal)
+	p.comments = p.comments[1:]
+}
+
+// followsCode reports whether the comment c shares its line with code.
+func (p *printer) followsCode(c token.Token) bool {
+	if c.Line < 1 || c.Line > len(p.lines) {
+		return false
+	}
+
+	line := p.lines[c.Line-1]
+	return strings.TrimSpace(line[:c.Column-1]) != ""
+}
+
+func before(a, b token.Token) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// endLine returns the last source line spanned by node.
+func endLine(node ast.Node) int {
+	line := 0
+	ast.Inspect(node, func(n ast.Node) bool {
+		var tok token.Token
+		switch n := n.(type) {
+		case *ast.BlockStatement:
+			tok = n.End
+		case *ast.Identifier:
+			tok = n.Token
+		case *ast.IntegerLiteral:
+			tok = n.Token
+		case *ast.StringLiteral:
+			tok = n.Token
+		case *ast.Boolean:
+			tok = n.Token
+		}
+
+		if tok.Line > line {
+			line = tok.Line
+		}
+		return true
+	})
+
+	return line
+}
@@ -0,0 +1,196 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/parser"
+)
+
+// inputs from parser_test.go
+var corpus = []string{
+	"let x = 5;",
+	"let y = 10;",
+	"let foobar = y;",
+	"return 5;",
+	"return 993322;",
+	"foobar;",
+	"5;",
+	"!5;",
+	"-15;",
+	"!true;",
+	"!false;",
+	"5 + 5;",
+	"5 - 5;",
+	"5 * 5;",
+	"5 / 5;",
+	"5 > 5;",
+	"5 < 5;",
+	"5 == 5;",
+	"5 != 5;",
+	"true == true",
+	"true != false",
+	"false == false",
+	"-a * b",
+	"!-a",
+	"a + b + c",
+	"a + b - c",
+	"a * b * c",
+	"a * b / c",
+	"a + b / c",
+	"a + b * c + d / e - f",
+	"3 + 4; -5 * 5",
+	"5 > 4 == 3 < 4",
+	"3 + 4 * 5 == 3 * 1 + 4 * 5",
+	"true",
+	"false",
+	"3 > 5 == false",
+	"3 < 5 == true",
+	"1 + (2 + 3) + 4",
+	"(5 + 5) * 2",
+	" 2 / (5 + 5)",
+	"-(5 + 5)",
+	"!(true == true)",
+	"a + add(b * c) + d",
+	"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+	"add(a + b + c * d / f + g)",
+	"a * [1, 2, 3, 4][b * c] * d",
+	"add(a * b[2], b[1], 2 * [1, 2][1])",
+	"if (x < y) { x }",
+	"if (x < y) { x } else { y }",
+	"fn(x, y) { x + y; }",
+	"fn() {};",
+	"fn(x) {};",
+	"fn(x, y, z) {};",
+	"add(1, 2 * 3, 4 + 5);",
+	"add();",
+	`"hello world";`,
+	"[1, 2 * 2, 3 + 3]",
+	"myArray[1 + 1]",
+	`{"one": 1, "two": 2, "three": 3}`,
+	`{"one": 1 + 0, "two": 10 - 8, "three": 15 / 5}`,
+	"{1: 1, 2: 2, 3: 3}",
+	"{true: true, false: false}",
+	"{}",
+	"macro(x, y) { x + y; }",
+	"let myFunction = fn() { };",
+	"a - (b - c)",
+	"-(-a)",
+	"(fn(x) { x })(5)",
+	"(a + b)[0]",
+	"(a + b)(c)",
+	`let fibonacci = fn(x) {
+		if (x == 0) {
+			0
+		} else {
+			if (x == 1) {
+				return 1;
+			} else {
+				fibonacci(x - 1) + fibonacci(x - 2);
+			}
+		}
+	};
+	fibonacci(35);`,
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, input := range corpus {
+		want := parse(t, input).String()
+
+		formatted, err := Source(input)
+		if err != nil {
+			t.Fatalf("Source(%q) failed: %s", input, err)
+		}
+
+		got := parse(t, formatted).String()
+		if got != want {
+			t.Errorf("round trip of %q changed program.\nformatted:\n%s\nwant=%q\ngot=%q", input, formatted, want, got)
+		}
+
+		again, err := Source(formatted)
+		if err != nil {
+			t.Fatalf("Source(%q) failed: %s", formatted, err)
+		}
+
+		if again != formatted {
+			t.Errorf("formatting is not idempotent.\nfirst:\n%s\nsecond:\n%s", formatted, again)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5", "let x = 5;\n"},
+		{"((a + b) * c)", "(a + b) * c;\n"},
+		{"a + (b * c)", "a + b * c;\n"},
+		{"let add = fn(a,b){a+b};add(1,2)", "let add = fn(a, b) { a + b };\nadd(1, 2);\n"},
+		{
+			"let f = fn(x) {\nlet y = x * 2;\ny }",
+			"let f = fn(x) {\n    let y = x * 2;\n    y\n};\n",
+		},
+		{
+			"if (a) { 1 }\nelse { 2 }",
+			"if (a) { 1 } else { 2 };\n",
+		},
+		{
+			"let a = 1;\n\n\n\nlet b = 2;",
+			"let a = 1;\n\nlet b = 2;\n",
+		},
+		{
+			`{"b":1,"a":2}`,
+			"{\"b\": 1, \"a\": 2};\n",
+		},
+		{
+			"// header\nlet a = 1; // one\n\n// before b\nlet b = fn() {\n// inside\nreturn a;\n// end\n};\n// footer",
+			"// header\nlet a = 1; // one\n\n// before b\nlet b = fn() {\n    // inside\n    return a;\n    // end\n};\n// footer\n",
+		},
+		{
+			"let m=import \"lib/math\"\nexport let sq=fn(x){m[\"mul\"](x,x)}",
+			"let m = import \"lib/math\";\nexport let sq = fn(x) { m[\"mul\"](x, x) };\n",
+		},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		actual, err := Source(tt.input)
+		if err != nil {
+			t.Fatalf("Source(%q) failed: %s", tt.input, err)
+		}
+
+		if actual != tt.expected {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestSourceParserErrors(t *testing.T) {
+	_, err := Source("let = 5;")
+	if err == nil {
+		t.Fatalf("expected error for invalid input")
+	}
+}
+
+func TestNode(t *testing.T) {
+	program := parse(t, "let f = fn(x) { x * (2 + 3) };")
+	expected := "let f = fn(x) { x * (2 + 3) };\n"
+
+	if actual := Node(program); actual != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, actual)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	return program
+}
@@ -0,0 +1,44 @@
+// Package framing reads and writes the messages of the Language Server and
+// Debug Adapter protocols, each a body preceded by a Content-Length header.
+package framing
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// MaxLength is the longest body Read accepts, which keeps a bad header from
+// allocating without bound.
+const MaxLength = 1 << 26
+
+// Read reads the body of one message. It returns io.EOF if r ends before
+// the header.
+func Read(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+	if length < 0 || length > MaxLength {
+		return nil, fmt.Errorf("invalid Content-Length: %d, want 0 to %d", length, MaxLength)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Write writes body as one message.
+func Write(w io.Writer, body []byte) error {
+	_, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
@@ -0,0 +1,52 @@
+package framing
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"Content-Length: 2\r\n\r\n{}", "{}", ""},
+		{"Content-Type: application/json\r\nContent-Length: 0\r\n\r\n", "", ""},
+		{"Content-Length: x\r\n\r\n", "", `invalid Content-Length: "x"`},
+		{"\r\n", "", `invalid Content-Length: ""`},
+		{"Content-Length: -1\r\n\r\n", "", "invalid Content-Length: -1, want 0 to 67108864"},
+		{"Content-Length: 67108865\r\n\r\n", "", "invalid Content-Length: 67108865, want 0 to 67108864"},
+		{"Content-Length: 5\r\n\r\n{}", "", "unexpected EOF"},
+		{"", "", "EOF"},
+	}
+
+	for _, tt := range tests {
+		body, err := Read(bufio.NewReader(strings.NewReader(tt.input)))
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		if actual != tt.err || string(body) != tt.expected {
+			t.Errorf("Read(%q) wrong. want=%q, %q, got=%q, %q", tt.input, tt.expected, tt.err, body, actual)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var b strings.Builder
+	if err := Write(&b, []byte(`{"a":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(strings.NewReader(b.String() + b.String()))
+	for i := 0; i < 2; i++ {
+		if body, err := Read(r); err != nil || string(body) != `{"a":1}` {
+			t.Errorf("message %d wrong. got=%q, %v", i, body, err)
+		}
+	}
+	if _, err := Read(r); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
@@ -9,15 +9,32 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+
+	// position of ch in the input, both 1-based
+	line   int
+	column int
+
+	comments []token.Token
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
+// Comments returns the comments skipped by NextToken so far.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -68,6 +85,20 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+func (l *Lexer) skipWhitespaceAndComments() {
+	l.skipWhitespace()
+	for l.ch == '/' && l.peekChar() == '/' {
+		tok := token.Token{Type: token.COMMENT, Line: l.line, Column: l.column}
+		position := l.position
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		tok.Literal = l.input[position:l.position]
+		l.comments = append(l.comments, tok)
+		l.skipWhitespace()
+	}
+}
+
 func (l *Lexer) peekChar() byte {
 	if l.readPosition >= len(l.input) {
 		return 0
@@ -77,8 +108,17 @@ func (l *Lexer) peekChar() byte {
 }
 
 func (l *Lexer) NextToken() token.Token {
+	l.skipWhitespaceAndComments()
+	line, column := l.line, l.column
+
+	tok := l.nextToken()
+	tok.Line = line
+	tok.Column = column
+	return tok
+}
+
+func (l *Lexer) nextToken() token.Token {
 	var tok token.Token
-	l.skipWhitespace()
 
 	switch l.ch {
 	case '=':
@@ -152,3 +152,82 @@ func TestNextToken(t *testing.T) {
 
 	}
 }
+
+func TestPositionsAndComments(t *testing.T) {
+	input := `// add two numbers
+let add = fn(x, y) {
+  x + y; // sum
+};`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 2, 1},
+		{token.IDENT, 2, 5},
+		{token.ASSIGN, 2, 9},
+		{token.FUNCTION, 2, 11},
+		{token.LPAREN, 2, 13},
+		{token.IDENT, 2, 14},
+		{token.COMMA, 2, 15},
+		{token.IDENT, 2, 17},
+		{token.RPAREN, 2, 18},
+		{token.LBRACE, 2, 20},
+		{token.IDENT, 3, 3},
+		{token.PLUS, 3, 5},
+		{token.IDENT, 3, 7},
+		{token.SEMICOLON, 3, 8},
+		{token.RBRACE, 4, 1},
+		{token.SEMICOLON, 4, 2},
+		{token.EOF, 4, 3},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d", i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+
+	comments := l.Comments()
+	if len(comments) != 2 {
+		t.Fatalf("wrong number of comments. expected=2, got=%d", len(comments))
+	}
+
+	if comments[0].Literal != "// add two numbers" || comments[0].Line != 1 {
+		t.Errorf("comments[0] wrong, got=%+v", comments[0])
+	}
+
+	if comments[1].Literal != "// sum" || comments[1].Line != 3 || comments[1].Column != 10 {
+		t.Errorf("comments[1] wrong, got=%+v", comments[1])
+	}
+}
+
+func FuzzNextToken(f *testing.F) {
+	for _, seed := range []string{
+		"let five = 5;",
+		`"foo bar" "unterminated`,
+		"[1, 2]; {\"a\": 1} // comment",
+		"!-/*5; 10 == 10; 9 != 8 <= >=",
+		"héllo\x00\xff",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+		// every token but EOF takes at least one byte of input
+		for i := 0; i <= len(input); i++ {
+			if l.NextToken().Type == token.EOF {
+				return
+			}
+		}
+		t.Fatalf("no EOF after %d tokens", len(input)+1)
+	})
+}
@@ -0,0 +1,191 @@
+package lint
+
+import (
+	"strings"
+
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/object"
+)
+
+var UnusedCheck = &Check{
+	Name: "unused",
+	Doc: "reports local let bindings and parameters that are never used. " +
+		"Globals are skipped since the REPL or other programs may use them, " +
+		"as are names starting with an underscore.",
+	Run: func(pass *Pass) {
+		for _, obj := range pass.Objects {
+			if obj.Uses > 0 || obj.Global || strings.HasPrefix(obj.Name, "_") {
+				continue
+			}
+			pass.Reportf(obj.Decl.Token, "%s %s is never used", obj.Kind, obj.Name)
+		}
+	},
+}
+
+var ShadowCheck = &Check{
+	Name: "shadow",
+	Doc: "reports definitions that hide a name from an enclosing scope or a builtin. " +
+		"Redefining a name in its own scope replaces it and is not reported.",
+	Run: func(pass *Pass) {
+		for _, obj := range pass.Objects {
+			outer, ok := pass.Shadows[obj]
+			if !ok {
+				continue
+			}
+
+			if outer.Kind == BuiltinObj {
+				pass.Reportf(obj.Decl.Token, "%s %s shadows builtin %s", obj.Kind, obj.Name, outer.Name)
+			} else if pass.scopes[obj] != pass.scopes[outer] {
+				decl := outer.Decl.Token
+				pass.Reportf(obj.Decl.Token, "%s %s shadows %s declared at %d:%d",
+					obj.Kind, obj.Name, outer.Kind, decl.Line, decl.Column)
+			}
+		}
+	},
+}
+
+var UnreachableCheck = &Check{
+	Name: "unreachable",
+	Doc:  "reports statements following a return statement in the same block.",
+	Run: func(pass *Pass) {
+		check := func(stmts []ast.Statement) {
+			for i, s := range stmts[:max(len(stmts)-1, 0)] {
+				if _, ok := s.(*ast.ReturnStatement); ok {
+					pass.Reportf(ast.Start(stmts[i+1]), "unreachable code")
+					return
+				}
+			}
+		}
+
+		ast.Inspect(pass.Program, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.Program:
+				check(n.Statements)
+			case *ast.BlockStatement:
+				check(n.Statements)
+			}
+			return true
+		})
+	},
+}
+
+var NotCallableCheck = &Check{
+	Name: "notcallable",
+	Doc:  "reports calls of values that are statically known not to be functions.",
+	Run: func(pass *Pass) {
+		ast.Inspect(pass.Program, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpression)
+			if !ok {
+				return true
+			}
+
+			if kind := literalKind(pass.staticValue(call.Function)); kind != "" {
+				pass.Reportf(ast.Start(call.Function), "cannot call non-function %s (%s)", call.Function.String(), kind)
+			}
+			return true
+		})
+	},
+}
+
+var ArgCountCheck = &Check{
+	Name: "argcount",
+	Doc:  "reports calls of known functions and builtins with the wrong number of arguments.",
+	Run: func(pass *Pass) {
+		ast.Inspect(pass.Program, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpression)
+			if !ok {
+				return true
+			}
+
+			var want *object.Arity
+			switch fn := pass.staticValue(call.Function).(type) {
+			case *ast.FunctionLiteral:
+				arity := object.Exactly(len(fn.Parameters))
+				want = &arity
+			case *ast.Identifier:
+				if obj := pass.Uses[fn]; obj != nil && obj.Kind == BuiltinObj {
+					if b, ok := builtins.Lookup(obj.Name); ok {
+						want = &b.Arity
+					}
+				}
+			}
+
+			if want != nil && !want.Accepts(len(call.Arguments)) {
+				pass.Reportf(ast.Start(call.Function), "wrong number of arguments in call to %s: want=%s, got=%d",
+					call.Function.String(), want, len(call.Arguments))
+			}
+			return true
+		})
+	},
+}
+
+var DuplicateKeyCheck = &Check{
+	Name: "dupkey",
+	Doc:  "reports literal keys that appear more than once in a hash literal.",
+	Run: func(pass *Pass) {
+		ast.Inspect(pass.Program, func(n ast.Node) bool {
+			hash, ok := n.(*ast.HashLiteral)
+			if !ok {
+				return true
+			}
+
+			seen := make(map[string]bool)
+			for _, k := range hash.OrderedKeys() {
+				kind := literalKind(k)
+				if kind == "" || kind == "ARRAY" || kind == "HASH" {
+					continue
+				}
+
+				key := kind + ":" + k.String()
+				if seen[key] {
+					pass.Reportf(ast.Start(k), "duplicate key %s in hash literal", literalString(k))
+				}
+				seen[key] = true
+			}
+			return true
+		})
+	},
+}
+
+// staticValue follows identifiers bound by let statements to the
+// expression they were bound to. Builtins resolve to their identifier.
+func (p *Pass) staticValue(exp ast.Expression) ast.Expression {
+	for i := 0; i < len(p.Objects); i++ {
+		ident, ok := exp.(*ast.Identifier)
+		if !ok {
+			return exp
+		}
+
+		obj := p.Uses[ident]
+		if obj == nil || obj.Kind != VarObj || obj.Value == nil {
+			return exp
+		}
+		exp = obj.Value
+	}
+
+	return exp
+}
+
+func literalKind(exp ast.Expression) string {
+	switch exp.(type) {
+	case *ast.IntegerLiteral:
+		return "INTEGER"
+	case *ast.StringLiteral:
+		return "STRING"
+	case *ast.Boolean:
+		return "BOOLEAN"
+	case *ast.ArrayLiteral:
+		return "ARRAY"
+	case *ast.HashLiteral:
+		return "HASH"
+	}
+
+	return ""
+}
+
+func literalString(exp ast.Expression) string {
+	if s, ok := exp.(*ast.StringLiteral); ok {
+		return `"` + s.Value + `"`
+	}
+	return exp.String()
+}
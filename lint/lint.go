@@ -0,0 +1,90 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/parser"
+	"github.com/tneuqole/monkey-go/token"
+)
+
+type Diagnostic struct {
+	Line    int
+	Column  int
+	Check   string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", d.Line, d.Column, d.Message, d.Check)
+}
+
+// Check is a single analysis run over a resolved program.
+type Check struct {
+	Name string
+	Doc  string
+	Run  func(pass *Pass)
+}
+
+// Checks holds every check run by Source.
+var Checks = []*Check{
+	UnusedCheck,
+	ShadowCheck,
+	UnreachableCheck,
+	NotCallableCheck,
+	ArgCountCheck,
+	DuplicateKeyCheck,
+}
+
+// Pass gives a check access to the program and the result of name
+// resolution, and collects its diagnostics.
+type Pass struct {
+	Program *ast.Program
+	*Info
+
+	check       *Check
+	diagnostics []Diagnostic
+}
+
+func (p *Pass) Reportf(tok token.Token, format string, a ...interface{}) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Check:   p.check.Name,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// Run runs checks over program and returns their diagnostics sorted by
+// position.
+func Run(program *ast.Program, checks []*Check) []Diagnostic {
+	pass := &Pass{Program: program, Info: Resolve(program)}
+	for _, c := range checks {
+		pass.check = c
+		c.Run(pass)
+	}
+
+	diagnostics := pass.diagnostics
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Line != diagnostics[j].Line {
+			return diagnostics[i].Line < diagnostics[j].Line
+		}
+		return diagnostics[i].Column < diagnostics[j].Column
+	})
+
+	return diagnostics
+}
+
+// Source parses src and runs every check over it.
+func Source(src string) ([]Diagnostic, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	return Run(program, Checks), nil
+}
@@ -0,0 +1,100 @@
+package lint
+
+import (
+	"testing"
+)
+
+func TestChecks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			`let add = fn(a, b) { a + b }; add(1, 2);`,
+			[]string{},
+		},
+		{
+			`let f = fn(a, b) { let c = 1; a };`,
+			[]string{
+				"1:15: parameter b is never used (unused)",
+				"1:24: variable c is never used (unused)",
+			},
+		},
+		{
+			`let f = fn(_a) { 1 }; let g = 2;`,
+			[]string{},
+		},
+		{
+			`let x = 1; let f = fn(x) { x }; let g = fn() { let len = 1; len };`,
+			[]string{
+				"1:23: parameter x shadows variable declared at 1:5 (shadow)",
+				"1:52: variable len shadows builtin len (shadow)",
+			},
+		},
+		{
+			`let x = 1; let x = 2; x;`,
+			[]string{},
+		},
+		{
+			"let f = fn() {\n  return 1;\n  2;\n};\nreturn 3;\nf();",
+			[]string{
+				"3:3: unreachable code (unreachable)",
+				"6:1: unreachable code (unreachable)",
+			},
+		},
+		{
+			`5(); let s = "a"; s(1); [1][0]();`,
+			[]string{
+				"1:1: cannot call non-function 5 (INTEGER) (notcallable)",
+				"1:19: cannot call non-function s (STRING) (notcallable)",
+			},
+		},
+		{
+			`let f = fn(a) { a }; f(); f(1, 2); len(1, 2); push([]); puts(1, 2, 3); let l = len; l();`,
+			[]string{
+				"1:22: wrong number of arguments in call to f: want=1, got=0 (argcount)",
+				"1:27: wrong number of arguments in call to f: want=1, got=2 (argcount)",
+				"1:36: wrong number of arguments in call to len: want=1, got=2 (argcount)",
+				"1:47: wrong number of arguments in call to push: want=2, got=1 (argcount)",
+				"1:85: wrong number of arguments in call to l: want=1, got=0 (argcount)",
+			},
+		},
+		{
+			`{"a": 1, "b": 2, "a": 3, 1: 1, true: 1, 1: 2, "1": 3}`,
+			[]string{
+				`1:18: duplicate key "a" in hash literal (dupkey)`,
+				"1:41: duplicate key 1 in hash literal (dupkey)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		diagnostics, err := Source(tt.input)
+		if err != nil {
+			t.Fatalf("Source(%q) failed: %s", tt.input, err)
+		}
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. want=%d, got=%d %v",
+				tt.input, len(tt.expected), len(diagnostics), diagnostics)
+			continue
+		}
+
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("wrong diagnostic for %q. want=%q, got=%q", tt.input, tt.expected[i], d.String())
+			}
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	diagnostics, err := Source(`let counter = fn(x) { let inner = fn() { x }; inner() };`)
+	if err != nil {
+		t.Fatalf("Source failed: %s", err)
+	}
+
+	if len(diagnostics) != 0 {
+		t.Errorf("free variables should count as used, got %v", diagnostics)
+	}
+}
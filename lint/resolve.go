@@ -0,0 +1,144 @@
+package lint
+
+import (
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/object"
+)
+
+// builtins are the builtins programs are checked against.
+var builtins = object.NewStandardRegistry()
+
+type ObjectKind string
+
+const (
+	VarObj     ObjectKind = "variable"
+	ParamObj   ObjectKind = "parameter"
+	BuiltinObj ObjectKind = "builtin"
+)
+
+// Object is a named entity introduced by a let statement, a parameter or
+// the builtins.
+type Object struct {
+	Name   string
+	Kind   ObjectKind
+	Decl   *ast.Identifier // nil for builtins
+	Value  ast.Expression  // the bound value of a let statement
+	Global bool
+	Uses   int
+}
+
+// Info is the result of resolving every identifier in a program.
+type Info struct {
+	Defs    map[*ast.Identifier]*Object
+	Uses    map[*ast.Identifier]*Object
+	Objects []*Object // in definition order
+
+	// Shadows maps a definition to the outer object it hides.
+	Shadows map[*Object]*Object
+
+	scopes map[*Object]*scope
+}
+
+// scope follows the compiler's symbol tables: only functions and macros
+// open a scope, blocks of if expressions do not.
+type scope struct {
+	objects map[string]*Object
+	outer   *scope
+}
+
+func (s *scope) lookup(name string) *Object {
+	for ; s != nil; s = s.outer {
+		if obj, ok := s.objects[name]; ok {
+			return obj
+		}
+	}
+	return nil
+}
+
+type resolver struct {
+	info  *Info
+	scope *scope
+}
+
+// Resolve binds every identifier in program to its definition using the
+// compiler's rules: names are visible from their let statement onward, and
+// a let binding is visible inside its own value.
+func Resolve(program *ast.Program) *Info {
+	r := &resolver{
+		info: &Info{
+			Defs:    make(map[*ast.Identifier]*Object),
+			Uses:    make(map[*ast.Identifier]*Object),
+			Shadows: make(map[*Object]*Object),
+			scopes:  make(map[*Object]*scope),
+		},
+	}
+
+	universe := &scope{objects: make(map[string]*Object)}
+	for _, b := range builtins.All() {
+		universe.objects[b.Name] = &Object{Name: b.Name, Kind: BuiltinObj}
+	}
+	r.scope = &scope{objects: make(map[string]*Object), outer: universe}
+
+	for _, s := range program.Statements {
+		r.node(s)
+	}
+
+	return r.info
+}
+
+func (r *resolver) define(ident *ast.Identifier, kind ObjectKind, value ast.Expression) {
+	if ident == nil {
+		return
+	}
+
+	obj := &Object{
+		Name:   ident.Value,
+		Kind:   kind,
+		Decl:   ident,
+		Value:  value,
+		Global: r.scope.outer.outer == nil,
+	}
+
+	if outer := r.scope.lookup(ident.Value); outer != nil {
+		r.info.Shadows[obj] = outer
+	}
+
+	r.scope.objects[ident.Value] = obj
+	r.info.scopes[obj] = r.scope
+	r.info.Defs[ident] = obj
+	r.info.Objects = append(r.info.Objects, obj)
+}
+
+func (r *resolver) function(params []*ast.Identifier, body *ast.BlockStatement) {
+	r.scope = &scope{objects: make(map[string]*Object), outer: r.scope}
+	for _, p := range params {
+		r.define(p, ParamObj, nil)
+	}
+	r.node(body)
+	r.scope = r.scope.outer
+}
+
+func (r *resolver) node(node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			r.define(n.Name, VarObj, n.Value)
+			if n.Value != nil {
+				r.node(n.Value)
+			}
+			return false
+		case *ast.FunctionLiteral:
+			r.function(n.Parameters, n.Body)
+			return false
+		case *ast.MacroLiteral:
+			r.function(n.Parameters, n.Body)
+			return false
+		case *ast.Identifier:
+			if obj := r.scope.lookup(n.Value); obj != nil {
+				obj.Uses++
+				r.info.Uses[n] = obj
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,363 @@
+package lsp
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/compiler"
+	"github.com/tneuqole/monkey-go/evaluator"
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/lint"
+	"github.com/tneuqole/monkey-go/object"
+	"github.com/tneuqole/monkey-go/parser"
+)
+
+// pos is a 1-based line and byte column, as found in tokens.
+type pos struct {
+	line   int
+	column int
+}
+
+// document is an open text document and the result of analysing it.
+type document struct {
+	uri   string
+	text  string
+	lines []string
+
+	program     *ast.Program
+	info        *lint.Info
+	symbols     map[pos]compiler.Symbol
+	diagnostics []Diagnostic
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{
+		uri:     uri,
+		text:    text,
+		lines:   strings.Split(text, "\n"),
+		symbols: make(map[pos]compiler.Symbol),
+	}
+	d.analyse()
+	return d
+}
+
+func (d *document) analyse() {
+	defer func() {
+		if r := recover(); r != nil {
+			d.addDiagnostic(1, 1, SeverityError, "monkey", fmt.Sprintf("internal error: %v", r))
+		}
+	}()
+
+	p := parser.New(lexer.New(d.text))
+	d.program = p.ParseProgram()
+	d.info = lint.Resolve(d.program)
+
+	if errs := p.ErrorDetails(); len(errs) != 0 {
+		for _, err := range errs {
+			d.addDiagnostic(err.Line, err.Column, SeverityError, "parser", err.Message)
+		}
+		return
+	}
+
+	// the compiler only sees the program after macro expansion, so it gets a
+	// separate copy of the tree
+	expanded := parser.New(lexer.New(d.text)).ParseProgram()
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(expanded, macroEnv)
+	if _, err := evaluator.ExpandMacros(expanded, macroEnv); err != nil {
+		merr := err.(*evaluator.MacroError)
+		d.addDiagnostic(merr.Line, merr.Column, SeverityError, "macro", merr.Message)
+		return
+	}
+
+	c := compiler.New()
+	c.SetPath(uriPath(d.uri))
+	if err := c.Compile(expanded); err != nil {
+		for _, diag := range err.(compiler.Diagnostics) {
+			if diag.File != "" {
+				// also reported at the import of the module
+				continue
+			}
+			d.addDiagnostic(diag.Line, diag.Column, SeverityError, "compiler", diag.Message)
+		}
+	}
+
+	for ident, symbol := range c.Symbols() {
+		d.symbols[pos{ident.Token.Line, ident.Token.Column}] = symbol
+	}
+
+	for _, diag := range lint.Run(d.program, lint.Checks) {
+		d.addDiagnostic(diag.Line, diag.Column, SeverityWarning, "lint", diag.Message+" ("+diag.Check+")")
+	}
+}
+
+// uriPath returns the file path of a file URI, which imports in the
+// document are relative to.
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func (d *document) addDiagnostic(line, column int, severity DiagnosticSeverity, source, msg string) {
+	start := d.position(line, column)
+	end := d.position(line, d.wordEnd(line, column))
+	if end == start {
+		end.Character++
+	}
+
+	d.diagnostics = append(d.diagnostics, Diagnostic{
+		Range:    Range{Start: start, End: end},
+		Severity: severity,
+		Source:   source,
+		Message:  msg,
+	})
+}
+
+// wordEnd returns the column after the identifier or number starting at
+// column, or column itself if there is none.
+func (d *document) wordEnd(line, column int) int {
+	if line < 1 || line > len(d.lines) {
+		return column
+	}
+
+	text := d.lines[line-1]
+	end := column
+	for end-1 < len(text) && isWordChar(text[end-1]) {
+		end++
+	}
+	return end
+}
+
+func isWordChar(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || '0' <= ch && ch <= '9'
+}
+
+// position converts a 1-based line and byte column to an LSP position,
+// which is 0-based and counts UTF-16 code units.
+func (d *document) position(line, column int) Position {
+	if line < 1 || line > len(d.lines) {
+		return Position{Line: max(line-1, 0)}
+	}
+
+	text := d.lines[line-1]
+	column = min(max(column-1, 0), len(text))
+	return Position{Line: line - 1, Character: len(utf16.Encode([]rune(text[:column])))}
+}
+
+// offset converts an LSP position to a 1-based line and byte column.
+func (d *document) offset(p Position) pos {
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return pos{p.Line + 1, 1}
+	}
+
+	text := d.lines[p.Line]
+	units, i := 0, 0
+	for i < len(text) && units < p.Character {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		units += len(utf16.Encode([]rune{r}))
+		i += size
+	}
+
+	return pos{p.Line + 1, i + 1}
+}
+
+func (d *document) identRange(ident *ast.Identifier) Range {
+	line, column := ident.Token.Line, ident.Token.Column
+	return Range{
+		Start: d.position(line, column),
+		End:   d.position(line, column+len(ident.Value)),
+	}
+}
+
+// identAt returns the identifier under the LSP position p.
+func (d *document) identAt(p Position) *ast.Identifier {
+	at := d.offset(p)
+
+	var found *ast.Identifier
+	ast.Inspect(d.program, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Identifier)
+		if ok && ident.Token.Line == at.line &&
+			ident.Token.Column <= at.column && at.column <= ident.Token.Column+len(ident.Value) {
+			found = ident
+		}
+		return found == nil
+	})
+
+	return found
+}
+
+// object returns the definition ident refers to or defines.
+func (d *document) object(ident *ast.Identifier) *lint.Object {
+	if obj, ok := d.info.Defs[ident]; ok {
+		return obj
+	}
+	return d.info.Uses[ident]
+}
+
+func (d *document) hover(p Position) *Hover {
+	ident := d.identAt(p)
+	if ident == nil {
+		return nil
+	}
+
+	var out strings.Builder
+	out.WriteString("```monkey\n")
+	obj := d.object(ident)
+	switch {
+	case obj == nil:
+		out.WriteString(ident.Value)
+	case obj.Kind == lint.BuiltinObj:
+		out.WriteString("builtin " + obj.Name)
+	case obj.Kind == lint.ParamObj:
+		out.WriteString("parameter " + obj.Name)
+	default:
+		out.WriteString("let " + obj.Name)
+		if fn, ok := obj.Value.(*ast.FunctionLiteral); ok {
+			out.WriteString(" = " + signature(fn))
+		}
+	}
+	out.WriteString("\n```\n")
+
+	if symbol, ok := d.symbols[pos{ident.Token.Line, ident.Token.Column}]; ok {
+		fmt.Fprintf(&out, "%s symbol", symbol.Scope)
+		if symbol.Scope != compiler.FunctionScope {
+			fmt.Fprintf(&out, ", index %d", symbol.Index)
+		}
+	} else {
+		out.WriteString("undefined")
+	}
+
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: out.String()},
+		Range:    d.identRange(ident),
+	}
+}
+
+func signature(fn *ast.FunctionLiteral) string {
+	params := make([]string, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		params[i] = p.Value
+	}
+	return "fn(" + strings.Join(params, ", ") + ")"
+}
+
+func (d *document) definition(p Position) *Location {
+	ident := d.identAt(p)
+	if ident == nil {
+		return nil
+	}
+
+	obj := d.object(ident)
+	if obj == nil || obj.Decl == nil {
+		return nil
+	}
+
+	return &Location{URI: d.uri, Range: d.identRange(obj.Decl)}
+}
+
+func (d *document) references(p Position, includeDeclaration bool) []Location {
+	locations := []Location{}
+
+	ident := d.identAt(p)
+	if ident == nil {
+		return locations
+	}
+
+	obj := d.object(ident)
+	if obj == nil {
+		return locations
+	}
+
+	ast.Inspect(d.program, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Identifier); ok {
+			isDecl := id == obj.Decl
+			if d.info.Uses[id] == obj || isDecl && includeDeclaration {
+				locations = append(locations, Location{URI: d.uri, Range: d.identRange(id)})
+			}
+		}
+		return true
+	})
+
+	return locations
+}
+
+// documentSymbols returns the let-bound functions, nested by scope.
+func (d *document) documentSymbols() []DocumentSymbol {
+	return d.functionSymbols(d.program)
+}
+
+func (d *document) functionSymbols(node ast.Node) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == node {
+			return true
+		}
+
+		let, ok := n.(*ast.LetStatement)
+		if !ok {
+			return true
+		}
+
+		fn, ok := let.Value.(*ast.FunctionLiteral)
+		if !ok || fn.Body == nil {
+			return true
+		}
+
+		symbols = append(symbols, DocumentSymbol{
+			Name:   let.Name.Value,
+			Detail: signature(fn),
+			Kind:   SymbolKindFunction,
+			Range: Range{
+				Start: d.position(let.Token.Line, let.Token.Column),
+				End:   d.position(fn.Body.End.Line, fn.Body.End.Column+1),
+			},
+			SelectionRange: d.identRange(let.Name),
+			Children:       d.functionSymbols(fn.Body),
+		})
+		return false
+	})
+
+	return symbols
+}
+
+func (d *document) completions() []CompletionItem {
+	items := []CompletionItem{}
+	for _, b := range object.NewStandardRegistry().All() {
+		items = append(items, CompletionItem{Label: b.Name, Kind: CompletionItemKindFunction, Detail: "builtin"})
+	}
+
+	seen := make(map[string]bool)
+	for _, obj := range d.info.Objects {
+		if !obj.Global || seen[obj.Name] {
+			continue
+		}
+		seen[obj.Name] = true
+
+		item := CompletionItem{Label: obj.Name, Kind: CompletionItemKindVariable}
+		if fn, ok := obj.Value.(*ast.FunctionLiteral); ok {
+			item.Kind = CompletionItemKindFunction
+			item.Detail = signature(fn)
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// fullRange covers the whole document.
+func (d *document) fullRange() Range {
+	last := len(d.lines)
+	return Range{
+		Start: Position{},
+		End:   d.position(last, len(d.lines[last-1])+1),
+	}
+}
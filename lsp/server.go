@@ -0,0 +1,313 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/tneuqole/monkey-go/format"
+)
+
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":                  (*Server).initialize,
+	"shutdown":                    (*Server).shutdown,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/references":     (*Server).references,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/completion":     (*Server).completion,
+	"textDocument/formatting":     (*Server).formatting,
+}
+
+var notificationHandlers = map[string]func(s *Server, params json.RawMessage) error{
+	"initialized":            func(*Server, json.RawMessage) error { return nil },
+	"textDocument/didOpen":   (*Server).didOpen,
+	"textDocument/didChange": (*Server).didChange,
+	"textDocument/didClose":  (*Server).didClose,
+}
+
+// Server is a Language Server Protocol server for Monkey speaking JSON-RPC
+// over a pair of streams, usually stdin and stdout.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	writeMu    sync.Mutex
+	docs       map[string]*document
+	isShutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*document),
+	}
+}
+
+// Serve handles messages until the client sends exit or closes the input.
+func (s *Server) Serve() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		var rerr *responseError
+		if errors.As(err, &rerr) {
+			// the id of a request that cannot be parsed is unknown
+			id := json.RawMessage("null")
+			if err := s.reply(&id, &message{Error: rerr}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		if msg.ID == nil {
+			if h, ok := notificationHandlers[msg.Method]; ok {
+				if err := h(s, msg.Params); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := s.reply(msg.ID, s.call(msg)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) call(msg *message) *message {
+	resp := &message{}
+
+	h, ok := handlers[msg.Method]
+	if !ok {
+		resp.Error = &responseError{Code: methodNotFound, Message: "method not found: " + msg.Method}
+		return resp
+	}
+
+	if s.isShutdown {
+		resp.Error = &responseError{Code: invalidRequest, Message: "server is shut down"}
+		return resp
+	}
+
+	result, err := h(s, msg.Params)
+	if err != nil {
+		var rerr *responseError
+		if !errors.As(err, &rerr) {
+			rerr = &responseError{Code: internalError, Message: err.Error()}
+		}
+		resp.Error = rerr
+		return resp
+	}
+
+	resp.Result, err = json.Marshal(result)
+	if err != nil {
+		resp.Error = &responseError{Code: internalError, Message: err.Error()}
+	}
+	return resp
+}
+
+func (s *Server) reply(id *json.RawMessage, resp *message) error {
+	resp.ID = id
+	return s.send(resp)
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.send(&message{Method: method, Params: raw})
+}
+
+func (s *Server) send(msg *message) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return writeMessage(s.out, msg)
+}
+
+func unmarshalParams(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: invalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) document(uri string) (*document, error) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{Code: invalidParams, Message: "unknown document: " + uri}
+	}
+	return doc, nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	result := InitializeResult{}
+	result.ServerInfo.Name = "monkey-lsp"
+	result.Capabilities = ServerCapabilities{
+		TextDocumentSync:           1, // full document on every change
+		HoverProvider:              true,
+		DefinitionProvider:         true,
+		ReferencesProvider:         true,
+		DocumentSymbolProvider:     true,
+		DocumentFormattingProvider: true,
+	}
+	result.Capabilities.CompletionProvider.TriggerCharacters = []string{}
+
+	return result, nil
+}
+
+func (s *Server) shutdown(params json.RawMessage) (interface{}, error) {
+	s.isShutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) error {
+	var p DidOpenTextDocumentParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil
+	}
+
+	return s.update(p.TextDocument.URI, p.TextDocument.Text)
+}
+
+func (s *Server) didChange(params json.RawMessage) error {
+	var p DidChangeTextDocumentParams
+	if err := unmarshalParams(params, &p); err != nil || len(p.ContentChanges) == 0 {
+		return nil
+	}
+
+	// full sync sends the whole document as the last change
+	text := p.ContentChanges[len(p.ContentChanges)-1].Text
+	return s.update(p.TextDocument.URI, text)
+}
+
+func (s *Server) didClose(params json.RawMessage) error {
+	var p DidCloseTextDocumentParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil
+	}
+
+	delete(s.docs, p.TextDocument.URI)
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []Diagnostic{},
+	})
+}
+
+func (s *Server) update(uri, text string) error {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+
+	diagnostics := doc.diagnostics
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.hover(p.Position), nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.definition(p.Position), nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p ReferenceParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.references(p.Position, p.Context.IncludeDeclaration), nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p DocumentSymbolParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.documentSymbols(), nil
+}
+
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.completions(), nil
+}
+
+func (s *Server) formatting(params json.RawMessage) (interface{}, error) {
+	var p DocumentFormattingParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	formatted, err := format.Source(doc.text)
+	if err != nil || formatted == doc.text {
+		// documents that do not parse are left alone
+		return []TextEdit{}, nil
+	}
+
+	return []TextEdit{{Range: doc.fullRange(), NewText: formatted}}, nil
+}
@@ -0,0 +1,395 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"testing"
+)
+
+const testURI = "file:///test.mk"
+
+const testSource = `let add = fn(a, b) { a + b };
+let counter = fn(x) {
+  let inc = fn() { x + 1 };
+  inc()
+};
+add(1, counter(2));
+len("four");
+`
+
+// client drives a Server over in-memory pipes the way an editor would.
+type client struct {
+	t      *testing.T
+	w      io.WriteCloser
+	r      *bufio.Reader
+	nextID int
+	done   chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{t: t, w: clientOut, r: bufio.NewReader(clientIn), done: make(chan error, 1)}
+	go func() {
+		err := NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+		c.done <- err
+	}()
+
+	return c
+}
+
+func (c *client) send(msg *message) {
+	c.t.Helper()
+	if err := writeMessage(c.w, msg); err != nil {
+		c.t.Fatalf("write failed: %s", err)
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	raw, _ := json.Marshal(params)
+	c.send(&message{Method: method, Params: raw})
+}
+
+// call sends a request and decodes the result of its response into result.
+func (c *client) call(method string, params, result interface{}) *responseError {
+	c.t.Helper()
+
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	raw, _ := json.Marshal(params)
+	c.send(&message{ID: &id, Method: method, Params: raw})
+
+	resp := c.read()
+	if resp.ID == nil || string(*resp.ID) != string(id) {
+		c.t.Fatalf("expected response to %s, got %+v", method, resp)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			c.t.Fatalf("decoding %s result failed: %s", method, err)
+		}
+	}
+	return nil
+}
+
+func (c *client) read() *message {
+	c.t.Helper()
+	msg, err := readMessage(c.r)
+	if err != nil {
+		c.t.Fatalf("read failed: %s", err)
+	}
+	return msg
+}
+
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	c.t.Helper()
+
+	msg := c.read()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %+v", msg)
+	}
+
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatalf("decoding diagnostics failed: %s", err)
+	}
+	return params
+}
+
+func (c *client) open(text string) PublishDiagnosticsParams {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "monkey", Version: 1, Text: text},
+	})
+	return c.diagnostics()
+}
+
+func (c *client) close() {
+	c.t.Helper()
+	if err := c.call("shutdown", nil, nil); err != nil {
+		c.t.Fatalf("shutdown failed: %s", err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		c.t.Fatalf("server failed: %s", err)
+	}
+}
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	c := newClient(t)
+
+	var result InitializeResult
+	if err := c.call("initialize", map[string]interface{}{}, &result); err != nil {
+		t.Fatalf("initialize failed: %s", err)
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	caps := result.Capabilities
+	if caps.TextDocumentSync != 1 || !caps.HoverProvider || !caps.DefinitionProvider ||
+		!caps.ReferencesProvider || !caps.DocumentSymbolProvider || !caps.DocumentFormattingProvider {
+		t.Errorf("missing capabilities: %+v", caps)
+	}
+
+	if err := c.call("textDocument/unknown", nil, nil); err == nil || err.Code != methodNotFound {
+		t.Errorf("expected method not found, got %v", err)
+	}
+
+	c.close()
+}
+
+func TestParseError(t *testing.T) {
+	c := newClient(t)
+
+	body := `{"jsonrpc": "2.0", "id": 1, "method":`
+	if _, err := io.WriteString(c.w, "Content-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"+body); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+	resp := c.read()
+	// with a null id, which decodes to nil
+	if resp.ID != nil || resp.Error == nil || resp.Error.Code != parseError {
+		t.Fatalf("expected parse error, got %+v", resp)
+	}
+
+	// the server keeps serving
+	if err := c.call("initialize", map[string]interface{}{}, nil); err != nil {
+		t.Fatalf("initialize failed: %s", err)
+	}
+	c.close()
+}
+
+func TestInvalidContentLength(t *testing.T) {
+	tests := []struct {
+		length   string
+		expected string
+	}{
+		{"-1", "invalid Content-Length: -1, want 0 to 67108864"},
+		{"1099511627776", "invalid Content-Length: 1099511627776, want 0 to 67108864"},
+	}
+
+	for _, tt := range tests {
+		c := newClient(t)
+		if _, err := io.WriteString(c.w, "Content-Length: "+tt.length+"\r\n\r\n"); err != nil {
+			t.Fatalf("write failed: %s", err)
+		}
+		// the rest of the stream cannot be framed, so the server stops
+		if err := <-c.done; err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for length %s. want=%q, got=%v", tt.length, tt.expected, err)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+
+	params := c.open("let x = ;\n")
+	if len(params.Diagnostics) != 1 || params.Diagnostics[0].Source != "parser" {
+		t.Fatalf("expected one parser diagnostic, got %+v", params.Diagnostics)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: testURI},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "let x = y + 1;\nz;\n"}},
+	})
+	params = c.diagnostics()
+
+	expected := []Diagnostic{
+		{Range{Position{0, 8}, Position{0, 9}}, SeverityError, "compiler", "undefined variable y"},
+		{Range{Position{1, 0}, Position{1, 1}}, SeverityError, "compiler", "undefined variable z"},
+	}
+	if len(params.Diagnostics) != len(expected) {
+		t.Fatalf("wrong diagnostics. want=%+v, got=%+v", expected, params.Diagnostics)
+	}
+	for i, d := range params.Diagnostics {
+		if d != expected[i] {
+			t.Errorf("wrong diagnostic. want=%+v, got=%+v", expected[i], d)
+		}
+	}
+
+	params = c.open("let m = macro() { 1 };\nm();\n")
+	if len(params.Diagnostics) != 1 || params.Diagnostics[0].Source != "macro" {
+		t.Fatalf("expected one macro diagnostic, got %+v", params.Diagnostics)
+	}
+
+	params = c.open("let f = fn(a) { 1 };\nf(1);\n")
+	if len(params.Diagnostics) != 1 || params.Diagnostics[0].Severity != SeverityWarning {
+		t.Fatalf("expected one lint warning, got %+v", params.Diagnostics)
+	}
+
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: testURI}})
+	if params := c.diagnostics(); len(params.Diagnostics) != 0 {
+		t.Errorf("expected diagnostics to be cleared, got %+v", params.Diagnostics)
+	}
+
+	c.close()
+}
+
+func TestHover(t *testing.T) {
+	c := newClient(t)
+	if params := c.open(testSource); len(params.Diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %+v", params.Diagnostics)
+	}
+
+	tests := []struct {
+		params   TextDocumentPositionParams
+		expected string
+	}{
+		{at(0, 5), "```monkey\nlet add = fn(a, b)\n```\nGLOBAL symbol, index 0"},
+		{at(0, 21), "```monkey\nparameter a\n```\nLOCAL symbol, index 0"},
+		{at(2, 19), "```monkey\nparameter x\n```\nFREE symbol, index 0"},
+		{at(3, 3), "```monkey\nlet inc = fn()\n```\nLOCAL symbol, index 1"},
+		{at(6, 1), "```monkey\nbuiltin len\n```\nBUILTIN symbol, index 0"},
+	}
+
+	for _, tt := range tests {
+		var hover Hover
+		if err := c.call("textDocument/hover", tt.params, &hover); err != nil {
+			t.Fatalf("hover failed: %s", err)
+		}
+
+		if hover.Contents.Value != tt.expected {
+			t.Errorf("wrong hover at %+v. want=%q, got=%q", tt.params.Position, tt.expected, hover.Contents.Value)
+		}
+	}
+
+	var hover *Hover
+	if err := c.call("textDocument/hover", at(5, 5), &hover); err != nil || hover != nil {
+		t.Errorf("expected no hover outside identifiers, got %+v (%v)", hover, err)
+	}
+
+	c.close()
+}
+
+func TestDefinitionAndReferences(t *testing.T) {
+	c := newClient(t)
+	c.open(testSource)
+
+	var loc Location
+	if err := c.call("textDocument/definition", at(2, 19), &loc); err != nil {
+		t.Fatalf("definition failed: %s", err)
+	}
+
+	expected := Range{Position{1, 17}, Position{1, 18}}
+	if loc.URI != testURI || loc.Range != expected {
+		t.Errorf("wrong definition. want=%+v, got=%+v", expected, loc.Range)
+	}
+
+	params := ReferenceParams{TextDocumentPositionParams: at(0, 4)}
+	params.Context.IncludeDeclaration = true
+
+	var refs []Location
+	if err := c.call("textDocument/references", params, &refs); err != nil {
+		t.Fatalf("references failed: %s", err)
+	}
+
+	expectedRefs := []Range{
+		{Position{0, 4}, Position{0, 7}},
+		{Position{5, 0}, Position{5, 3}},
+	}
+	if len(refs) != len(expectedRefs) {
+		t.Fatalf("wrong number of references. want=%d, got=%d", len(expectedRefs), len(refs))
+	}
+	for i, ref := range refs {
+		if ref.Range != expectedRefs[i] {
+			t.Errorf("wrong reference. want=%+v, got=%+v", expectedRefs[i], ref.Range)
+		}
+	}
+
+	c.close()
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c := newClient(t)
+	c.open(testSource)
+
+	var symbols []DocumentSymbol
+	params := DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}}
+	if err := c.call("textDocument/documentSymbol", params, &symbols); err != nil {
+		t.Fatalf("documentSymbol failed: %s", err)
+	}
+
+	if len(symbols) != 2 {
+		t.Fatalf("wrong number of symbols. want=2, got=%+v", symbols)
+	}
+
+	if symbols[0].Name != "add" || symbols[0].Detail != "fn(a, b)" || symbols[0].Kind != SymbolKindFunction {
+		t.Errorf("wrong symbol: %+v", symbols[0])
+	}
+
+	counter := symbols[1]
+	if counter.Name != "counter" || counter.Range.End != (Position{4, 1}) {
+		t.Errorf("wrong symbol: %+v", counter)
+	}
+
+	if len(counter.Children) != 1 || counter.Children[0].Name != "inc" {
+		t.Errorf("wrong children: %+v", counter.Children)
+	}
+
+	c.close()
+}
+
+func TestCompletion(t *testing.T) {
+	c := newClient(t)
+	c.open(testSource)
+
+	var items []CompletionItem
+	if err := c.call("textDocument/completion", at(6, 0), &items); err != nil {
+		t.Fatalf("completion failed: %s", err)
+	}
+
+	labels := map[string]bool{}
+	for _, item := range items {
+		labels[item.Label] = true
+	}
+
+	for _, want := range []string{"len", "puts", "first", "last", "rest", "push", "add", "counter"} {
+		if !labels[want] {
+			t.Errorf("missing completion %q in %+v", want, items)
+		}
+	}
+
+	if labels["inc"] {
+		t.Errorf("local inc should not be completed at top level")
+	}
+
+	c.close()
+}
+
+func TestFormatting(t *testing.T) {
+	c := newClient(t)
+	c.open("let a=1\nlet b=fn(x){x}")
+
+	var edits []TextEdit
+	params := DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: testURI}}
+	if err := c.call("textDocument/formatting", params, &edits); err != nil {
+		t.Fatalf("formatting failed: %s", err)
+	}
+
+	if len(edits) != 1 {
+		t.Fatalf("expected one edit, got %+v", edits)
+	}
+
+	expected := TextEdit{
+		Range:   Range{Position{0, 0}, Position{1, 14}},
+		NewText: "let a = 1;\nlet b = fn(x) { x };\n",
+	}
+	if edits[0] != expected {
+		t.Errorf("wrong edit. want=%+v, got=%+v", expected, edits[0])
+	}
+
+	c.close()
+}
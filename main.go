@@ -5,10 +5,31 @@ import (
 	"os"
 	"os/user"
 
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/parser"
 	"github.com/tneuqole/monkey-go/repl"
 )
 
+var commands = map[string]func(args []string) int{
+	"fmt":  runFmt,
+	"lint": runLint,
+	"lsp":  runLsp,
+	"dap":  runDap,
+	"test": runTest,
+	"run":  runRun,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		cmd, ok := commands[os.Args[1]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+			os.Exit(2)
+		}
+		os.Exit(cmd(os.Args[2:]))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -19,3 +40,9 @@ func main() {
 	repl.Start(os.Stdin, os.Stdout)
 
 }
+
+func parseSource(src string) (*ast.Program, []string) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	return program, p.Errors()
+}
@@ -0,0 +1,138 @@
+package mktest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tneuqole/monkey-go/object"
+)
+
+// Register adds the builtins tests use to r:
+//
+//	assert(cond, message?)         fails unless cond is truthy
+//	assert_eq(got, want, message?) fails unless got equals want
+//	assert_throws(fn, substring?)  fails unless fn() fails, with an error
+//	                               containing substring if given, and
+//	                               returns the error message
+//
+// A failing assertion stops the test with an error describing it.
+func Register(r *object.Registry) error {
+	for _, b := range []struct {
+		name  string
+		arity object.Arity
+		fn    object.HostFunction
+	}{
+		{"assert", object.Between(1, 2), assert},
+		{"assert_eq", object.Between(2, 3), assertEq},
+		{"assert_throws", object.Between(1, 2), assertThrows},
+	} {
+		if err := r.RegisterHost(b.name, b.arity, b.fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func assert(_ object.Host, args ...object.Object) object.Object {
+	if args[0] != object.FALSE && args[0] != object.NULL {
+		return object.NULL
+	}
+	return failure("assertion failed", args[1:])
+}
+
+func assertEq(_ object.Host, args ...object.Object) object.Object {
+	got, want := args[0], args[1]
+	if object.Equal(got, want) {
+		return object.NULL
+	}
+
+	lines := []string{"got:  " + show(got), "want: " + show(want)}
+	lines = append(lines, differences(got, want)...)
+	return failure("assert_eq failed", args[2:], lines...)
+}
+
+func assertThrows(host object.Host, args ...object.Object) object.Object {
+	result := host.Try(args[0])
+	err, ok := result.(*object.Error)
+	if !ok {
+		return &object.Error{Message: "assert_throws failed: no error, returned " + show(result)}
+	}
+
+	if len(args) == 2 {
+		want, ok := args[1].(*object.String)
+		if !ok {
+			return &object.Error{Message: fmt.Sprintf("argument 2 to `assert_throws` must be STRING, got=%s", args[1].Type())}
+		}
+		if !strings.Contains(err.Message, want.Value) {
+			return &object.Error{Message: fmt.Sprintf("assert_throws failed: error %q does not contain %q", err.Message, want.Value)}
+		}
+	}
+	return &object.String{Value: err.Message}
+}
+
+// failure returns the error of a failed assertion, with the optional
+// message the test gave and lines of detail.
+func failure(what string, message []object.Object, lines ...string) *object.Error {
+	if len(message) == 1 {
+		if s, ok := message[0].(*object.String); ok {
+			what += ": " + s.Value
+		} else {
+			what += ": " + message[0].Inspect()
+		}
+	}
+	for _, line := range lines {
+		what += "\n  " + line
+	}
+	return &object.Error{Message: what}
+}
+
+// show returns obj as Inspect does, but with strings quoted so that 1 and
+// "1" can be told apart.
+func show(obj object.Object) string {
+	if s, ok := obj.(*object.String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return obj.Inspect()
+}
+
+// differences lists the elements of two arrays, or the pairs of two hashes,
+// that are not equal.
+func differences(got, want object.Object) []string {
+	var lines []string
+	switch got := got.(type) {
+	case *object.Array:
+		want, ok := want.(*object.Array)
+		if !ok {
+			return nil
+		}
+		if len(got.Elements) != len(want.Elements) {
+			lines = append(lines, fmt.Sprintf("len: got %d, want %d", len(got.Elements), len(want.Elements)))
+		}
+		for i := 0; i < len(got.Elements) && i < len(want.Elements); i++ {
+			if !object.Equal(got.Elements[i], want.Elements[i]) {
+				lines = append(lines, fmt.Sprintf("[%d]: got %s, want %s", i, show(got.Elements[i]), show(want.Elements[i])))
+			}
+		}
+	case *object.Hash:
+		want, ok := want.(*object.Hash)
+		if !ok {
+			return nil
+		}
+		for _, pair := range want.Items() {
+			value, ok := got.Get(pair.Key.(object.Hashable))
+			switch {
+			case !ok:
+				lines = append(lines, fmt.Sprintf("[%s]: missing, want %s", show(pair.Key), show(pair.Value)))
+			case !object.Equal(value, pair.Value):
+				lines = append(lines, fmt.Sprintf("[%s]: got %s, want %s", show(pair.Key), show(value), show(pair.Value)))
+			}
+		}
+		for _, pair := range got.Items() {
+			if _, ok := want.Get(pair.Key.(object.Hashable)); !ok {
+				lines = append(lines, fmt.Sprintf("[%s]: got %s, want none", show(pair.Key), show(pair.Value)))
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,213 @@
+// Package mktest runs tests written in Monkey. A test file is named
+// *_test.mk, and each global function in it whose name starts with test_
+// is a test. A test passes if calling it without arguments does not fail;
+// the builtins added by Register make it fail with a description of what
+// went wrong.
+package mktest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tneuqole/monkey-go/coverage"
+	"github.com/tneuqole/monkey-go/monkey"
+	"github.com/tneuqole/monkey-go/object"
+	"github.com/tneuqole/monkey-go/parser"
+)
+
+// Suffix ends the name of every test file.
+const Suffix = "_test.mk"
+
+// Prefix starts the name of every test function.
+const Prefix = "test_"
+
+// Result is the outcome of one test.
+type Result struct {
+	Name string
+	// Failure describes why the test failed, or is empty if it passed.
+	Failure string
+	// Output is what the test wrote to stdout and stderr.
+	Output   string
+	Duration time.Duration
+}
+
+func (r Result) Passed() bool { return r.Failure == "" }
+
+// File is the outcome of running the tests of one file.
+type File struct {
+	Path string
+	// Err describes why the file could not be compiled or run, in which
+	// case none of its tests ran.
+	Err string
+	// Output is what the file wrote while it was run, before its tests.
+	Output   string
+	Tests    []Result
+	Duration time.Duration
+}
+
+func (f File) Passed() bool {
+	if f.Err != "" {
+		return false
+	}
+	for _, t := range f.Tests {
+		if !t.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Discover returns the test files named by paths. A directory stands for
+// every test file below it, skipping directories named testdata or
+// starting with a dot or underscore as the go tool does; a file is used
+// whatever its name.
+func Discover(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				name := d.Name()
+				if p != path && (name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(p, Suffix) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Options control how RunFile runs tests.
+type Options struct {
+	// Run selects the tests to run by name, or all of them if nil.
+	Run *regexp.Regexp
+	// Coverage, if set, records the lines the file and its tests execute,
+	// except those of test files.
+	Coverage *coverage.Profile
+}
+
+// RunFile runs the file at path and then each of its tests selected by
+// opts, in the order they are defined. The tests share the file's globals.
+func RunFile(ctx context.Context, path string, opts Options) (file File) {
+	start := time.Now()
+	file.Path = path
+	defer func() { file.Duration = time.Since(start) }()
+
+	builtins := object.NewStandardRegistry()
+	Register(builtins)
+	rt := monkey.NewWithBuiltins(builtins)
+	var out bytes.Buffer
+	rt.SetIO(object.NewIO(nil, &out, &out))
+	if opts.Coverage != nil {
+		profile := coverage.NewProfile()
+		rt.SetCoverage(profile)
+		defer func() {
+			for _, f := range profile.Files() {
+				if strings.HasSuffix(f, Suffix) {
+					profile.Delete(f)
+				}
+			}
+			opts.Coverage.Merge(profile)
+		}()
+	}
+
+	program, err := rt.CompileFile(path)
+	if err == nil {
+		_, err = rt.Run(ctx, program)
+	}
+	file.Output = out.String()
+	if err != nil {
+		file.Err = describe(path, err)
+		return file
+	}
+
+	for _, name := range rt.Globals() {
+		if !strings.HasPrefix(name, Prefix) || (opts.Run != nil && !opts.Run.MatchString(name)) {
+			continue
+		}
+		fn, err := rt.GetGlobal(name)
+		if err != nil {
+			continue
+		}
+		if _, ok := fn.(*object.Closure); !ok {
+			continue
+		}
+
+		out.Reset()
+		testStart := time.Now()
+		_, err = rt.CallFunction(ctx, name)
+		result := Result{Name: name, Output: out.String(), Duration: time.Since(testStart)}
+		if err != nil {
+			result.Failure = describe(path, err)
+		}
+		file.Tests = append(file.Tests, result)
+	}
+	return file
+}
+
+// describe returns err with the positions in it prefixed by the file they
+// are in.
+func describe(path string, err error) string {
+	var (
+		syntaxErr  *monkey.SyntaxError
+		compileErr *monkey.CompileError
+		runtimeErr *monkey.RuntimeError
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		return joinErrors(path, syntaxErr.Errors)
+	case errors.As(err, &compileErr):
+		msgs := make([]string, len(compileErr.Diagnostics))
+		for i, d := range compileErr.Diagnostics {
+			if d.File != "" {
+				msgs[i] = d.Error()
+			} else {
+				msgs[i] = path + ":" + d.Error()
+			}
+		}
+		return strings.Join(msgs, "\n")
+	case errors.As(err, &runtimeErr) && runtimeErr.Line > 0:
+		file := runtimeErr.File
+		if file == "" {
+			file = path
+		}
+		return fmt.Sprintf("%s:%d: %s", file, runtimeErr.Line, runtimeErr.Err)
+	default:
+		return err.Error()
+	}
+}
+
+func joinErrors(path string, errs []*parser.Error) string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = path + ":" + e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
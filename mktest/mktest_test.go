@@ -0,0 +1,248 @@
+package mktest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tneuqole/monkey-go/coverage"
+)
+
+func writeFile(t *testing.T, path, src string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsserts(t *testing.T) {
+	tests := []struct {
+		body    string
+		failure string
+	}{
+		{`assert(1 < 2); assert(0); assert([], "empty is truthy")`, ""},
+		{`assert(1 > 2)`, "assertion failed"},
+		{`assert(if (false) { 1 }, "value is " + "null")`, "assertion failed: value is null"},
+		{`assert_eq(1 + 1, 2); assert_eq([1, {"a": 2}], [1, {"a": 2}])`, ""},
+		{`assert_eq(1, "1")`, "assert_eq failed\n  got:  1\n  want: \"1\""},
+		{`assert_eq([1, 2, 3], [1, 5], "arrays")`, "assert_eq failed: arrays\n  got:  [1, 2, 3]\n  want: [1, 5]\n  len: got 3, want 2\n  [1]: got 2, want 5"},
+		{
+			`assert_eq({"a": 1, "b": 2}, {"a": 3, "c": 4})`,
+			"assert_eq failed\n  got:  {a: 1,b: 2}\n  want: {a: 3,c: 4}\n" +
+				"  [\"a\"]: got 1, want 3\n  [\"c\"]: missing, want 4\n  [\"b\"]: got 2, want none",
+		},
+		{`let msg = assert_throws(fn() { 1 + true }, "unsupported"); assert_eq(msg, "unsupported types for binary operation: INTEGER BOOLEAN")`, ""},
+		{`assert_throws(fn() { 1 })`, "assert_throws failed: no error, returned 1"},
+		{`assert_throws(fn() { -true }, "division")`, `assert_throws failed: error "unsupported type for negation: BOOLEAN" does not contain "division"`},
+		{`assert_throws(fn() { assert(false) }); assert(true)`, ""},
+		{`assert_throws(fn() { -true }, 1)`, "argument 2 to `assert_throws` must be STRING, got=INTEGER"},
+	}
+
+	dir := t.TempDir()
+	for i, tt := range tests {
+		path := filepath.Join(dir, "assert_test.mk")
+		writeFile(t, path, "let test_it = fn() { "+tt.body+" };")
+
+		file := RunFile(context.Background(), path, Options{})
+		if file.Err != "" || len(file.Tests) != 1 {
+			t.Fatalf("tests[%d]: wrong file result. got=%+v", i, file)
+		}
+		failure := file.Tests[0].Failure
+		if tt.failure != "" {
+			tt.failure = path + ":1: " + tt.failure
+		}
+		if failure != tt.failure {
+			t.Errorf("tests[%d]: wrong failure.\nwant=%q\ngot= %q", i, tt.failure, failure)
+		}
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "math_test.mk")
+	writeFile(t, path, `let double = fn(x) { x * 2 };
+puts("loading");
+let test_double = fn() { puts("doubling"); assert_eq(double(2), 4) };
+let helper = fn() { assert(false) };
+let test_count = 3;
+let test_broken = fn() {
+  assert_eq(double(2), 5, "double")
+};
+let test_runtime = fn() { double("x") };
+`)
+
+	file := RunFile(context.Background(), path, Options{})
+	if file.Err != "" || file.Output != "loading\n" {
+		t.Fatalf("wrong file result. got=%+v", file)
+	}
+	var got []string
+	for _, r := range file.Tests {
+		got = append(got, r.Name+" "+status(r.Passed()))
+	}
+	if strings.Join(got, ", ") != "test_double pass, test_broken fail, test_runtime fail" {
+		t.Errorf("wrong tests. got=%v", got)
+	}
+	if file.Tests[0].Output != "doubling\n" {
+		t.Errorf("wrong output. got=%q", file.Tests[0].Output)
+	}
+	if !strings.HasPrefix(file.Tests[1].Failure, path+":7: assert_eq failed: double\n") {
+		t.Errorf("wrong failure. got=%q", file.Tests[1].Failure)
+	}
+	if file.Tests[2].Failure != path+":1: unsupported types for binary operation: STRING INTEGER" {
+		t.Errorf("wrong failure. got=%q", file.Tests[2].Failure)
+	}
+	if file.Passed() {
+		t.Errorf("expected file to fail")
+	}
+	if file.Duration < file.Tests[0].Duration+file.Tests[1].Duration+file.Tests[2].Duration {
+		t.Errorf("file took less than its tests. got=%s", file.Duration)
+	}
+
+	file = RunFile(context.Background(), path, Options{Run: regexp.MustCompile("double")})
+	if len(file.Tests) != 1 || file.Tests[0].Name != "test_double" || !file.Passed() {
+		t.Errorf("wrong filtered result. got=%+v", file)
+	}
+
+	broken := filepath.Join(dir, "broken_test.mk")
+	writeFile(t, broken, "let test_x = fn() { y };")
+	file = RunFile(context.Background(), broken, Options{})
+	if file.Err != broken+":1:21: undefined variable y" || len(file.Tests) != 0 {
+		t.Errorf("wrong result for a file that does not compile. got=%+v", file)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.mk")
+	writeFile(t, lib, "export let sign = fn(x) {\n  if (x < 0) {\n    return -1;\n  }\n  1\n};\n")
+	for _, name := range []string{"a_test.mk", "b_test.mk"} {
+		writeFile(t, filepath.Join(dir, name), `let lib = import "lib";
+let test_sign = fn() { assert_eq(lib["sign"](1), 1) };`)
+	}
+
+	profile := coverage.NewProfile()
+	for _, name := range []string{"a_test.mk", "b_test.mk"} {
+		if file := RunFile(context.Background(), filepath.Join(dir, name), Options{Coverage: profile}); !file.Passed() {
+			t.Fatalf("%s failed: %+v", name, file)
+		}
+	}
+
+	if files := fmt.Sprint(profile.Files()); files != "["+lib+"]" {
+		t.Errorf("wrong files. got=%s", files)
+	}
+	if lines := fmt.Sprint(profile.Lines(lib)); lines != "[{1 2} {2 2} {3 0} {5 2}]" {
+		t.Errorf("wrong lines. got=%s", lines)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a_test.mk", "a.mk", "sub/b_test.mk", "testdata/c_test.mk", ".git/d_test.mk", "_tmp/e_test.mk", "other.mk"} {
+		writeFile(t, filepath.Join(dir, name), "")
+	}
+
+	files, err := Discover([]string{dir, filepath.Join(dir, "other.mk")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range files {
+		files[i], _ = filepath.Rel(dir, f)
+	}
+	if strings.Join(files, " ") != "a_test.mk sub/b_test.mk other.mk" {
+		t.Errorf("wrong files. got=%v", files)
+	}
+
+	if _, err := Discover([]string{filepath.Join(dir, "missing")}); !os.IsNotExist(err) {
+		t.Errorf("wrong error for a missing path. got=%v", err)
+	}
+}
+
+var reportFiles = []File{
+	{
+		Path:     "a_test.mk",
+		Duration: 2 * time.Millisecond,
+		Tests: []Result{
+			{Name: "test_ok", Duration: time.Millisecond},
+			{Name: "test_bad", Failure: "a_test.mk:3: assertion failed", Output: "hi\n", Duration: 500 * time.Microsecond},
+		},
+	},
+	{Path: "b_test.mk", Err: "b_test.mk:1:1: undefined variable y"},
+	{Path: "c_test.mk", Duration: time.Millisecond},
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	WriteText(&buf, reportFiles, false)
+	want := `--- FAIL: test_bad (0.001s)
+    hi
+    a_test.mk:3: assertion failed
+FAIL	a_test.mk	0.002s
+b_test.mk:1:1: undefined variable y
+FAIL	b_test.mk	0.000s
+ok  	c_test.mk	0.001s [no tests to run]
+`
+	if buf.String() != want {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", want, buf.String())
+	}
+
+	buf.Reset()
+	WriteText(&buf, reportFiles[:1], true)
+	if !strings.HasPrefix(buf.String(), "--- PASS: test_ok (0.001s)\n--- FAIL: test_bad") {
+		t.Errorf("wrong verbose output. got=%q", buf.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, reportFiles); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"file":"a_test.mk","test":"test_ok","status":"pass","elapsed":0.001}
+{"file":"a_test.mk","test":"test_bad","status":"fail","elapsed":0.0005,"failure":"a_test.mk:3: assertion failed","output":"hi\n"}
+{"file":"a_test.mk","status":"fail","elapsed":0.002}
+{"file":"b_test.mk","status":"fail","elapsed":0,"failure":"b_test.mk:1:1: undefined variable y"}
+{"file":"c_test.mk","status":"pass","elapsed":0.001}
+`
+	if buf.String() != want {
+		t.Errorf("wrong output.\nwant=%s\ngot= %s", want, buf.String())
+	}
+}
+
+func TestWriteTAP(t *testing.T) {
+	var buf bytes.Buffer
+	WriteTAP(&buf, reportFiles)
+	want := `TAP version 13
+1..3
+ok 1 - a_test.mk test_ok # time=1.000ms
+not ok 2 - a_test.mk test_bad # time=0.500ms
+  ---
+  message: |
+    a_test.mk:3: assertion failed
+  output: |
+    hi
+  ...
+not ok 3 - b_test.mk # time=0.000ms
+  ---
+  message: |
+    b_test.mk:1:1: undefined variable y
+  ...
+`
+	if buf.String() != want {
+		t.Errorf("wrong output.\nwant=%s\ngot= %s", want, buf.String())
+	}
+
+	buf.Reset()
+	WriteTAP(&buf, nil)
+	if buf.String() != "TAP version 13\n1..0 # no tests\n" {
+		t.Errorf("wrong output for no tests. got=%q", buf.String())
+	}
+}
@@ -0,0 +1,140 @@
+package mktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteText reports files the way go test does: a line per file, preceded
+// by the failed tests, or by every test if verbose is set.
+func WriteText(w io.Writer, files []File, verbose bool) {
+	for _, f := range files {
+		if f.Output != "" && (verbose || f.Err != "") {
+			fmt.Fprint(w, indent(f.Output, ""))
+		}
+		if f.Err != "" {
+			fmt.Fprintf(w, "%s\nFAIL\t%s\t%.3fs\n", f.Err, f.Path, f.Duration.Seconds())
+			continue
+		}
+
+		for _, t := range f.Tests {
+			if t.Passed() && !verbose {
+				continue
+			}
+			status := "PASS"
+			if !t.Passed() {
+				status = "FAIL"
+			}
+			fmt.Fprintf(w, "--- %s: %s (%.3fs)\n", status, t.Name, t.Duration.Seconds())
+			fmt.Fprint(w, indent(t.Output, "    "))
+			fmt.Fprint(w, indent(t.Failure, "    "))
+		}
+
+		switch {
+		case !f.Passed():
+			fmt.Fprintf(w, "FAIL\t%s\t%.3fs\n", f.Path, f.Duration.Seconds())
+		case len(f.Tests) == 0:
+			fmt.Fprintf(w, "ok  \t%s\t%.3fs [no tests to run]\n", f.Path, f.Duration.Seconds())
+		default:
+			fmt.Fprintf(w, "ok  \t%s\t%.3fs\n", f.Path, f.Duration.Seconds())
+		}
+	}
+}
+
+// event is a line of WriteJSON's output. Test is empty for the event that
+// ends a file.
+type event struct {
+	File    string  `json:"file"`
+	Test    string  `json:"test,omitempty"`
+	Status  string  `json:"status"`
+	Elapsed float64 `json:"elapsed"`
+	Failure string  `json:"failure,omitempty"`
+	Output  string  `json:"output,omitempty"`
+}
+
+// WriteJSON reports files as a stream of JSON objects, one for each test
+// followed by one for its file.
+func WriteJSON(w io.Writer, files []File) error {
+	enc := json.NewEncoder(w)
+	for _, f := range files {
+		for _, t := range f.Tests {
+			e := event{File: f.Path, Test: t.Name, Status: status(t.Passed()), Elapsed: t.Duration.Seconds(), Failure: t.Failure, Output: t.Output}
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		e := event{File: f.Path, Status: status(f.Passed()), Elapsed: f.Duration.Seconds(), Failure: f.Err, Output: f.Output}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTAP reports files in the Test Anything Protocol, version 13. A file
+// that fails to load is reported as a failed test of its own.
+func WriteTAP(w io.Writer, files []File) {
+	n := 0
+	for _, f := range files {
+		if f.Err != "" {
+			n++
+		}
+		n += len(f.Tests)
+	}
+
+	fmt.Fprintln(w, "TAP version 13")
+	if n == 0 {
+		fmt.Fprintln(w, "1..0 # no tests")
+		return
+	}
+	fmt.Fprintf(w, "1..%d\n", n)
+
+	i := 0
+	point := func(ok bool, desc string, ms float64, failure, output string) {
+		i++
+		result := "ok"
+		if !ok {
+			result = "not ok"
+		}
+		fmt.Fprintf(w, "%s %d - %s # time=%.3fms\n", result, i, desc, ms)
+		if ok {
+			return
+		}
+		fmt.Fprintln(w, "  ---")
+		fmt.Fprintln(w, "  message: |")
+		fmt.Fprint(w, indent(failure, "    "))
+		if output != "" {
+			fmt.Fprintln(w, "  output: |")
+			fmt.Fprint(w, indent(output, "    "))
+		}
+		fmt.Fprintln(w, "  ...")
+	}
+	for _, f := range files {
+		if f.Err != "" {
+			point(false, f.Path, float64(f.Duration.Microseconds())/1000, f.Err, f.Output)
+			continue
+		}
+		for _, t := range f.Tests {
+			point(t.Passed(), f.Path+" "+t.Name, float64(t.Duration.Microseconds())/1000, t.Failure, t.Output)
+		}
+	}
+}
+
+func status(passed bool) string {
+	if passed {
+		return "pass"
+	}
+	return "fail"
+}
+
+// indent prefixes each line of s, ending it with a newline if it is not
+// empty.
+func indent(s, prefix string) string {
+	if s == "" {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	return prefix + strings.Join(lines, "\n"+prefix) + "\n"
+}
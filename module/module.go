@@ -0,0 +1,107 @@
+// Package module locates and parses the files loaded by import expressions.
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/parser"
+)
+
+// Ext is the extension of Monkey source files, implied when an import path
+// has none.
+const Ext = ".mk"
+
+// Resolve returns the path of the module imported as name by the module at
+// from. Relative names are relative to the directory of from, or to the
+// working directory for the main program, whose path may be empty.
+func Resolve(from, name string) string {
+	if filepath.Ext(name) == "" {
+		name += Ext
+	}
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(filepath.Dir(from), name)
+}
+
+// ParseError holds the parser errors of a module.
+type ParseError struct {
+	Path   string
+	Errors []*parser.Error
+}
+
+func (e *ParseError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = e.Path + ":" + err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Parse reads and parses the module at path. Macros are left for the caller
+// to expand.
+func Parse(path string) (*ast.Program, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if errs := p.ErrorDetails(); len(errs) != 0 {
+		return nil, &ParseError{Path: path, Errors: errs}
+	}
+
+	return program, nil
+}
+
+// CheckCycle returns an error if path is already being loaded, given the
+// chain of imports in progress.
+func CheckCycle(loading []string, path string) error {
+	for i, p := range loading {
+		if p == path {
+			cycle := append(append([]string{}, loading[i:]...), path)
+			return fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	return nil
+}
+
+// Exports returns the names a module declares with export let, in order.
+// Only top-level statements can export.
+func Exports(program *ast.Program) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok && let.Export && !seen[let.Name.Value] {
+			seen[let.Name.Value] = true
+			names = append(names, let.Name.Value)
+		}
+	}
+	return names
+}
+
+// CheckTopLevel returns an error if a module returns outside a function,
+// at its top level or in a block there, which would leave its exports
+// undefined.
+func CheckTopLevel(program *ast.Program) error {
+	var err error
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			return false
+		case *ast.ReturnStatement:
+			if err == nil {
+				err = fmt.Errorf("%d:%d: return outside function", node.Token.Line, node.Token.Column)
+			}
+			return false
+		}
+		return err == nil
+	})
+	return err
+}
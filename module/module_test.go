@@ -0,0 +1,78 @@
+package module
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/parser"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		from, name string
+		expected   string
+	}{
+		{"", "math", "math.mk"},
+		{"", "lib/math.mk", "lib/math.mk"},
+		{"src/main.mk", "lib/math", "src/lib/math.mk"},
+		{"src/lib/util.mk", "../math", "src/math.mk"},
+		{"src/main.mk", "/abs/math", "/abs/math.mk"},
+		{"src/main.mk", "data.json", "src/data.json"},
+	}
+
+	for _, tt := range tests {
+		if actual := Resolve(tt.from, tt.name); actual != filepath.FromSlash(tt.expected) {
+			t.Errorf("Resolve(%q, %q) wrong. want=%q, got=%q", tt.from, tt.name, tt.expected, actual)
+		}
+	}
+}
+
+func TestCheckCycle(t *testing.T) {
+	if err := CheckCycle([]string{"a.mk", "b.mk"}, "c.mk"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	err := CheckCycle([]string{"main.mk", "a.mk", "b.mk"}, "a.mk")
+	if err == nil || err.Error() != "import cycle: a.mk -> b.mk -> a.mk" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestExports(t *testing.T) {
+	program := parser.New(lexer.New(`
+		export let a = 1;
+		let b = 2;
+		let f = fn() { export let c = 3; c };
+		export let d = 4;
+		export let a = 5;
+	`)).ParseProgram()
+
+	names := Exports(program)
+	if len(names) != 2 || names[0] != "a" || names[1] != "d" {
+		t.Errorf("wrong exports. got=%q", names)
+	}
+}
+
+func TestCheckTopLevel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(x) { if (x) { return 1; } 2 };\nexport let v = f(true);", ""},
+		{"let m = macro() { quote(1) };\nreturn 1;", "2:1: return outside function"},
+		{"let a = 1;\nif (true) { return a; }", "2:13: return outside function"},
+		{"let b = [if (true) { 1 } else { return 2; }];", "1:33: return outside function"},
+	}
+
+	for _, tt := range tests {
+		err := CheckTopLevel(parser.New(lexer.New(tt.input)).ParseProgram())
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		if actual != tt.expected {
+			t.Errorf("CheckTopLevel(%q) wrong. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
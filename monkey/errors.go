@@ -0,0 +1,67 @@
+package monkey
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tneuqole/monkey-go/compiler"
+	"github.com/tneuqole/monkey-go/parser"
+)
+
+var (
+	// ErrUndefined is returned for a global that was never defined or has
+	// no value yet.
+	ErrUndefined = errors.New("undefined global")
+	// ErrNotFunction is returned by CallFunction for a global that holds
+	// something other than a function.
+	ErrNotFunction = errors.New("not a function")
+	// ErrWrongRuntime is returned by Run for a Program compiled by another
+	// Runtime, whose constants and globals it does not share.
+	ErrWrongRuntime = errors.New("program compiled by a different runtime")
+)
+
+// SyntaxError is returned by Compile when the source does not parse.
+type SyntaxError struct {
+	Errors []*parser.Error
+}
+
+func (e *SyntaxError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// CompileError is returned by Compile when the program parses but does not
+// compile, for example because it uses an undefined variable.
+type CompileError struct {
+	Diagnostics compiler.Diagnostics
+}
+
+func (e *CompileError) Error() string {
+	return e.Diagnostics.Error()
+}
+
+// RuntimeError is returned when a program fails while running. File is
+// empty unless the failure was in an imported module.
+type RuntimeError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Line == 0 {
+		return e.Err.Error()
+	}
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
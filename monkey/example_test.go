@@ -0,0 +1,164 @@
+package monkey_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tneuqole/monkey-go/monkey"
+	"github.com/tneuqole/monkey-go/object"
+)
+
+func ExampleRuntime_Eval() {
+	rt := monkey.New()
+
+	result, err := rt.Eval(context.Background(), `let add = fn(a, b) { a + b }; add(1, 2)`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(result.Inspect())
+	// Output: 3
+}
+
+func ExampleRuntime_Run() {
+	rt := monkey.New()
+	rt.SetGlobal("n", &object.Integer{Value: 0})
+
+	program, err := rt.Compile(`n * n`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// a program sees the current value of globals each time it runs
+	for i := int64(1); i <= 3; i++ {
+		rt.SetGlobal("n", &object.Integer{Value: i})
+		result, _ := rt.Run(context.Background(), program)
+		fmt.Println(result.Inspect())
+	}
+	// Output:
+	// 1
+	// 4
+	// 9
+}
+
+func ExampleRuntime_CallFunction() {
+	rt := monkey.New()
+	if _, err := rt.Eval(context.Background(), `let greet = fn(name) { "hello " + name };`); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	result, err := rt.CallFunction(context.Background(), "greet", &object.String{Value: "gopher"})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(result.Inspect())
+	// Output: hello gopher
+}
+
+func ExampleRuntime_GetGlobal() {
+	rt := monkey.New()
+	rt.Eval(context.Background(), `let config = {"retries": 3};`)
+
+	config, _ := rt.GetGlobal("config")
+	fmt.Println(config.Inspect())
+
+	_, err := rt.GetGlobal("missing")
+	fmt.Println(err)
+	// Output:
+	// {retries: 3}
+	// undefined global: missing
+}
+
+func ExampleRuntimeError() {
+	rt := monkey.New()
+
+	_, err := rt.Eval(context.Background(), "let f = fn(x) { x };\nf(1, 2);")
+	fmt.Println(err)
+	// Output: line 2: wrong number of arguments: want=1, got=2
+}
+
+func ExampleNewWithBuiltins() {
+	// a sandbox without puts, and with a host function instead
+	builtins := object.NewStandardRegistry("puts")
+	builtins.Register("log", object.Exactly(1), func(args ...object.Object) object.Object {
+		fmt.Println("script:", args[0].Inspect())
+		return nil
+	})
+	rt := monkey.NewWithBuiltins(builtins)
+
+	_, err := rt.Eval(context.Background(), `log("starting"); puts("escaped")`)
+	fmt.Println(err)
+	// Output: 1:18: undefined variable puts
+}
+
+func ExampleRuntime_Register() {
+	rt := monkey.New()
+	rt.Register("env", object.Exactly(1), func(args ...object.Object) object.Object {
+		return &object.String{Value: "value of " + args[0].Inspect()}
+	})
+
+	result, _ := rt.Eval(context.Background(), `env("HOME")`)
+	fmt.Println(result.Inspect())
+	// Output: value of HOME
+}
+
+func ExampleRuntime_RegisterFunc() {
+	rt := monkey.New()
+	rt.RegisterFunc("replicate", func(name string, n int) ([]string, error) {
+		if n < 0 {
+			return nil, errors.New("negative count")
+		}
+		return strings.Fields(strings.Repeat(name+" ", n)), nil
+	})
+
+	result, _ := rt.Eval(context.Background(), `replicate("go", 3)`)
+	fmt.Println(result.Inspect())
+
+	// errors returned by fn stop the program
+	_, err := rt.Eval(context.Background(), `replicate("go", -1)`)
+	fmt.Println(err)
+
+	_, err = rt.Eval(context.Background(), `replicate(3, "go")`)
+	fmt.Println(err)
+	// Output:
+	// [go, go, go]
+	// line 1: negative count
+	// line 1: argument 1 to `replicate`: cannot convert INTEGER to string
+}
+
+func ExampleRuntime_RegisterFunc_callback() {
+	rt := monkey.New()
+	// functions passed by the script arrive as Go funcs
+	rt.RegisterFunc("retry", func(attempts int, op func(int) (bool, error)) (int, error) {
+		for i := 1; i <= attempts; i++ {
+			ok, err := op(i)
+			if err != nil || ok {
+				return i, err
+			}
+		}
+		return 0, errors.New("gave up")
+	})
+
+	result, _ := rt.Eval(context.Background(), `retry(5, fn(i) { i * i > 10 })`)
+	fmt.Println(result.Inspect())
+	// Output: 4
+}
+
+func ExampleRuntime_SetIO() {
+	rt := monkey.New()
+
+	var out strings.Builder
+	rt.SetIO(object.NewIO(strings.NewReader("gopher\n"), &out, nil))
+
+	if _, err := rt.Eval(context.Background(), `let name = input("name? "); print("hello", name);`); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%q\n", out.String())
+	// Output: "name? hello gopher\n"
+}
@@ -0,0 +1,363 @@
+// Package monkey embeds the Monkey language in Go programs.
+//
+// A Runtime compiles source to bytecode and runs it in the VM. Globals
+// persist between runs, so a host can load a script once and then read its
+// results or call its functions:
+//
+//	rt := monkey.New()
+//	if _, err := rt.Eval(ctx, `let double = fn(x) { x * 2 };`); err != nil {
+//		return err
+//	}
+//	result, err := rt.CallFunction(ctx, "double", &object.Integer{Value: 21})
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/code"
+	"github.com/tneuqole/monkey-go/compiler"
+	"github.com/tneuqole/monkey-go/coverage"
+	"github.com/tneuqole/monkey-go/evaluator"
+	"github.com/tneuqole/monkey-go/lexer"
+	"github.com/tneuqole/monkey-go/object"
+	"github.com/tneuqole/monkey-go/parser"
+	"github.com/tneuqole/monkey-go/vm"
+)
+
+// checkInterval is how many instructions run between checks of the
+// context passed to Run.
+const checkInterval = 1024
+
+// Runtime holds the state shared by the programs it compiles: builtins,
+// global variables, constants and macros. A Runtime is not safe for
+// concurrent use.
+type Runtime struct {
+	builtins    *object.Registry
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+	macroEnv    *object.Environment
+	io          *object.IO
+
+	coverage *coverage.Profile
+	profiler *vm.Profiler
+	tracer   vm.Tracer
+	// limits of the VM, or 0 for its defaults
+	maxStackSize int
+	maxFrames    int
+	// path of the file compiled last, empty for source passed to Compile
+	path string
+}
+
+// Program is source compiled by a Runtime, ready to be run by it any number
+// of times.
+type Program struct {
+	rt       *Runtime
+	bytecode *compiler.Bytecode
+	// whether the program ends with an expression statement, whose value is
+	// the result of running it
+	hasResult bool
+}
+
+// New returns a Runtime with the standard builtins and no globals defined.
+func New() *Runtime {
+	return NewWithBuiltins(object.NewStandardRegistry())
+}
+
+// NewWithBuiltins returns a Runtime whose programs can call the builtins of
+// r and no others. Builtins registered with r later are not visible; use
+// Register to add them.
+func NewWithBuiltins(r *object.Registry) *Runtime {
+	s := compiler.NewSymbolTable()
+	for i, b := range r.All() {
+		s.DefineBuiltin(i, b.Name)
+	}
+
+	return &Runtime{
+		builtins:    r,
+		symbolTable: s,
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+		macroEnv:    object.NewEnvironmentWithBuiltins(r),
+		io:          object.StdIO(),
+	}
+}
+
+// Register adds a builtin implemented by fn for programs compiled
+// afterwards. See object.Registry.Register.
+func (r *Runtime) Register(name string, arity object.Arity, fn object.BuiltinFunction) error {
+	if err := r.builtins.Register(name, arity, fn); err != nil {
+		return err
+	}
+	r.symbolTable.DefineBuiltin(len(r.builtins.All())-1, name)
+	return nil
+}
+
+// SetIO sets the streams used by builtins like puts and readline, which
+// default to the process's own.
+func (r *Runtime) SetIO(streams *object.IO) {
+	r.io = streams
+	r.macroEnv.SetIO(streams)
+}
+
+// SetCoverage makes later runs record the lines they execute in profile,
+// or stops recording if profile is nil. Lines of the main program are
+// recorded under the path of the program compiled last, which is empty for
+// source passed to Compile.
+func (r *Runtime) SetCoverage(profile *coverage.Profile) {
+	r.coverage = profile
+}
+
+// SetProfiler makes later runs measure their calls and instructions with
+// profiler, or stops measuring if profiler is nil.
+func (r *Runtime) SetProfiler(profiler *vm.Profiler) {
+	r.profiler = profiler
+}
+
+// SetTracer makes later runs call tracer with every instruction, or stops
+// tracing if tracer is nil.
+func (r *Runtime) SetTracer(tracer vm.Tracer) {
+	r.tracer = tracer
+}
+
+// SetStackLimits limits how many values the stack of later runs can hold
+// and how deeply their calls can nest. Zero keeps the default of the VM,
+// vm.DefaultMaxStackSize or vm.DefaultMaxFrames. Runs that need more fail
+// with vm.ErrStackOverflow.
+func (r *Runtime) SetStackLimits(maxStackSize, maxFrames int) {
+	r.maxStackSize = maxStackSize
+	r.maxFrames = maxFrames
+}
+
+// Compile parses and compiles source. It can use the globals defined by
+// programs compiled before it and by SetGlobal. Errors are a *SyntaxError
+// or a *CompileError.
+func (r *Runtime) Compile(source string) (*Program, error) {
+	return r.compile(source, "")
+}
+
+// CompileFile reads and compiles the file at path, resolving its imports
+// relative to it. Errors are as for Compile, or from reading the file.
+func (r *Runtime) CompileFile(path string) (*Program, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return r.compile(string(src), path)
+}
+
+func (r *Runtime) compile(source, path string) (*Program, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.ErrorDetails(); len(errs) != 0 {
+		return nil, &SyntaxError{Errors: errs}
+	}
+
+	evaluator.DefineMacros(program, r.macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, r.macroEnv)
+	if err != nil {
+		merr := err.(*evaluator.MacroError)
+		diag := &compiler.Diagnostic{Line: merr.Line, Column: merr.Column, Message: merr.Message}
+		return nil, &CompileError{Diagnostics: compiler.Diagnostics{diag}}
+	}
+
+	c := compiler.NewWithState(r.symbolTable, r.constants)
+	c.SetPath(path)
+	if err := c.Compile(expanded); err != nil {
+		return nil, &CompileError{Diagnostics: err.(compiler.Diagnostics)}
+	}
+
+	bytecode := c.Bytecode()
+	r.constants = bytecode.Constants
+	r.path = path
+
+	hasResult := false
+	if n := len(program.Statements); n > 0 {
+		_, hasResult = program.Statements[n-1].(*ast.ExpressionStatement)
+	}
+	return &Program{rt: r, bytecode: bytecode, hasResult: hasResult}, nil
+}
+
+// Run runs program and returns the value of its last expression statement,
+// or NULL if it has none. Run stops early with the context's error if ctx
+// is done. Other failures are a *RuntimeError.
+func (r *Runtime) Run(ctx context.Context, program *Program) (object.Object, error) {
+	if program.rt != r {
+		return nil, ErrWrongRuntime
+	}
+	result, err := r.run(ctx, program.bytecode)
+	if err != nil {
+		return nil, err
+	}
+	if !program.hasResult {
+		return vm.Null, nil
+	}
+	return result, nil
+}
+
+// Eval compiles and runs source.
+func (r *Runtime) Eval(ctx context.Context, source string) (object.Object, error) {
+	program, err := r.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	return r.Run(ctx, program)
+}
+
+// SetGlobal assigns value to the global name, defining it if needed, so
+// that programs compiled afterwards can use it.
+func (r *Runtime) SetGlobal(name string, value object.Object) {
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		symbol = r.symbolTable.Define(name)
+	}
+	r.globals[symbol.Index] = value
+}
+
+// Globals returns the names of the globals defined so far, in the order
+// they were first defined.
+func (r *Runtime) Globals() []string {
+	var names []string
+	for _, name := range r.symbolTable.Names() {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// GetGlobal returns the value of the global name, or an error wrapping
+// ErrUndefined if it has none.
+func (r *Runtime) GetGlobal(name string) (object.Object, error) {
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope || r.globals[symbol.Index] == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUndefined, name)
+	}
+	return r.globals[symbol.Index], nil
+}
+
+// CallFunction calls the function bound to the global or builtin name with
+// args and returns its result. Errors are as for GetGlobal and Run, or wrap
+// ErrNotFunction.
+func (r *Runtime) CallFunction(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUndefined, name)
+	}
+
+	var load []byte
+	switch symbol.Scope {
+	case compiler.GlobalScope:
+		fn, err := r.GetGlobal(name)
+		if err != nil {
+			return nil, err
+		}
+		switch fn.(type) {
+		case *object.Closure, *object.Builtin:
+		default:
+			return nil, fmt.Errorf("%w: %s is %s", ErrNotFunction, name, fn.Type())
+		}
+		load = code.Make(code.OpGetGlobal, symbol.Index)
+	case compiler.BuiltinScope:
+		load = code.Make(code.OpGetBuiltin, symbol.Index)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUndefined, name)
+	}
+
+	if len(args) > 255 {
+		return nil, fmt.Errorf("too many arguments: %d", len(args))
+	}
+
+	// the arguments are loaded as constants following the runtime's own,
+	// which the function may refer to
+	constants := append(r.constants[:len(r.constants):len(r.constants)], args...)
+	ins := code.Instructions(load)
+	for i := range args {
+		ins = append(ins, code.Make(code.OpConstant, len(r.constants)+i)...)
+	}
+	ins = append(ins, code.Make(code.OpCall, len(args))...)
+	ins = append(ins, code.Make(code.OpPop)...)
+
+	return r.run(ctx, &compiler.Bytecode{Instructions: ins, Constants: constants})
+}
+
+// RegisterFunc adds the Go function fn as a builtin for programs compiled
+// afterwards. See object.Registry.RegisterFunc.
+func (r *Runtime) RegisterFunc(name string, fn interface{}) error {
+	if err := r.builtins.RegisterFunc(name, fn); err != nil {
+		return err
+	}
+	r.symbolTable.DefineBuiltin(len(r.builtins.All())-1, name)
+	return nil
+}
+
+func (r *Runtime) run(ctx context.Context, bytecode *compiler.Bytecode) (object.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	machine := vm.NewWithGlobals(bytecode, r.globals)
+	machine.SetBuiltins(r.builtins)
+	machine.SetIO(r.io)
+	if r.tracer != nil {
+		machine.SetTracer(r.tracer)
+	}
+	if r.maxStackSize != 0 {
+		machine.SetMaxStackSize(r.maxStackSize)
+	}
+	if r.maxFrames != 0 {
+		machine.SetMaxFrames(r.maxFrames)
+	}
+
+	var hooks []vm.Hook
+	if done := ctx.Done(); done != nil {
+		n := 0
+		hooks = append(hooks, func(*vm.Frame) error {
+			n++
+			if n%checkInterval != 0 {
+				return nil
+			}
+			select {
+			case <-done:
+				return ctx.Err()
+			default:
+				return nil
+			}
+		})
+	}
+	if r.coverage != nil {
+		cov := vm.NewCoverage(r.coverage, r.path)
+		cov.Add(bytecode)
+		hooks = append(hooks, cov.Hook)
+	}
+	if r.profiler != nil {
+		hooks = append(hooks, r.profiler.Hook(machine))
+	}
+	switch len(hooks) {
+	case 0:
+	case 1:
+		machine.SetHook(hooks[0])
+	default:
+		machine.SetHook(func(f *vm.Frame) error {
+			for _, hook := range hooks {
+				if err := hook(f); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	if err := machine.Run(); err != nil {
+		if ctxErr := ctx.Err(); err == ctxErr {
+			return nil, err
+		}
+		file, line := machine.Location()
+		return nil, &RuntimeError{File: file, Line: line, Err: err}
+	}
+
+	return machine.LastPoppedStackElem(), nil
+}
@@ -0,0 +1,255 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tneuqole/monkey-go/coverage"
+	"github.com/tneuqole/monkey-go/object"
+	"github.com/tneuqole/monkey-go/vm"
+)
+
+func TestCompileErrors(t *testing.T) {
+	rt := New()
+
+	_, err := rt.Compile("let x = ;")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || err.Error() != "1:9: no prefix parse function for ; found" {
+		t.Errorf("wrong error. got=%T (%v)", err, err)
+	}
+
+	_, err = rt.Compile("y + 1")
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) || len(compileErr.Diagnostics) != 1 || err.Error() != "1:1: undefined variable y" {
+		t.Errorf("wrong error. got=%T (%v)", err, err)
+	}
+
+	_, err = rt.Compile("let m = macro() { 1 }; m()")
+	if !errors.As(err, &compileErr) || err.Error() != "1:24: macro m must return a quote, got INTEGER" {
+		t.Errorf("wrong error. got=%T (%v)", err, err)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	rt := New()
+
+	_, err := rt.Eval(context.Background(), "let x = 1;\n-true;")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Line != 2 || runtimeErr.Err.Error() != "unsupported type for negation: BOOLEAN" {
+		t.Errorf("wrong error. got=%T (%v)", err, err)
+	}
+
+	rt.SetStackLimits(0, 10)
+	_, err = rt.Eval(context.Background(), "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } };\nf(10);")
+	if !errors.As(err, &runtimeErr) || runtimeErr.Line != 1 || !errors.Is(err, vm.ErrStackOverflow) {
+		t.Errorf("wrong error. got=%T (%v)", err, err)
+	}
+	if result, err := rt.Eval(context.Background(), "f(8)"); err != nil || result.Inspect() != "8" {
+		t.Errorf("got %v (%v), want 8", result, err)
+	}
+	rt.SetStackLimits(0, 0)
+
+	program, err := New().Compile("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.Run(context.Background(), program); err != ErrWrongRuntime {
+		t.Errorf("wrong error. want=%v, got=%v", ErrWrongRuntime, err)
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	rt := New()
+	rt.SetGlobal("x", &object.Integer{Value: 5})
+	rt.SetGlobal("len", &object.String{Value: "shadowed"})
+
+	result, err := rt.Eval(context.Background(), `let y = x + 1; [len, y]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inspect() != "[shadowed, 6]" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	y, err := rt.GetGlobal("y")
+	if err != nil || y.Inspect() != "6" {
+		t.Errorf("wrong global y. got=%v, %v", y, err)
+	}
+
+	for _, name := range []string{"z", "puts"} {
+		if _, err := rt.GetGlobal(name); !errors.Is(err, ErrUndefined) {
+			t.Errorf("wrong error for %s. got=%v", name, err)
+		}
+	}
+
+	result, err = rt.Eval(context.Background(), `let z = 1;`)
+	if err != nil || result != vm.Null {
+		t.Errorf("expected NULL for a program without expressions. got=%v, %v", result, err)
+	}
+
+	if names := fmt.Sprint(rt.Globals()); names != "[x len y z]" {
+		t.Errorf("wrong globals. got=%s", names)
+	}
+}
+
+func TestCompileFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "lib.mk"), []byte(`export let double = fn(x) { x * 2 };`), 0o644)
+	os.WriteFile(filepath.Join(dir, "main.mk"), []byte(`let lib = import "lib"; lib["double"](21)`), 0o644)
+
+	rt := New()
+	program, err := rt.CompileFile(filepath.Join(dir, "main.mk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := rt.Run(context.Background(), program)
+	if err != nil || result.Inspect() != "42" {
+		t.Errorf("wrong result. got=%v, %v", result, err)
+	}
+
+	if _, err := rt.CompileFile(filepath.Join(dir, "missing.mk")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("wrong error for a missing file. got=%v", err)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.mk")
+	os.WriteFile(path, []byte("let f = fn(x) {\n  if (x) {\n    return 1;\n  }\n  2\n};\nf(false);"), 0o644)
+
+	rt := New()
+	profile := coverage.NewProfile()
+	rt.SetCoverage(profile)
+	program, err := rt.CompileFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.Run(context.Background(), program); err != nil {
+		t.Fatal(err)
+	}
+	if lines := fmt.Sprint(profile.Lines(path)); lines != "[{1 1} {2 1} {3 0} {5 1} {7 1}]" {
+		t.Errorf("wrong lines. got=%s", lines)
+	}
+
+	// calls count toward the program the function was compiled from
+	if _, err := rt.CallFunction(context.Background(), "f", object.TRUE); err != nil {
+		t.Fatal(err)
+	}
+	if lines := fmt.Sprint(profile.Lines(path)); lines != "[{1 1} {2 2} {3 1} {5 1} {7 1}]" {
+		t.Errorf("wrong lines after call. got=%s", lines)
+	}
+	if files := fmt.Sprint(profile.Files()); files != "["+path+"]" {
+		t.Errorf("wrong files. got=%s", files)
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	rt := New()
+	profiler := vm.NewProfiler()
+	rt.SetProfiler(profiler)
+	if _, err := rt.Eval(context.Background(), `let f = fn(x) { x + 1 }; f(1);`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.CallFunction(context.Background(), "f", &object.Integer{Value: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := make(map[string]int64)
+	for _, fn := range profiler.Profile().Functions {
+		calls[fn.Name] = fn.Calls
+	}
+	if calls["main"] != 2 || calls["f"] != 2 {
+		t.Errorf("wrong calls. got=%v", calls)
+	}
+}
+
+func TestCallFunction(t *testing.T) {
+	rt := New()
+	_, err := rt.Eval(context.Background(), `
+		let offset = 10;
+		let add = fn(a, b) { a + b + offset };
+		let answer = 42;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := rt.CallFunction(context.Background(), "add", &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	if err != nil || result.Inspect() != "13" {
+		t.Errorf("wrong result. got=%v, %v", result, err)
+	}
+
+	result, err = rt.CallFunction(context.Background(), "len", &object.String{Value: "four"})
+	if err != nil || result.Inspect() != "4" {
+		t.Errorf("wrong result. got=%v, %v", result, err)
+	}
+
+	if _, err := rt.CallFunction(context.Background(), "answer"); !errors.Is(err, ErrNotFunction) {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	if _, err := rt.CallFunction(context.Background(), "missing"); !errors.Is(err, ErrUndefined) {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	_, err = rt.CallFunction(context.Background(), "add", &object.Integer{Value: 1})
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Err.Error() != "wrong number of arguments: want=2, got=1" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	rt := New()
+	_, err := rt.Eval(context.Background(), `let loop = fn(n) { loop(n) + 1 };`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := rt.Eval(ctx, `1`); err != context.Canceled {
+		t.Errorf("wrong error. want=%v, got=%v", context.Canceled, err)
+	}
+
+	// a long running program stops at the deadline
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = rt.Eval(ctx, `
+		let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+		fib(35);
+	`)
+	if err != context.DeadlineExceeded {
+		t.Errorf("wrong error. want=%v, got=%v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	rt := NewWithBuiltins(object.NewRegistry())
+	if _, err := rt.Compile(`len("")`); err == nil {
+		t.Errorf("expected len to be undefined")
+	}
+
+	err := rt.Register("inc", object.Exactly(1), func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value + 1}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Register("inc", object.Exactly(1), nil); err == nil {
+		t.Errorf("expected registering inc twice to fail")
+	}
+
+	result, err := rt.Eval(context.Background(), `let f = fn(x) { inc(x) * 2 }; f(1)`)
+	if err != nil || result.Inspect() != "4" {
+		t.Errorf("wrong result. got=%v, %v", result, err)
+	}
+
+	_, err = rt.CallFunction(context.Background(), "inc", &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	if err == nil || err.Error() != "wrong number of arguments. got=2, want=1" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
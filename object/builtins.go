@@ -1,143 +1,331 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
 
-var Builtins = []struct {
-	Name    string
-	Builtin *Builtin
-}{
+// MaxBuiltins is the number of builtins a registry can hold, as compiled
+// code refers to them by a one byte index.
+const MaxBuiltins = 256
+
+// maxLength is the most elements or bytes of an array or string made by a
+// builtin, which keeps programs from allocating without bound.
+const maxLength = 1 << 26
+
+// Variadic is the Max of the Arity of a builtin without an upper limit on
+// its number of arguments.
+const Variadic = -1
+
+// Arity is the number of arguments a builtin accepts: at least Min and, if
+// Max is not Variadic, at most Max.
+type Arity struct {
+	Min, Max int
+}
+
+// Exactly returns the Arity of a builtin taking n arguments.
+func Exactly(n int) Arity { return Arity{Min: n, Max: n} }
+
+// AtLeast returns the Arity of a variadic builtin taking n or more arguments.
+func AtLeast(n int) Arity { return Arity{Min: n, Max: Variadic} }
+
+// Between returns the Arity of a builtin taking min to max arguments.
+func Between(min, max int) Arity { return Arity{Min: min, Max: max} }
+
+// Accepts reports whether a call with n arguments is allowed.
+func (a Arity) Accepts(n int) bool {
+	return n >= a.Min && (a.Max == Variadic || n <= a.Max)
+}
+
+func (a Arity) String() string {
+	switch {
+	case a.Max == Variadic:
+		return fmt.Sprintf("at least %d", a.Min)
+	case a.Min == a.Max:
+		return fmt.Sprintf("%d", a.Min)
+	default:
+		return fmt.Sprintf("%d to %d", a.Min, a.Max)
+	}
+}
+
+// Registry is an ordered set of builtins. The compiler refers to builtins
+// by their index in it and the evaluator by name, so every compiler, VM and
+// evaluator environment running the same program must use the same
+// registry, or equal ones.
+type Registry struct {
+	builtins []*Builtin
+	index    map[string]int
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{index: make(map[string]int)}
+}
+
+// NewStandardRegistry returns a registry with the standard builtins except
+// those named in omit, for example to keep puts out of a sandbox.
+func NewStandardRegistry(omit ...string) *Registry {
+	r := NewRegistry()
+	for _, defs := range standardLibrary {
+		for _, def := range defs {
+			if !contains(omit, def.name) {
+				r.RegisterHost(def.name, def.arity, def.fn)
+			}
+		}
+	}
+	return r
+}
+
+// Register adds a builtin called name. Calls with a number of arguments
+// arity does not accept return an error without calling fn.
+func (r *Registry) Register(name string, arity Arity, fn BuiltinFunction) error {
+	return r.add(&Builtin{Name: name, Arity: arity, Fn: func(args ...Object) Object {
+		if !arity.Accepts(len(args)) {
+			return wrongArguments(len(args), arity)
+		}
+		return fn(args...)
+	}})
+}
+
+// RegisterHost is like Register for builtins that use the evaluator or VM
+// running them, like map(arr, fn) or print.
+func (r *Registry) RegisterHost(name string, arity Arity, fn HostFunction) error {
+	return r.add(&Builtin{Name: name, Arity: arity, HostFn: func(host Host, args ...Object) Object {
+		if !arity.Accepts(len(args)) {
+			return wrongArguments(len(args), arity)
+		}
+		return fn(host, args...)
+	}})
+}
+
+func (r *Registry) add(b *Builtin) error {
+	if _, ok := r.index[b.Name]; ok {
+		return fmt.Errorf("builtin %s already registered", b.Name)
+	}
+	if len(r.builtins) >= MaxBuiltins {
+		return fmt.Errorf("cannot register %s: too many builtins", b.Name)
+	}
+
+	r.index[b.Name] = len(r.builtins)
+	r.builtins = append(r.builtins, b)
+	return nil
+}
+
+func wrongArguments(got int, want Arity) *Error {
+	return newError("wrong number of arguments. got=%d, want=%s", got, want)
+}
+
+// Lookup returns the builtin called name.
+func (r *Registry) Lookup(name string) (*Builtin, bool) {
+	i, ok := r.index[name]
+	if !ok {
+		return nil, false
+	}
+	return r.builtins[i], true
+}
+
+// Get returns the builtin at index i, or nil if there is none.
+func (r *Registry) Get(i int) *Builtin {
+	if i < 0 || i >= len(r.builtins) {
+		return nil
+	}
+	return r.builtins[i]
+}
+
+// All returns the builtins in index order.
+func (r *Registry) All() []*Builtin {
+	return r.builtins
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinDef defines a standard builtin.
+type builtinDef struct {
+	name  string
+	arity Arity
+	fn    HostFunction
+}
+
+// standardLibrary is the builtins of NewStandardRegistry, in index order.
+var standardLibrary = [][]builtinDef{
+	standardBuiltins,
+	collectionBuiltins,
+	stringBuiltins,
+	hashBuiltins,
+	jsonBuiltins,
+}
+
+var standardBuiltins = []builtinDef{
 	{
 		"len",
-		&Builtin{
-			Fn: func(args ...Object) Object {
-				if len(args) != 1 {
-					return newError("wrong number of arguments. got=%d, want=1", len(args))
-				}
-
-				switch arg := args[0].(type) {
-				case *Array:
-					return &Integer{Value: int64(len(arg.Elements))}
-				case *String:
-					return &Integer{Value: int64(len(arg.Value))}
-				default:
-					return newError("argument to `len` not supported, got=%s", arg.Type())
-				}
-			},
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			switch arg := args[0].(type) {
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			case *String:
+				// characters, as string indexes count
+				return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *Hash:
+				return &Integer{Value: int64(arg.Len())}
+			default:
+				return newError("argument to `len` not supported, got=%s", arg.Type())
+			}
 		},
 	},
 	{
 		"puts",
-		&Builtin{
-			Fn: func(args ...Object) Object {
-				for _, arg := range args {
-					fmt.Println(arg.Inspect())
-				}
+		AtLeast(0),
+		func(host Host, args ...Object) Object {
+			for _, arg := range args {
+				fmt.Fprintln(host.IO().Stdout, arg.Inspect())
+			}
 
-				return nil
-			},
+			return nil
 		},
 	},
 	{
 		"first",
-		&Builtin{
-			Fn: func(args ...Object) Object {
-				if len(args) != 1 {
-					return newError("wrong number of arguments. got=%d, want=1", len(args))
-				}
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `first` must be ARRAY, got=%s", args[0].Type())
+			}
 
-				if args[0].Type() != ARRAY_OBJ {
-					return newError("argument to `first` must be ARRAY, got=%s", args[0].Type())
-				}
+			arr := args[0].(*Array)
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
 
-				arr := args[0].(*Array)
-				if len(arr.Elements) > 0 {
-					return arr.Elements[0]
-				}
-
-				return nil
-			},
+			return nil
 		},
 	},
 	{
 		"last",
-		&Builtin{
-			Fn: func(args ...Object) Object {
-				if len(args) != 1 {
-					return newError("wrong number of arguments. got=%d, want=1", len(args))
-				}
-
-				if args[0].Type() != ARRAY_OBJ {
-					return newError("argument to `last` must be ARRAY, got=%s", args[0].Type())
-				}
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `last` must be ARRAY, got=%s", args[0].Type())
+			}
 
-				arr := args[0].(*Array)
-				length := len(arr.Elements)
-				if length > 0 {
-					return arr.Elements[length-1]
-				}
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				return arr.Elements[length-1]
+			}
 
-				return nil
-			},
+			return nil
 		},
 	},
 	{
 		"rest",
-		&Builtin{
-			Fn: func(args ...Object) Object {
-				if len(args) != 1 {
-					return newError("wrong number of arguments. got=%d, want=1", len(args))
-				}
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `rest` must be ARRAY, got=%s", args[0].Type())
+			}
 
-				if args[0].Type() != ARRAY_OBJ {
-					return newError("argument to `rest` must be ARRAY, got=%s", args[0].Type())
-				}
-
-				arr := args[0].(*Array)
-				length := len(arr.Elements)
-				if length > 0 {
-					newArr := make([]Object, length-1, length-1)
-					copy(newArr, arr.Elements[1:length])
-					return &Array{Elements: newArr}
-				}
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				newArr := make([]Object, length-1, length-1)
+				copy(newArr, arr.Elements[1:length])
+				return &Array{Elements: newArr}
+			}
 
-				return nil
-			},
+			return nil
 		},
 	},
 	{
 		"push",
-		&Builtin{
-			Fn: func(args ...Object) Object {
-				if len(args) != 2 {
-					return newError("wrong number of arguments. got=%d, want=2", len(args))
-				}
+		Exactly(2),
+		func(_ Host, args ...Object) Object {
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `push` must be ARRAY, got=%s", args[0].Type())
+			}
 
-				if args[0].Type() != ARRAY_OBJ {
-					return newError("argument to `push` must be ARRAY, got=%s", args[0].Type())
-				}
-
-				arr := args[0].(*Array)
-				length := len(arr.Elements)
-				newArr := make([]Object, length+1, length+1)
-				copy(newArr, arr.Elements)
-				newArr[length] = args[1]
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			newArr := make([]Object, length+1, length+1)
+			copy(newArr, arr.Elements)
+			newArr[length] = args[1]
 
-				return &Array{Elements: newArr}
-			},
+			return &Array{Elements: newArr}
+		},
+	},
+	{
+		"print",
+		AtLeast(0),
+		func(host Host, args ...Object) Object {
+			return printArgs(host.IO().Stdout, args)
+		},
+	},
+	{
+		"eprint",
+		AtLeast(0),
+		func(host Host, args ...Object) Object {
+			return printArgs(host.IO().Stderr, args)
+		},
+	},
+	{
+		"readline",
+		Exactly(0),
+		func(host Host, args ...Object) Object {
+			return readLine(host.IO())
+		},
+	},
+	{
+		"input",
+		Between(0, 1),
+		func(host Host, args ...Object) Object {
+			if len(args) == 1 {
+				prompt, ok := args[0].(*String)
+				if !ok {
+					return newError("argument to `input` must be STRING, got=%s", args[0].Type())
+				}
+				io.WriteString(host.IO().Stdout, prompt.Value)
+			}
+			return readLine(host.IO())
 		},
 	},
 }
 
-func GetBuiltinByName(name string) *Builtin {
-	for _, def := range Builtins {
-		if def.Name == name {
-			return def.Builtin
-		}
+// printArgs writes args separated by spaces and followed by a newline.
+// Strings are written without quotes, as by puts.
+func printArgs(w io.Writer, args []Object) Object {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.Inspect()
+	}
+	if _, err := fmt.Fprintln(w, strings.Join(parts, " ")); err != nil {
+		return newError("print: %s", err)
 	}
-
 	return nil
 }
 
+// readLine reads a line from stdin without its line ending, returning NULL
+// at the end of the input.
+func readLine(streams *IO) Object {
+	line, err := streams.Stdin.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return NULL
+	}
+	if err != nil && err != io.EOF {
+		return newError("readline: %s", err)
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return &String{Value: strings.TrimSuffix(line, "\r")}
+}
+
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
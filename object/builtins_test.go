@@ -0,0 +1,81 @@
+package object
+
+import "testing"
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	double := func(args ...Object) Object {
+		return &Integer{Value: args[0].(*Integer).Value * 2}
+	}
+
+	if err := r.Register("double", Exactly(1), double); err != nil {
+		t.Fatalf("register failed: %s", err)
+	}
+	if err := r.Register("double", Exactly(1), double); err == nil || err.Error() != "builtin double already registered" {
+		t.Errorf("wrong error for duplicate builtin. got=%v", err)
+	}
+
+	b, ok := r.Lookup("double")
+	if !ok || b.Name != "double" || b.Arity != Exactly(1) || r.Get(0) != b || r.Get(1) != nil {
+		t.Fatalf("wrong builtin: %+v", b)
+	}
+	if result := b.Fn(&Integer{Value: 21}); result.Inspect() != "42" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+	if result := b.Fn(); result.Inspect() != "ERROR: wrong number of arguments. got=0, want=1" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	for i := len(r.All()); i < MaxBuiltins; i++ {
+		r.Register(string(rune('a'+i%26))+string(rune('a'+i/26)), AtLeast(0), double)
+	}
+	if err := r.Register("one_too_many", AtLeast(0), double); err == nil {
+		t.Errorf("expected registering more than %d builtins to fail", MaxBuiltins)
+	}
+}
+
+func TestStandardRegistry(t *testing.T) {
+	r := NewStandardRegistry("puts", "push")
+	if _, ok := r.Lookup("puts"); ok {
+		t.Errorf("puts was not omitted")
+	}
+	if b, ok := r.Lookup("len"); !ok || r.Get(0) != b {
+		t.Errorf("len missing from standard registry")
+	}
+	n := 0
+	for _, defs := range standardLibrary {
+		n += len(defs)
+	}
+	if len(r.All()) != n-2 {
+		t.Errorf("wrong number of builtins. got=%d", len(r.All()))
+	}
+}
+
+func TestArity(t *testing.T) {
+	tests := []struct {
+		arity    Arity
+		accepts  []int
+		rejects  []int
+		expected string
+	}{
+		{Exactly(2), []int{2}, []int{1, 3}, "2"},
+		{AtLeast(1), []int{1, 5}, []int{0}, "at least 1"},
+		{Between(1, 3), []int{1, 2, 3}, []int{0, 4}, "1 to 3"},
+	}
+
+	for _, tt := range tests {
+		for _, n := range tt.accepts {
+			if !tt.arity.Accepts(n) {
+				t.Errorf("%s should accept %d arguments", tt.arity, n)
+			}
+		}
+		for _, n := range tt.rejects {
+			if tt.arity.Accepts(n) {
+				t.Errorf("%s should reject %d arguments", tt.arity, n)
+			}
+		}
+		if tt.arity.String() != tt.expected {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expected, tt.arity.String())
+		}
+	}
+}
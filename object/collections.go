@@ -0,0 +1,489 @@
+package object
+
+import (
+	"sort"
+	"strings"
+)
+
+// collectionBuiltins work on arrays, and where it makes sense on strings
+// and hashes. Functions called for each entry of a hash get its key and
+// value. None of them modify their arguments.
+var collectionBuiltins = []builtinDef{
+	{
+		"map",
+		Exactly(2),
+		func(host Host, args ...Object) Object {
+			result := []Object{}
+			err := callEach(host, "map", args[0], args[1], func(_ []Object, mapped Object) {
+				result = append(result, mapped)
+			})
+			if err != nil {
+				return err
+			}
+			return &Array{Elements: result}
+		},
+	},
+	{
+		"filter",
+		Exactly(2),
+		func(host Host, args ...Object) Object {
+			if _, ok := args[0].(*Hash); ok {
+				result := NewHash()
+				err := callEach(host, "filter", args[0], args[1], func(entry []Object, keep Object) {
+					if truthy(keep) {
+						result.Set(entry[0].(Hashable), entry[1])
+					}
+				})
+				if err != nil {
+					return err
+				}
+				return result
+			}
+
+			result := []Object{}
+			err := callEach(host, "filter", args[0], args[1], func(entry []Object, keep Object) {
+				if truthy(keep) {
+					result = append(result, entry[0])
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return &Array{Elements: result}
+		},
+	},
+	{
+		"reduce",
+		Between(2, 3),
+		func(host Host, args ...Object) Object {
+			arr, err := arrayArg("reduce", args, 0)
+			if err != nil {
+				return err
+			}
+
+			elems := arr.Elements
+			var acc Object
+			if len(args) == 3 {
+				acc = args[2]
+			} else if len(elems) > 0 {
+				acc, elems = elems[0], elems[1:]
+			} else {
+				return newError("`reduce` of empty ARRAY with no initial value")
+			}
+
+			for _, elem := range elems {
+				acc = host.Call(args[1], acc, elem)
+				if isError(acc) {
+					return acc
+				}
+			}
+			return acc
+		},
+	},
+	{
+		"each",
+		Exactly(2),
+		func(host Host, args ...Object) Object {
+			return callEach(host, "each", args[0], args[1], func([]Object, Object) {})
+		},
+	},
+	{
+		"range",
+		Between(1, 3),
+		func(_ Host, args ...Object) Object {
+			bounds := make([]int64, len(args))
+			for i := range args {
+				n, err := integerArg("range", args, i)
+				if err != nil {
+					return err
+				}
+				bounds[i] = n
+			}
+
+			start, stop, step := int64(0), bounds[0], int64(1)
+			if len(bounds) > 1 {
+				start, stop = bounds[0], bounds[1]
+			}
+			if len(bounds) > 2 {
+				step = bounds[2]
+			}
+			if step == 0 {
+				return newError("`range` step must not be 0")
+			}
+
+			// in unsigned arithmetic, which holds any distance between
+			// two integers
+			var n uint64
+			if step > 0 && start < stop {
+				n = (uint64(stop)-uint64(start)-1)/uint64(step) + 1
+			} else if step < 0 && start > stop {
+				n = (uint64(start)-uint64(stop)-1)/uint64(-step) + 1
+			}
+			if n > maxLength {
+				return newError("`range` would have more than %d elements, got=%d", maxLength, n)
+			}
+
+			result := make([]Object, n)
+			for i := range result {
+				result[i] = &Integer{Value: start + int64(i)*step}
+			}
+			return &Array{Elements: result}
+		},
+	},
+	{
+		"zip",
+		AtLeast(1),
+		func(_ Host, args ...Object) Object {
+			arrays := make([]*Array, len(args))
+			n := -1
+			for i := range args {
+				arr, err := arrayArg("zip", args, i)
+				if err != nil {
+					return err
+				}
+				arrays[i] = arr
+				if n == -1 || len(arr.Elements) < n {
+					n = len(arr.Elements)
+				}
+			}
+
+			result := make([]Object, n)
+			for i := range result {
+				tuple := make([]Object, len(arrays))
+				for j, arr := range arrays {
+					tuple[j] = arr.Elements[i]
+				}
+				result[i] = &Array{Elements: tuple}
+			}
+			return &Array{Elements: result}
+		},
+	},
+	{
+		"enumerate",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			arr, err := arrayArg("enumerate", args, 0)
+			if err != nil {
+				return err
+			}
+
+			result := make([]Object, len(arr.Elements))
+			for i, elem := range arr.Elements {
+				result[i] = &Array{Elements: []Object{&Integer{Value: int64(i)}, elem}}
+			}
+			return &Array{Elements: result}
+		},
+	},
+	{
+		"sort",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			arr, err := arrayArg("sort", args, 0)
+			if err != nil {
+				return err
+			}
+			return sortByKeys("sort", arr.Elements, arr.Elements)
+		},
+	},
+	{
+		"sort_by",
+		Exactly(2),
+		func(host Host, args ...Object) Object {
+			arr, err := arrayArg("sort_by", args, 0)
+			if err != nil {
+				return err
+			}
+
+			keys := make([]Object, len(arr.Elements))
+			for i, elem := range arr.Elements {
+				keys[i] = host.Call(args[1], elem)
+				if isError(keys[i]) {
+					return keys[i]
+				}
+			}
+			return sortByKeys("sort_by", arr.Elements, keys)
+		},
+	},
+	{
+		"reverse",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			switch arg := args[0].(type) {
+			case *Array:
+				n := len(arg.Elements)
+				result := make([]Object, n)
+				for i, elem := range arg.Elements {
+					result[n-1-i] = elem
+				}
+				return &Array{Elements: result}
+			case *String:
+				runes := []rune(arg.Value)
+				for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+					runes[i], runes[j] = runes[j], runes[i]
+				}
+				return &String{Value: string(runes)}
+			default:
+				return argTypeError("reverse", 0, "ARRAY or STRING", arg)
+			}
+		},
+	},
+	{
+		"slice",
+		Between(2, 3),
+		func(_ Host, args ...Object) Object {
+			switch arg := args[0].(type) {
+			case *Array:
+				start, end, err := sliceBounds("slice", args, int64(len(arg.Elements)))
+				if err != nil {
+					return err
+				}
+				result := make([]Object, end-start)
+				copy(result, arg.Elements[start:end])
+				return &Array{Elements: result}
+			case *String:
+				return substring("slice", arg, args)
+			default:
+				return argTypeError("slice", 0, "ARRAY or STRING", arg)
+			}
+		},
+	},
+	{
+		"contains",
+		Exactly(2),
+		func(_ Host, args ...Object) Object {
+			switch arg := args[0].(type) {
+			case *Array:
+				return NativeBool(indexOf(arg.Elements, args[1]) >= 0)
+			case *String:
+				sub, ok := args[1].(*String)
+				if !ok {
+					return argTypeError("contains", 1, "STRING", args[1])
+				}
+				return NativeBool(strings.Contains(arg.Value, sub.Value))
+			case *Hash:
+				key, ok := AsHashable(args[1])
+				if !ok {
+					return newError("not hashable: %s", args[1].Type())
+				}
+				_, ok = arg.Get(key)
+				return NativeBool(ok)
+			default:
+				return argTypeError("contains", 0, "ARRAY, STRING or HASH", arg)
+			}
+		},
+	},
+	{
+		"index_of",
+		Exactly(2),
+		func(_ Host, args ...Object) Object {
+			switch arg := args[0].(type) {
+			case *Array:
+				return &Integer{Value: int64(indexOf(arg.Elements, args[1]))}
+			case *String:
+				sub, ok := args[1].(*String)
+				if !ok {
+					return argTypeError("index_of", 1, "STRING", args[1])
+				}
+				return &Integer{Value: int64(runeIndex(arg.Value, sub.Value))}
+			default:
+				return argTypeError("index_of", 0, "ARRAY or STRING", arg)
+			}
+		},
+	},
+	{
+		"flatten",
+		Between(1, 2),
+		func(_ Host, args ...Object) Object {
+			arr, err := arrayArg("flatten", args, 0)
+			if err != nil {
+				return err
+			}
+			depth := int64(1)
+			if len(args) == 2 {
+				if depth, err = integerArg("flatten", args, 1); err != nil {
+					return err
+				}
+			}
+			return &Array{Elements: flatten([]Object{}, arr.Elements, depth)}
+		},
+	},
+	{
+		"uniq",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			arr, err := arrayArg("uniq", args, 0)
+			if err != nil {
+				return err
+			}
+
+			seen := make(map[HashKey]bool)
+			result := []Object{}
+			for _, elem := range arr.Elements {
+				if key, ok := AsHashable(elem); ok {
+					if seen[key.HashKey()] {
+						continue
+					}
+					seen[key.HashKey()] = true
+				} else if indexOf(result, elem) >= 0 {
+					continue
+				}
+				result = append(result, elem)
+			}
+			return &Array{Elements: result}
+		},
+	},
+}
+
+// argTypeError reports that argument i of the builtin name, counting from
+// 0, is not of the type want.
+func argTypeError(name string, i int, want string, got Object) *Error {
+	if i == 0 {
+		return newError("argument to `%s` must be %s, got=%s", name, want, got.Type())
+	}
+	return newError("argument %d to `%s` must be %s, got=%s", i+1, name, want, got.Type())
+}
+
+func arrayArg(name string, args []Object, i int) (*Array, *Error) {
+	arr, ok := args[i].(*Array)
+	if !ok {
+		return nil, argTypeError(name, i, "ARRAY", args[i])
+	}
+	return arr, nil
+}
+
+func integerArg(name string, args []Object, i int) (int64, *Error) {
+	n, ok := args[i].(*Integer)
+	if !ok {
+		return 0, argTypeError(name, i, "INTEGER", args[i])
+	}
+	return n.Value, nil
+}
+
+// callEach calls fn with each element of the array or each key and value
+// of the hash coll, passing visit the arguments and result of each call. It
+// returns the first error, from fn or for an argument of the builtin name.
+func callEach(host Host, name string, coll, fn Object, visit func(args []Object, result Object)) Object {
+	var calls [][]Object
+	switch coll := coll.(type) {
+	case *Array:
+		for _, elem := range coll.Elements {
+			calls = append(calls, []Object{elem})
+		}
+	case *Hash:
+		for _, pair := range coll.Items() {
+			calls = append(calls, []Object{pair.Key, pair.Value})
+		}
+	default:
+		return argTypeError(name, 0, "ARRAY or HASH", coll)
+	}
+
+	for _, args := range calls {
+		result := host.Call(fn, args...)
+		if isError(result) {
+			return result
+		}
+		visit(args, result)
+	}
+	return nil
+}
+
+func isError(obj Object) bool {
+	_, ok := obj.(*Error)
+	return ok
+}
+
+// truthy reports whether obj counts as true in a condition.
+func truthy(obj Object) bool {
+	return obj != nil && obj != NULL && obj != FALSE
+}
+
+// indexOf returns the index of the first element of elems equal to x, or
+// -1 if there is none.
+func indexOf(elems []Object, x Object) int {
+	for i, elem := range elems {
+		if Equal(elem, x) {
+			return i
+		}
+	}
+	return -1
+}
+
+// clampIndex resolves i, which counts from the end of a sequence of length
+// n if negative, to an index from 0 to n.
+func clampIndex(i, n int64) int64 {
+	if i < 0 {
+		i += n
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
+// sliceBounds returns the bounds given by args[1] and the optional args[2]
+// of the builtin name, resolved by clampIndex for a sequence of length n.
+func sliceBounds(name string, args []Object, n int64) (int64, int64, *Error) {
+	start, err := integerArg(name, args, 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	end := n
+	if len(args) == 3 {
+		if end, err = integerArg(name, args, 2); err != nil {
+			return 0, 0, err
+		}
+	}
+	start, end = clampIndex(start, n), clampIndex(end, n)
+	if end < start {
+		end = start
+	}
+	return start, end, nil
+}
+
+// flatten appends elems to dst, replacing arrays nested up to depth levels
+// by their elements.
+func flatten(dst, elems []Object, depth int64) []Object {
+	for _, elem := range elems {
+		if arr, ok := elem.(*Array); ok && depth > 0 {
+			dst = flatten(dst, arr.Elements, depth-1)
+		} else {
+			dst = append(dst, elem)
+		}
+	}
+	return dst
+}
+
+// sortByKeys returns elems sorted by keys, the key of each element, which
+// must be all integers or all strings. The sort is stable.
+func sortByKeys(name string, elems, keys []Object) Object {
+	for _, key := range keys {
+		if key.Type() != INTEGER_OBJ && key.Type() != STRING_OBJ {
+			return newError("`%s` cannot compare %s", name, key.Type())
+		}
+		if key.Type() != keys[0].Type() {
+			return newError("`%s` cannot compare %s and %s", name, keys[0].Type(), key.Type())
+		}
+	}
+
+	order := make([]int, len(elems))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		switch a := keys[order[i]].(type) {
+		case *Integer:
+			return a.Value < keys[order[j]].(*Integer).Value
+		default:
+			return a.(*String).Value < keys[order[j]].(*String).Value
+		}
+	})
+
+	result := make([]Object, len(elems))
+	for i, j := range order {
+		result[i] = elems[j]
+	}
+	return &Array{Elements: result}
+}
@@ -1,8 +1,36 @@
 package object
 
+import "github.com/tneuqole/monkey-go/ast"
+
+// EvalHook is called by the evaluator before it evaluates each node, with
+// the environment it is evaluated in. Returning an error stops evaluation
+// with that error.
+type EvalHook func(node ast.Node, env *Environment) error
+
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+
+	// set on the global environment of a module
+	path    string
+	modules *Modules
+
+	// set on the global environment, nil for the standard builtins and
+	// streams
+	builtins *Registry
+	io       *IO
+	hook     EvalHook
+}
+
+// Modules caches the modules imported by a program by path. Loading is the
+// chain of imports in progress, used to detect cycles.
+type Modules struct {
+	Loaded  map[string]*Module
+	Loading []string
+}
+
+func NewModules() *Modules {
+	return &Modules{Loaded: make(map[string]*Module)}
 }
 
 func NewEnvironment() *Environment {
@@ -10,12 +38,96 @@ func NewEnvironment() *Environment {
 	return &Environment{store: s}
 }
 
+// NewEnvironmentWithBuiltins returns a global environment in which
+// identifiers not otherwise defined resolve to the builtins of r.
+func NewEnvironmentWithBuiltins(r *Registry) *Environment {
+	env := NewEnvironment()
+	env.builtins = r
+	return env
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
 	return env
 }
 
+// NewModuleEnvironment returns the global environment of the module at
+// path imported from env, which shares its modules, builtins, streams and
+// hook.
+func NewModuleEnvironment(path string, env *Environment) *Environment {
+	_, modules := env.Module()
+	mod := NewEnvironmentWithBuiltins(env.Builtins())
+	mod.io = env.IO()
+	mod.hook = env.Hook()
+	mod.path = path
+	mod.modules = modules
+	return mod
+}
+
+// Module returns the path of the module env belongs to, empty for the main
+// program, and the modules of the program.
+func (e *Environment) Module() (string, *Modules) {
+	for e.outer != nil {
+		e = e.outer
+	}
+
+	if e.modules == nil {
+		e.modules = NewModules()
+	}
+	return e.path, e.modules
+}
+
+// Builtins returns the builtins of the program env belongs to.
+func (e *Environment) Builtins() *Registry {
+	for e.outer != nil {
+		e = e.outer
+	}
+
+	if e.builtins == nil {
+		e.builtins = NewStandardRegistry()
+	}
+	return e.builtins
+}
+
+// SetIO sets the streams of the program env belongs to.
+func (e *Environment) SetIO(streams *IO) {
+	for e.outer != nil {
+		e = e.outer
+	}
+	e.io = streams
+}
+
+// IO returns the streams of the program env belongs to, by default those of
+// the process.
+func (e *Environment) IO() *IO {
+	for e.outer != nil {
+		e = e.outer
+	}
+
+	if e.io == nil {
+		return StdIO()
+	}
+	return e.io
+}
+
+// SetHook sets the hook of the program env belongs to. A nil hook removes
+// it.
+func (e *Environment) SetHook(hook EvalHook) {
+	for e.outer != nil {
+		e = e.outer
+	}
+	e.hook = hook
+}
+
+// Hook returns the hook of the program env belongs to, or nil.
+func (e *Environment) Hook() EvalHook {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e.hook
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 	if !ok && e.outer != nil {
@@ -0,0 +1,124 @@
+package object
+
+// hashBuiltins work on hashes, in the order of their keys. None of them
+// modify their arguments.
+var hashBuiltins = []builtinDef{
+	{
+		"keys",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			hash, err := hashArg("keys", args, 0)
+			if err != nil {
+				return err
+			}
+
+			items := hash.Items()
+			result := make([]Object, len(items))
+			for i, pair := range items {
+				result[i] = pair.Key
+			}
+			return &Array{Elements: result}
+		},
+	},
+	{
+		"values",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			hash, err := hashArg("values", args, 0)
+			if err != nil {
+				return err
+			}
+
+			items := hash.Items()
+			result := make([]Object, len(items))
+			for i, pair := range items {
+				result[i] = pair.Value
+			}
+			return &Array{Elements: result}
+		},
+	},
+	{
+		"items",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			hash, err := hashArg("items", args, 0)
+			if err != nil {
+				return err
+			}
+
+			items := hash.Items()
+			result := make([]Object, len(items))
+			for i, pair := range items {
+				result[i] = &Array{Elements: []Object{pair.Key, pair.Value}}
+			}
+			return &Array{Elements: result}
+		},
+	},
+	{
+		"has_key",
+		Exactly(2),
+		func(_ Host, args ...Object) Object {
+			hash, err := hashArg("has_key", args, 0)
+			if err != nil {
+				return err
+			}
+			key, ok := AsHashable(args[1])
+			if !ok {
+				return newError("not hashable: %s", args[1].Type())
+			}
+			_, ok = hash.Get(key)
+			return NativeBool(ok)
+		},
+	},
+	{
+		"delete",
+		Exactly(2),
+		func(_ Host, args ...Object) Object {
+			hash, err := hashArg("delete", args, 0)
+			if err != nil {
+				return err
+			}
+			key, ok := AsHashable(args[1])
+			if !ok {
+				return newError("not hashable: %s", args[1].Type())
+			}
+
+			result := copyHash(hash)
+			result.Delete(key)
+			return result
+		},
+	},
+	{
+		"merge",
+		AtLeast(1),
+		func(_ Host, args ...Object) Object {
+			result := NewHash()
+			for i := range args {
+				hash, err := hashArg("merge", args, i)
+				if err != nil {
+					return err
+				}
+				for _, pair := range hash.Items() {
+					result.Set(pair.Key.(Hashable), pair.Value)
+				}
+			}
+			return result
+		},
+	},
+}
+
+func hashArg(name string, args []Object, i int) (*Hash, *Error) {
+	hash, ok := args[i].(*Hash)
+	if !ok {
+		return nil, argTypeError(name, i, "HASH", args[i])
+	}
+	return hash, nil
+}
+
+func copyHash(hash *Hash) *Hash {
+	result := NewHash()
+	for _, pair := range hash.Items() {
+		result.Set(pair.Key.(Hashable), pair.Value)
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// IO is the standard streams of a running program, which builtins like
+// puts and readline use instead of the process's own.
+type IO struct {
+	Stdin  *bufio.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewIO returns streams reading from stdin and writing to stdout and
+// stderr. A nil stdin is always at EOF and nil writers discard output.
+func NewIO(stdin io.Reader, stdout, stderr io.Writer) *IO {
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	return &IO{Stdin: bufio.NewReader(stdin), Stdout: stdout, Stderr: stderr}
+}
+
+var (
+	stdioOnce sync.Once
+	stdio     *IO
+)
+
+// StdIO returns the streams of the process. Every program using them shares
+// one buffered reader of os.Stdin, and output goes to whatever os.Stdout and
+// os.Stderr are when it is written.
+func StdIO() *IO {
+	stdioOnce.Do(func() {
+		stdio = &IO{
+			Stdin:  bufio.NewReader(os.Stdin),
+			Stdout: fileWriter{&os.Stdout},
+			Stderr: fileWriter{&os.Stderr},
+		}
+	})
+	return stdio
+}
+
+type fileWriter struct{ f **os.File }
+
+func (w fileWriter) Write(p []byte) (int, error) {
+	return (*w.f).Write(p)
+}
+
+// Host is the evaluator or VM running a builtin.
+type Host interface {
+	// Call calls fn, a function or builtin, with args and returns its
+	// result, or an ERROR if the call failed. A builtin should return such
+	// an error as its own result. Call is only valid until the builtin
+	// returns.
+	Call(fn Object, args ...Object) Object
+	// Try is like Call, but a failure is only returned, so the builtin can
+	// recover from it.
+	Try(fn Object, args ...Object) Object
+	// IO returns the streams of the running program.
+	IO() *IO
+}
+
+// defaultHost stands in for a Host outside the evaluator and VM. It can
+// only call builtins and uses the process's streams.
+type defaultHost struct{}
+
+func (defaultHost) Call(fn Object, args ...Object) Object {
+	if b, ok := fn.(*Builtin); ok {
+		return b.Call(nil, args...)
+	}
+	return newError("cannot call %s outside a running program", fn.Type())
+}
+
+func (h defaultHost) Try(fn Object, args ...Object) Object { return h.Call(fn, args...) }
+
+func (defaultHost) IO() *IO { return StdIO() }
@@ -0,0 +1,193 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxJSONIndent is the most spaces or characters json_stringify indents by.
+const maxJSONIndent = 10
+
+// jsonBuiltins convert between JSON text and objects. JSON objects become
+// hashes with their keys in document order.
+var jsonBuiltins = []builtinDef{
+	{
+		"json_parse",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			s, err := stringArg("json_parse", args, 0)
+			if err != nil {
+				return err
+			}
+
+			dec := json.NewDecoder(strings.NewReader(s))
+			dec.UseNumber()
+			obj, parseErr := parseJSON(dec)
+			if parseErr == nil {
+				if _, tokenErr := dec.Token(); tokenErr != io.EOF {
+					parseErr = errors.New("invalid character after top-level value")
+				}
+			}
+			if parseErr != nil {
+				return newError("json_parse: %s", parseErr)
+			}
+			return obj
+		},
+	},
+	{
+		"json_stringify",
+		Between(1, 2),
+		func(_ Host, args ...Object) Object {
+			indent := ""
+			if len(args) == 2 {
+				switch arg := args[1].(type) {
+				case *Integer:
+					if arg.Value < 0 {
+						return newError("`json_stringify` indent must not be negative, got=%d", arg.Value)
+					}
+					// at most 10 spaces or characters, as in JavaScript
+					indent = strings.Repeat(" ", int(min(arg.Value, maxJSONIndent)))
+				case *String:
+					indent = arg.Value
+					if runes := []rune(indent); len(runes) > maxJSONIndent {
+						indent = string(runes[:maxJSONIndent])
+					}
+				default:
+					return argTypeError("json_stringify", 1, "INTEGER or STRING", arg)
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := writeJSON(&buf, args[0]); err != nil {
+				return newError("json_stringify: %s", err)
+			}
+			if indent == "" {
+				return &String{Value: buf.String()}
+			}
+
+			var out bytes.Buffer
+			if err := json.Indent(&out, buf.Bytes(), "", indent); err != nil {
+				return newError("json_stringify: %s", err)
+			}
+			return &String{Value: out.String()}
+		},
+	},
+}
+
+// parseJSON reads the next value from dec.
+func parseJSON(dec *json.Decoder) (Object, error) {
+	token, err := dec.Token()
+	if err == io.EOF {
+		return nil, errors.New("unexpected end of JSON input")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		return NativeBool(token), nil
+	case string:
+		return &String{Value: token}, nil
+	case json.Number:
+		n, err := strconv.ParseInt(string(token), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("number %s is not an integer", token)
+		}
+		return &Integer{Value: n}, nil
+	case json.Delim:
+		if token == '[' {
+			elements := []Object{}
+			for dec.More() {
+				elem, err := parseJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, elem)
+			}
+			_, err := dec.Token()
+			return &Array{Elements: elements}, err
+		}
+
+		hash := NewHash()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := parseJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(&String{Value: key.(string)}, value)
+		}
+		_, err := dec.Token()
+		return hash, err
+	default:
+		return nil, fmt.Errorf("unexpected %v", token)
+	}
+}
+
+// writeJSON writes obj to buf as compact JSON. Hash keys must be strings or
+// integers, which are written as strings.
+func writeJSON(buf *bytes.Buffer, obj Object) error {
+	switch obj := obj.(type) {
+	case *Null:
+		buf.WriteString("null")
+	case *Boolean:
+		buf.WriteString(strconv.FormatBool(obj.Value))
+	case *Integer:
+		buf.WriteString(strconv.FormatInt(obj.Value, 10))
+	case *String:
+		writeJSONString(buf, obj.Value)
+	case *Array:
+		buf.WriteByte('[')
+		for i, elem := range obj.Elements {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case *Hash:
+		buf.WriteByte('{')
+		for i, pair := range obj.Items() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			switch key := pair.Key.(type) {
+			case *String:
+				writeJSONString(buf, key.Value)
+			case *Integer:
+				writeJSONString(buf, strconv.FormatInt(key.Value, 10))
+			default:
+				return fmt.Errorf("cannot use %s as object key", key.Type())
+			}
+			buf.WriteByte(':')
+			if err := writeJSON(buf, pair.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("cannot serialize %s", obj.Type())
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// Encode ends every value with a newline
+	buf.Truncate(buf.Len() - 1)
+}
@@ -0,0 +1,63 @@
+package object
+
+import (
+	"strings"
+	"testing"
+)
+
+func callBuiltin(name string, args ...Object) Object {
+	b, _ := NewStandardRegistry().Lookup(name)
+	return b.Call(nil, args...)
+}
+
+func TestJSONParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": [1, -2, true, null], "a": {"x": "y\né"}}`, "{b: [1, -2, true, null],a: {x: y\né}}"},
+		{` "hi" `, "hi"},
+		{`[]`, "[]"},
+		{`{}`, "{}"},
+		{`1.5`, "ERROR: json_parse: number 1.5 is not an integer"},
+		{`99999999999999999999`, "ERROR: json_parse: number 99999999999999999999 is not an integer"},
+		{`{"a" 1}`, "ERROR: json_parse: invalid character '1' after object key"},
+		{`[1 2]`, "ERROR: json_parse: invalid character '2' after array element"},
+		{`[1, 2`, "ERROR: json_parse: unexpected end of JSON input"},
+		{``, "ERROR: json_parse: unexpected end of JSON input"},
+		{`1 2`, "ERROR: json_parse: invalid character after top-level value"},
+	}
+
+	for _, tt := range tests {
+		result := callBuiltin("json_parse", str(tt.input))
+		if result.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestJSONStringify(t *testing.T) {
+	tests := []struct {
+		args     []Object
+		expected string
+	}{
+		{[]Object{hashOf(str("b"), num(1), num(2), &Array{Elements: []Object{TRUE, NULL}})}, `{"b":1,"2":[true,null]}`},
+		{[]Object{str("<\"é\">\n")}, `"<\"é\">\n"`},
+		{[]Object{&Array{Elements: []Object{num(1), hashOf(str("a"), num(2))}}, num(2)}, "[\n  1,\n  {\n    \"a\": 2\n  }\n]"},
+		{[]Object{&Array{Elements: []Object{num(1)}}, str("\t")}, "[\n\t1\n]"},
+		{[]Object{&Array{Elements: []Object{num(1)}}, str("é-" + strings.Repeat(" ", 40))}, "[\n" + "é-" + strings.Repeat(" ", 8) + "1\n]"},
+		{[]Object{&Array{Elements: []Object{}}, num(2)}, "[]"},
+		{[]Object{&Array{Elements: []Object{num(1)}}, num(1 << 62)}, "[\n          1\n]"},
+		{[]Object{hashOf(TRUE, num(1))}, "ERROR: json_stringify: cannot use BOOLEAN as object key"},
+		{[]Object{&Array{Elements: []Object{&Builtin{Name: "len"}}}}, "ERROR: json_stringify: cannot serialize BUILTIN"},
+		{[]Object{num(1), num(-1)}, "ERROR: `json_stringify` indent must not be negative, got=-1"},
+		{[]Object{num(1), TRUE}, "ERROR: argument 2 to `json_stringify` must be INTEGER or STRING, got=BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		result := callBuiltin("json_stringify", tt.args...)
+		if result.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.args[0].Inspect(), tt.expected, result.Inspect())
+		}
+	}
+}
@@ -0,0 +1,548 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	hostType   = reflect.TypeOf((*Host)(nil)).Elem()
+)
+
+// ToObject converts a Go value to a Monkey object:
+//
+//   - Objects are returned as is, and nil as NULL
+//   - bools, integers and strings become BOOLEAN, INTEGER and STRING
+//   - slices and arrays become ARRAY, and []byte becomes STRING
+//   - maps with bool, integer or string keys become HASH
+//   - structs become a HASH keyed by field name, or by the name in a
+//     `monkey:"name"` tag; fields tagged `monkey:"-"` and unexported fields
+//     are left out
+//   - pointers and interfaces are converted by their value, or are NULL
+//   - funcs become BUILTIN as described for Registry.RegisterFunc
+//
+// Other values, like floats and channels, cannot be converted.
+func ToObject(v interface{}) (Object, error) {
+	if v == nil {
+		return NULL, nil
+	}
+	return toObject(reflect.ValueOf(v))
+}
+
+func toObject(v reflect.Value) (Object, error) {
+	if v.Type().Implements(objectType) {
+		if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+			return NULL, nil
+		}
+		return v.Interface().(Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return NativeBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows INTEGER", v.Uint())
+		}
+		return &Integer{Value: int64(v.Uint())}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Slice {
+				return &String{Value: string(v.Bytes())}, nil
+			}
+			return &String{Value: string(v.Slice(0, v.Len()).Bytes())}, nil
+		}
+
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			elem, err := toObject(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			elements[i] = elem
+		}
+		return &Array{Elements: elements}, nil
+	case reflect.Map:
+		// Go maps have no order, so keys are added sorted
+		var pairs []HashPair
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := toObject(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := AsHashable(key)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := toObject(iter.Value())
+			if err != nil {
+				return nil, fmt.Errorf("[%v]: %w", iter.Key(), err)
+			}
+			pairs = append(pairs, HashPair{Key: hashable, Value: value})
+		}
+		sort.Slice(pairs, func(i, j int) bool { return keyLess(pairs[i].Key, pairs[j].Key) })
+		hash := NewHash()
+		for _, pair := range pairs {
+			hash.Set(pair.Key.(Hashable), pair.Value)
+		}
+		return hash, nil
+	case reflect.Struct:
+		hash := NewHash()
+		for _, f := range structFields(v.Type()) {
+			value, err := toObject(v.Field(f.index))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.name, err)
+			}
+			hash.Set(&String{Value: f.name}, value)
+		}
+		return hash, nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return toObject(v.Elem())
+	case reflect.Func:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return newFuncBuiltin("func", v)
+	}
+
+	return nil, fmt.Errorf("cannot convert %s to an object", v.Type())
+}
+
+// FromObject stores the Go value of obj in the value v points to, following
+// the rules of ToObject in reverse. Hash keys that match no struct field are
+// ignored, and NULL sets pointers, slices, maps and interfaces to nil. An
+// empty interface receives the natural Go value of obj: int64, string, bool,
+// nil, []interface{}, map[string]interface{} for hashes with string keys
+// and map[interface{}]interface{} for others, which cannot have ARRAY
+// keys. A BUILTIN can be stored in a
+// func variable, as can functions passed to a func registered with
+// RegisterFunc.
+func FromObject(obj Object, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("FromObject needs a non-nil pointer, got %T", v)
+	}
+	return fromObject(obj, rv.Elem(), nil)
+}
+
+func fromObject(obj Object, dst reflect.Value, host Host) error {
+	t := dst.Type()
+	if obj == nil {
+		obj = NULL
+	}
+
+	if t.Kind() == reflect.Interface {
+		switch {
+		case t.NumMethod() == 0:
+			v, err := nativeValue(obj)
+			if err != nil {
+				return err
+			}
+			if v != nil {
+				dst.Set(reflect.ValueOf(v))
+			} else {
+				dst.Set(reflect.Zero(t))
+			}
+		case reflect.TypeOf(obj).AssignableTo(t):
+			dst.Set(reflect.ValueOf(obj))
+		default:
+			return cannotConvert(obj, t)
+		}
+		return nil
+	}
+
+	if _, ok := obj.(*Null); ok {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Func:
+			dst.Set(reflect.Zero(t))
+			return nil
+		}
+		return cannotConvert(obj, t)
+	}
+
+	if reflect.TypeOf(obj).AssignableTo(t) {
+		dst.Set(reflect.ValueOf(obj))
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*Boolean)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		dst.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*Integer)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		if dst.OverflowInt(i.Value) {
+			return fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		dst.SetInt(i.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := obj.(*Integer)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		if i.Value < 0 || dst.OverflowUint(uint64(i.Value)) {
+			return fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		dst.SetUint(uint64(i.Value))
+	case reflect.String:
+		s, ok := obj.(*String)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		dst.SetString(s.Value)
+	case reflect.Slice:
+		if s, ok := obj.(*String); ok && t.Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes([]byte(s.Value))
+			return nil
+		}
+		arr, ok := obj.(*Array)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		slice := reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+		for i, elem := range arr.Elements {
+			if err := fromObject(elem, slice.Index(i), host); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		dst.Set(slice)
+	case reflect.Array:
+		arr, ok := obj.(*Array)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		if len(arr.Elements) != t.Len() {
+			return fmt.Errorf("cannot convert ARRAY of length %d to %s", len(arr.Elements), t)
+		}
+		for i, elem := range arr.Elements {
+			if err := fromObject(elem, dst.Index(i), host); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+	case reflect.Map:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		m := reflect.MakeMapWithSize(t, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			key := reflect.New(t.Key()).Elem()
+			if err := fromObject(pair.Key, key, host); err != nil {
+				return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := fromObject(pair.Value, value, host); err != nil {
+				return fmt.Errorf("[%s]: %w", pair.Key.Inspect(), err)
+			}
+			m.SetMapIndex(key, value)
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		for _, f := range structFields(t) {
+			pair, ok := hash.Pairs[(&String{Value: f.name}).HashKey()]
+			if !ok {
+				continue
+			}
+			if err := fromObject(pair.Value, dst.Field(f.index), host); err != nil {
+				return fmt.Errorf("%s: %w", f.name, err)
+			}
+		}
+	case reflect.Pointer:
+		ptr := reflect.New(t.Elem())
+		if err := fromObject(obj, ptr.Elem(), host); err != nil {
+			return err
+		}
+		dst.Set(ptr)
+	case reflect.Func:
+		var callee BuiltinFunction
+		switch fn := obj.(type) {
+		case *Builtin:
+			callee = func(args ...Object) Object { return fn.Call(host, args...) }
+		default:
+			if host == nil || (obj.Type() != CLOSURE_OBJ && obj.Type() != FUNCTION_OBJ) {
+				return cannotConvert(obj, t)
+			}
+			callee = func(args ...Object) Object { return host.Call(obj, args...) }
+		}
+		fn, err := goFunc(callee, t, host)
+		if err != nil {
+			return err
+		}
+		dst.Set(fn)
+	default:
+		return cannotConvert(obj, t)
+	}
+
+	return nil
+}
+
+func cannotConvert(obj Object, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %s to %s", obj.Type(), t)
+}
+
+// nativeValue returns the Go value an empty interface receives for obj. A
+// hash with array keys has none, as slices cannot be map keys.
+func nativeValue(obj Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Null:
+		return nil, nil
+	case *Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, elem := range obj.Elements {
+			v, err := nativeValue(elem)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			elements[i] = v
+		}
+		return elements, nil
+	case *Hash:
+		strs := make(map[string]interface{}, len(obj.Pairs))
+		others := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			if _, ok := pair.Key.(*Array); ok {
+				return nil, fmt.Errorf("cannot convert %s key %s to a map key", pair.Key.Type(), pair.Key.Inspect())
+			}
+			key, err := nativeValue(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := nativeValue(pair.Value)
+			if err != nil {
+				return nil, fmt.Errorf("[%s]: %w", pair.Key.Inspect(), err)
+			}
+			if s, ok := key.(string); ok && strs != nil {
+				strs[s] = value
+			} else {
+				strs = nil
+			}
+			others[key] = value
+		}
+		if strs != nil {
+			return strs, nil
+		}
+		return others, nil
+	default:
+		return obj, nil
+	}
+}
+
+type structField struct {
+	name  string
+	index int
+}
+
+// structFields returns the fields of struct type t that are converted to
+// and from hash pairs.
+func structFields(t reflect.Type) []structField {
+	fields := []structField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("monkey"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{name: name, index: i})
+	}
+	return fields
+}
+
+// RegisterFunc adds a builtin called name that calls the Go function fn,
+// converting its arguments with FromObject and its result with ToObject.
+// The number of arguments accepted comes from fn's signature, and calls
+// with arguments that do not convert return an error without calling fn.
+// Functions passed to fn can be converted to Go funcs, which may only be
+// called until fn returns. If the first parameter of fn is a Host, it
+// receives the evaluator or VM running the builtin.
+//
+// fn may return nothing, a value, an error, or a value and an error; a
+// non-nil error is returned to the program as an ERROR. A panic in fn is
+// also turned into an ERROR.
+func (r *Registry) RegisterFunc(name string, fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return fmt.Errorf("cannot register %s: %T is not a func", name, fn)
+	}
+
+	b, err := newFuncBuiltin(name, v)
+	if err != nil {
+		return fmt.Errorf("cannot register %s: %w", name, err)
+	}
+	return r.RegisterHost(name, b.Arity, b.HostFn)
+}
+
+// newFuncBuiltin returns a builtin calling fn, which checks the number of
+// arguments itself.
+func newFuncBuiltin(name string, fn reflect.Value) (*Builtin, error) {
+	t := fn.Type()
+	if err := checkResults(t); err != nil {
+		return nil, err
+	}
+
+	// parameters before the converted arguments
+	skip := 0
+	if t.NumIn() > 0 && t.In(0) == hostType {
+		skip = 1
+	}
+
+	arity := Exactly(t.NumIn() - skip)
+	if t.IsVariadic() {
+		arity = AtLeast(t.NumIn() - skip - 1)
+	}
+
+	wrapper := func(host Host, args ...Object) (result Object) {
+		defer func() {
+			if r := recover(); r != nil {
+				result = newError("`%s` panicked: %v", name, r)
+			}
+		}()
+
+		if !arity.Accepts(len(args)) {
+			return wrongArguments(len(args), arity)
+		}
+
+		in := make([]reflect.Value, skip, skip+len(args))
+		if skip == 1 {
+			in[0] = reflect.ValueOf(&host).Elem()
+		}
+		for i, arg := range args {
+			v := reflect.New(paramType(t, skip+i)).Elem()
+			if err := fromObject(arg, v, host); err != nil {
+				return newError("argument %d to `%s`: %s", i+1, name, err)
+			}
+			in = append(in, v)
+		}
+
+		out := fn.Call(in)
+		if n := len(out); n > 0 && t.Out(n-1) == errorType {
+			if err := out[n-1]; !err.IsNil() {
+				return &Error{Message: err.Interface().(error).Error()}
+			}
+			out = out[:n-1]
+		}
+		if len(out) == 0 {
+			return nil
+		}
+
+		obj, err := toObject(out[0])
+		if err != nil {
+			return newError("result of `%s`: %s", name, err)
+		}
+		return obj
+	}
+
+	return &Builtin{Name: name, Arity: arity, HostFn: wrapper}, nil
+}
+
+// paramType returns the type of the i-th argument passed to a function of
+// type t, which for a variadic function may be in its final slice.
+func paramType(t reflect.Type, i int) reflect.Type {
+	if t.IsVariadic() && i >= t.NumIn()-1 {
+		return t.In(t.NumIn() - 1).Elem()
+	}
+	return t.In(i)
+}
+
+func checkResults(t reflect.Type) error {
+	switch t.NumOut() {
+	case 0, 1:
+		return nil
+	case 2:
+		if t.Out(1) == errorType {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported results in %s: want a value, an error or both", t)
+}
+
+// goFunc returns a Go function of type t that calls callee, for storing a
+// Monkey function in a func variable. Its arguments and results are
+// converted like those of a func registered with RegisterFunc, the other
+// way around.
+func goFunc(callee BuiltinFunction, t reflect.Type, host Host) (reflect.Value, error) {
+	if err := checkResults(t); err != nil {
+		return reflect.Value{}, err
+	}
+
+	fn := func(in []reflect.Value) []reflect.Value {
+		if t.IsVariadic() {
+			last := in[len(in)-1]
+			in = in[:len(in)-1]
+			for i := 0; i < last.Len(); i++ {
+				in = append(in, last.Index(i))
+			}
+		}
+
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.New(t.Out(i)).Elem()
+		}
+		fail := func(err error) []reflect.Value {
+			if n := len(out); n > 0 && t.Out(n-1) == errorType {
+				out[n-1] = reflect.ValueOf(&err).Elem()
+				return out
+			}
+			panic(err)
+		}
+
+		args := make([]Object, len(in))
+		for i, v := range in {
+			arg, err := toObject(v)
+			if err != nil {
+				return fail(err)
+			}
+			args[i] = arg
+		}
+
+		result := callee(args...)
+		if errObj, ok := result.(*Error); ok {
+			return fail(errors.New(errObj.Message))
+		}
+		if len(out) > 0 && t.Out(0) != errorType {
+			if err := fromObject(result, out[0], host); err != nil {
+				return fail(err)
+			}
+		}
+		return out
+	}
+
+	return reflect.MakeFunc(t, fn), nil
+}
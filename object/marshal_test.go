@@ -0,0 +1,226 @@
+package object
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	X, Y   int
+	Label  string `monkey:"label"`
+	Hidden bool   `monkey:"-"`
+	secret int
+}
+
+func hashOf(pairs ...Object) *Hash {
+	h := NewHash()
+	for i := 0; i < len(pairs); i += 2 {
+		h.Set(pairs[i].(Hashable), pairs[i+1])
+	}
+	return h
+}
+
+func str(s string) *String { return &String{Value: s} }
+func num(i int64) *Integer { return &Integer{Value: i} }
+
+func TestToObject(t *testing.T) {
+	var nilPtr *point
+	tests := []struct {
+		input    interface{}
+		expected Object
+	}{
+		{nil, NULL},
+		{nilPtr, NULL},
+		{true, TRUE},
+		{int8(-3), num(-3)},
+		{uint32(7), num(7)},
+		{"hi", str("hi")},
+		{[]byte("bytes"), str("bytes")},
+		{[]int{1, 2}, &Array{Elements: []Object{num(1), num(2)}}},
+		{[2]string{"a", "b"}, &Array{Elements: []Object{str("a"), str("b")}}},
+		{[]interface{}{1, nil, "x"}, &Array{Elements: []Object{num(1), NULL, str("x")}}},
+		{map[string]int{"a": 1}, hashOf(str("a"), num(1))},
+		{map[int]bool{2: false}, hashOf(num(2), FALSE)},
+		{map[[2]int]string{{1, 2}: "a"}, hashOf(&Array{Elements: []Object{num(1), num(2)}}, str("a"))},
+		{point{X: 1, Y: 2, Label: "p", Hidden: true, secret: 3}, hashOf(str("X"), num(1), str("Y"), num(2), str("label"), str("p"))},
+		{&point{Label: "ptr"}, hashOf(str("X"), num(0), str("Y"), num(0), str("label"), str("ptr"))},
+		{num(5), num(5)},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.input)
+		if err != nil {
+			t.Errorf("ToObject(%#v) failed: %s", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(obj, tt.expected) {
+			t.Errorf("ToObject(%#v) wrong. want=%s, got=%s", tt.input, tt.expected.Inspect(), obj.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{1.5, "cannot convert float64 to an object"},
+		{uint64(1 << 63), "9223372036854775808 overflows INTEGER"},
+		{[]interface{}{1, make(chan int)}, "[1]: cannot convert chan int to an object"},
+		{map[struct{ X int }]int{{1}: 1}, "unusable as hash key: HASH"},
+		{struct{ C chan int }{}, "C: cannot convert chan int to an object"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := ToObject(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("ToObject(%#v) wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	var i int
+	if err := FromObject(num(42), &i); err != nil || i != 42 {
+		t.Errorf("wrong int. got=%d, %v", i, err)
+	}
+
+	var u8 uint8
+	if err := FromObject(num(256), &u8); err == nil || err.Error() != "256 overflows uint8" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	if err := FromObject(num(-1), &u8); err == nil {
+		t.Errorf("expected negative number not to convert to uint8")
+	}
+
+	var s []string
+	if err := FromObject(&Array{Elements: []Object{str("a"), str("b")}}, &s); err != nil || !reflect.DeepEqual(s, []string{"a", "b"}) {
+		t.Errorf("wrong slice. got=%q, %v", s, err)
+	}
+	if err := FromObject(&Array{Elements: []Object{str("a"), num(1)}}, &s); err == nil || err.Error() != "[1]: cannot convert INTEGER to string" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	if err := FromObject(NULL, &s); err != nil || s != nil {
+		t.Errorf("expected NULL to give a nil slice. got=%q, %v", s, err)
+	}
+
+	var m map[string]int
+	if err := FromObject(hashOf(str("a"), num(1), str("b"), num(2)), &m); err != nil || !reflect.DeepEqual(m, map[string]int{"a": 1, "b": 2}) {
+		t.Errorf("wrong map. got=%v, %v", m, err)
+	}
+
+	var p point
+	err := FromObject(hashOf(str("X"), num(1), str("label"), str("l"), str("Hidden"), TRUE, str("extra"), NULL), &p)
+	if err != nil || p != (point{X: 1, Label: "l"}) {
+		t.Errorf("wrong struct. got=%+v, %v", p, err)
+	}
+
+	var pp *point
+	if err := FromObject(hashOf(str("Y"), num(3)), &pp); err != nil || pp == nil || pp.Y != 3 {
+		t.Errorf("wrong pointer. got=%+v, %v", pp, err)
+	}
+
+	var any interface{}
+	FromObject(&Array{Elements: []Object{num(1), hashOf(str("k"), TRUE), hashOf(num(1), NULL)}}, &any)
+	expected := []interface{}{int64(1), map[string]interface{}{"k": true}, map[interface{}]interface{}{int64(1): nil}}
+	if !reflect.DeepEqual(any, expected) {
+		t.Errorf("wrong interface value. got=%#v", any)
+	}
+
+	err = FromObject(&Array{Elements: []Object{hashOf(&Array{Elements: []Object{num(1)}}, num(2))}}, &any)
+	if err == nil || err.Error() != "[0]: cannot convert ARRAY key [1] to a map key" {
+		t.Errorf("wrong error for array key. got=%v", err)
+	}
+
+	var obj Object
+	if err := FromObject(str("x"), &obj); err != nil || obj.Inspect() != "x" {
+		t.Errorf("wrong object. got=%v, %v", obj, err)
+	}
+
+	var b bool
+	if err := FromObject(num(1), &b); err == nil || err.Error() != "cannot convert INTEGER to bool" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	if err := FromObject(num(1), b); err == nil {
+		t.Errorf("expected FromObject to need a pointer")
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	r := NewRegistry()
+	err := r.RegisterFunc("repeat", func(s string, n int) ([]string, error) {
+		if n < 0 {
+			return nil, errors.New("negative count")
+		}
+		return strings.Split(strings.Repeat(s+",", n), ",")[:n], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RegisterFunc("join", func(sep string, parts ...string) string { return strings.Join(parts, sep) })
+	r.RegisterFunc("boom", func() { panic("oops") })
+	r.RegisterFunc("any", func(x interface{}) bool { return x != nil })
+
+	tests := []struct {
+		name     string
+		args     []Object
+		expected string
+	}{
+		{"repeat", []Object{str("a"), num(2)}, "[a, a]"},
+		{"repeat", []Object{str("a"), num(-1)}, "ERROR: negative count"},
+		{"repeat", []Object{str("a")}, "ERROR: wrong number of arguments. got=1, want=2"},
+		{"repeat", []Object{num(1), num(2)}, "ERROR: argument 1 to `repeat`: cannot convert INTEGER to string"},
+		{"join", []Object{str("-")}, ""},
+		{"join", []Object{str("-"), str("a"), str("b")}, "a-b"},
+		{"join", []Object{}, "ERROR: wrong number of arguments. got=0, want=at least 1"},
+		{"boom", nil, "ERROR: `boom` panicked: oops"},
+		{"any", []Object{hashOf(num(1), num(2))}, "true"},
+		{"any", []Object{hashOf(&Array{Elements: []Object{num(1)}}, num(2))}, "ERROR: argument 1 to `any`: cannot convert ARRAY key [1] to a map key"},
+	}
+
+	for _, tt := range tests {
+		b, _ := r.Lookup(tt.name)
+		result := b.Call(nil, tt.args...)
+		actual := "<nil>"
+		if result != nil {
+			actual = result.Inspect()
+		}
+		if actual != tt.expected {
+			t.Errorf("%s%v wrong. want=%q, got=%q", tt.name, tt.args, tt.expected, actual)
+		}
+	}
+
+	if b, _ := r.Lookup("join"); b.Arity != AtLeast(1) {
+		t.Errorf("wrong arity for join: %s", b.Arity)
+	}
+	if err := r.RegisterFunc("bad", func() (int, int) { return 0, 0 }); err == nil {
+		t.Errorf("expected func with two values to be rejected")
+	}
+	if err := r.RegisterFunc("bad", 1); err == nil {
+		t.Errorf("expected non-func to be rejected")
+	}
+}
+
+func TestFuncRoundTrip(t *testing.T) {
+	obj, err := ToObject(func(a, b int) int { return a + b })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := obj.(*Builtin).Call(nil, num(1), num(2)); result.Inspect() != "3" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	var add func(int, int) (int, error)
+	if err := FromObject(obj, &add); err != nil {
+		t.Fatal(err)
+	}
+	if sum, err := add(2, 3); err != nil || sum != 5 {
+		t.Errorf("wrong result. got=%d, %v", sum, err)
+	}
+
+	var bad func(string) (int, error)
+	FromObject(obj, &bad)
+	if _, err := bad("x"); err == nil || err.Error() != "wrong number of arguments. got=1, want=2" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
@@ -2,8 +2,10 @@ package object
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"hash/fnv"
+	"sort"
 	"strings"
 
 	"github.com/tneuqole/monkey-go/ast"
@@ -27,6 +29,7 @@ const (
 	QUOTE_OBJ             = "QUOTE"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 	CLOSURE_OBJ           = "CLOSURE_OBJ"
+	MODULE_OBJ            = "MODULE"
 )
 
 type Object interface {
@@ -50,6 +53,22 @@ func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 
 type Null struct{}
 
+// The boolean and null values. The evaluator and the VM compare them by
+// identity, so builtins must return these rather than new ones.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+// NativeBool returns TRUE or FALSE.
+func NativeBool(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
+
 func (n *Null) Inspect() string  { return "null" }
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 
@@ -126,8 +145,29 @@ func (s *String) Inspect() string  { return s.Value }
 
 type BuiltinFunction func(args ...Object) Object
 
+// HostFunction is a builtin that uses the evaluator or VM running it, for
+// example to call the functions passed to it or to write output.
+type HostFunction func(host Host, args ...Object) Object
+
+// Builtin is a function implemented in Go, by Fn or, if set, HostFn.
+// Name and Arity are set for builtins created by a Registry.
 type Builtin struct {
-	Fn BuiltinFunction
+	Name   string
+	Arity  Arity
+	Fn     BuiltinFunction
+	HostFn HostFunction
+}
+
+// Call calls b with args, passing host on if b needs it. A nil host stands
+// for the process, where only builtins can be called back.
+func (b *Builtin) Call(host Host, args ...Object) Object {
+	if b.HostFn == nil {
+		return b.Fn(args...)
+	}
+	if host == nil {
+		host = defaultHost{}
+	}
+	return b.HostFn(host, args...)
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -180,13 +220,151 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
+// HashKey combines the keys of the elements, so equal arrays have equal
+// keys. It is only meaningful if AsHashable accepts a.
+func (a *Array) HashKey() HashKey {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, elem := range a.Elements {
+		key := HashKey{Type: elem.Type()}
+		if hashable, ok := elem.(Hashable); ok {
+			key = hashable.HashKey()
+		}
+		h.Write([]byte(key.Type))
+		binary.LittleEndian.PutUint64(buf[:], key.Value)
+		h.Write(buf[:])
+	}
+
+	return HashKey{Type: a.Type(), Value: h.Sum64()}
+}
+
 type HashPair struct {
 	Key   Object
 	Value Object
 }
 
+// Hash maps keys to values and keeps its keys in the order they were added,
+// which is the order of Items and Inspect. Set and Delete keep that order;
+// keys written to Pairs directly come after the others, sorted.
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	// keys set through Set in insertion order, with the deleted ones left
+	// in place until there are as many as live ones
+	order []HashKey
+	// position in order of each key set through Set and not deleted
+	index   map[HashKey]int
+	deleted int
+}
+
+// NewHash returns an empty hash.
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+// Set maps key to value. A new key goes after the existing ones, and an
+// existing one keeps its place.
+func (h *Hash) Set(key Hashable, value Object) {
+	if h.Pairs == nil {
+		h.Pairs = make(map[HashKey]HashPair)
+	}
+	if h.index == nil {
+		h.index = make(map[HashKey]int)
+	}
+	hashKey := key.HashKey()
+	if _, ok := h.index[hashKey]; !ok {
+		h.index[hashKey] = len(h.order)
+		h.order = append(h.order, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key, Value: value}
+}
+
+// Get returns the value of key.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+// Delete removes key.
+func (h *Hash) Delete(key Hashable) {
+	hashKey := key.HashKey()
+	delete(h.Pairs, hashKey)
+	if _, ok := h.index[hashKey]; !ok {
+		return
+	}
+	delete(h.index, hashKey)
+	h.deleted++
+	if h.deleted > len(h.index) {
+		h.compact()
+	}
+}
+
+// compact drops the deleted keys from order.
+func (h *Hash) compact() {
+	order := make([]HashKey, 0, len(h.index))
+	for i, k := range h.order {
+		if j, ok := h.index[k]; ok && j == i {
+			h.index[k] = len(order)
+			order = append(order, k)
+		}
+	}
+	h.order = order
+	h.deleted = 0
+}
+
+// Len returns the number of keys.
+func (h *Hash) Len() int { return len(h.Pairs) }
+
+// Items returns the pairs in order.
+func (h *Hash) Items() []HashPair {
+	h.syncOrder()
+	items := make([]HashPair, len(h.order))
+	for i, k := range h.order {
+		items[i] = h.Pairs[k]
+	}
+	return items
+}
+
+// syncOrder brings order in line with Pairs, dropping deleted keys and
+// taking in those written to Pairs directly.
+func (h *Hash) syncOrder() {
+	if h.index == nil {
+		h.index = make(map[HashKey]int)
+	}
+	for k := range h.index {
+		if _, ok := h.Pairs[k]; !ok {
+			delete(h.index, k)
+			h.deleted++
+		}
+	}
+	if h.deleted > 0 {
+		h.compact()
+	}
+	if len(h.index) == len(h.Pairs) {
+		return
+	}
+
+	var added []HashKey
+	for k := range h.Pairs {
+		if _, ok := h.index[k]; !ok {
+			added = append(added, k)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool {
+		return keyLess(h.Pairs[added[i]].Key, h.Pairs[added[j]].Key)
+	})
+	for _, k := range added {
+		h.index[k] = len(h.order)
+		h.order = append(h.order, k)
+	}
+}
+
+// keyLess orders hash keys with no insertion order by type and then by
+// their Inspect().
+func keyLess(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	return a.Inspect() < b.Inspect()
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -195,7 +373,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, p := range h.Pairs {
+	for _, p := range h.Items() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", p.Key.Inspect(), p.Value.Inspect()))
 	}
 
@@ -206,10 +384,74 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// Hashable is implemented by the objects that can be hash keys. Use
+// AsHashable rather than a type assertion to check whether an object is
+// one, as an array is only if its elements are.
 type Hashable interface {
+	Object
 	HashKey() HashKey
 }
 
+// AsHashable returns obj as a Hashable if it can be a hash key: an integer,
+// boolean, string or array of such objects.
+func AsHashable(obj Object) (Hashable, bool) {
+	if arr, ok := obj.(*Array); ok {
+		for _, elem := range arr.Elements {
+			if _, ok := AsHashable(elem); !ok {
+				return nil, false
+			}
+		}
+	}
+	h, ok := obj.(Hashable)
+	return h, ok
+}
+
+// Equal reports whether a and b are equal: integers, strings and booleans
+// with the same value, nulls, arrays with equal elements or hashes with equal
+// values for the same keys. Other objects, like functions, are only equal to
+// themselves.
+func Equal(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !Equal(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			other, ok := b.Pairs[key]
+			if !ok || !Equal(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
 type Quote struct {
 	Node ast.Node
 }
@@ -223,6 +465,14 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+
+	// debug information; File is the imported module the function was
+	// compiled from, empty for the main program
+	Name       string
+	File       string
+	Lines      code.LineTable
+	LocalNames []string
+	FreeNames  []string
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -235,3 +485,14 @@ type Closure struct {
 
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
 func (c *Closure) Inspect() string  { return fmt.Sprintf("Closure[%p]", c) }
+
+// Module is the value of an import expression: the bindings a module
+// declared with export let.
+type Module struct {
+	Path    string
+	Names   []string // exported names in declaration order
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return fmt.Sprintf("module(%q)", m.Path) }
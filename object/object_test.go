@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	h1 := &String{Value: "Hello World"}
@@ -61,3 +64,121 @@ func TestBooleanHashKey(t *testing.T) {
 	}
 
 }
+
+func TestHashOrder(t *testing.T) {
+	h := NewHash()
+	h.Set(&String{Value: "b"}, &Integer{Value: 1})
+	h.Set(&Integer{Value: 3}, &Integer{Value: 2})
+	h.Set(&String{Value: "a"}, &Integer{Value: 3})
+	h.Set(&String{Value: "b"}, &Integer{Value: 4})
+	if h.Inspect() != "{b: 4,3: 2,a: 3}" {
+		t.Errorf("wrong order after Set. got=%s", h.Inspect())
+	}
+
+	h.Delete(&Integer{Value: 3})
+	h.Delete(&Integer{Value: 99})
+	h.Set(&Integer{Value: 3}, &Integer{Value: 5})
+	if h.Inspect() != "{b: 4,a: 3,3: 5}" || h.Len() != 3 {
+		t.Errorf("wrong order after Delete. got=%s", h.Inspect())
+	}
+
+	if v, ok := h.Get(&String{Value: "a"}); !ok || v.Inspect() != "3" {
+		t.Errorf("wrong value for a. got=%v", v)
+	}
+
+	// keys written to Pairs directly follow the others, sorted
+	for _, key := range []*String{{Value: "d"}, {Value: "c"}} {
+		h.Pairs[key.HashKey()] = HashPair{Key: key, Value: NULL}
+	}
+	delete(h.Pairs, (&String{Value: "b"}).HashKey())
+	if h.Inspect() != "{a: 3,3: 5,c: null,d: null}" {
+		t.Errorf("wrong order after writing Pairs. got=%s", h.Inspect())
+	}
+
+	// deleting most keys keeps the order of the rest
+	h = NewHash()
+	for i := 0; i < 1000; i++ {
+		h.Set(&Integer{Value: int64(i)}, NULL)
+	}
+	for i := 0; i < 1000; i++ {
+		if i%10 != 0 {
+			h.Delete(&Integer{Value: int64(i)})
+		}
+	}
+	h.Set(&Integer{Value: 5}, NULL)
+	items := h.Items()
+	if len(items) != 101 || h.Len() != 101 {
+		t.Fatalf("wrong number of items after Delete. got=%d", len(items))
+	}
+	for i, item := range items[:100] {
+		if item.Key.Inspect() != fmt.Sprint(i*10) {
+			t.Fatalf("wrong key at %d. got=%s", i, item.Key.Inspect())
+		}
+	}
+	if items[100].Key.Inspect() != "5" {
+		t.Errorf("wrong last key. got=%s", items[100].Key.Inspect())
+	}
+}
+
+func TestEqual(t *testing.T) {
+	arr := func(elems ...Object) *Array { return &Array{Elements: elems} }
+	fn := &Builtin{Name: "f"}
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 1}, true},
+		{&String{Value: "a"}, &String{Value: "a"}, true},
+		{&String{Value: "a"}, &String{Value: "b"}, false},
+		{&Boolean{Value: true}, TRUE, true},
+		{&Null{}, NULL, true},
+		{arr(&Integer{Value: 1}, arr(&String{Value: "x"})), arr(&Integer{Value: 1}, arr(&String{Value: "x"})), true},
+		{arr(&Integer{Value: 1}), arr(&Integer{Value: 1}, &Integer{Value: 2}), false},
+		{arr(), NULL, false},
+		{fn, fn, true},
+		{fn, &Builtin{Name: "f"}, false},
+	}
+
+	for _, tt := range tests {
+		if Equal(tt.a, tt.b) != tt.expected || Equal(tt.b, tt.a) != tt.expected {
+			t.Errorf("Equal(%s, %s) should be %t", tt.a.Inspect(), tt.b.Inspect(), tt.expected)
+		}
+	}
+
+	h1, h2 := NewHash(), NewHash()
+	h1.Set(&String{Value: "a"}, &Integer{Value: 1})
+	h1.Set(&Integer{Value: 2}, arr())
+	h2.Set(&Integer{Value: 2}, arr())
+	h2.Set(&String{Value: "a"}, &Integer{Value: 1})
+	if !Equal(h1, h2) {
+		t.Errorf("hashes with the same pairs in different order should be equal")
+	}
+	h2.Set(&String{Value: "a"}, &Integer{Value: 3})
+	if Equal(h1, h2) {
+		t.Errorf("hashes with different values should not be equal")
+	}
+}
+
+func TestArrayHashKey(t *testing.T) {
+	a1 := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}}
+	a2 := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}}
+	b := &Array{Elements: []Object{&String{Value: "a"}, &Integer{Value: 1}}}
+	nested := &Array{Elements: []Object{a1}}
+
+	if a1.HashKey() != a2.HashKey() {
+		t.Errorf("arrays with same elements have different hash key")
+	}
+	if a1.HashKey() == b.HashKey() || a1.HashKey() == nested.HashKey() {
+		t.Errorf("arrays with different elements have same hash key")
+	}
+
+	if _, ok := AsHashable(nested); !ok {
+		t.Errorf("array of hashable elements should be hashable")
+	}
+	if _, ok := AsHashable(&Array{Elements: []Object{nested, NewHash()}}); ok {
+		t.Errorf("array containing a hash should not be hashable")
+	}
+	if _, ok := AsHashable(NewHash()); ok {
+		t.Errorf("hash should not be hashable")
+	}
+}
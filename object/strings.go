@@ -0,0 +1,310 @@
+package object
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// stringBuiltins work on strings. Indexes count characters, not bytes.
+var stringBuiltins = []builtinDef{
+	{
+		"split",
+		Between(1, 2),
+		func(_ Host, args ...Object) Object {
+			s, err := stringArg("split", args, 0)
+			if err != nil {
+				return err
+			}
+
+			var parts []string
+			if len(args) == 1 {
+				parts = strings.Fields(s)
+			} else {
+				sep, err := stringArg("split", args, 1)
+				if err != nil {
+					return err
+				}
+				parts = strings.Split(s, sep)
+			}
+			return stringArray(parts)
+		},
+	},
+	{
+		"join",
+		Between(1, 2),
+		func(_ Host, args ...Object) Object {
+			arr, err := arrayArg("join", args, 0)
+			if err != nil {
+				return err
+			}
+			sep := ""
+			if len(args) == 2 {
+				if sep, err = stringArg("join", args, 1); err != nil {
+					return err
+				}
+			}
+
+			parts := make([]string, len(arr.Elements))
+			for i, elem := range arr.Elements {
+				parts[i] = elem.Inspect()
+			}
+			return &String{Value: strings.Join(parts, sep)}
+		},
+	},
+	{
+		"trim",
+		Between(1, 2),
+		func(_ Host, args ...Object) Object {
+			s, err := stringArg("trim", args, 0)
+			if err != nil {
+				return err
+			}
+			if len(args) == 1 {
+				return &String{Value: strings.TrimSpace(s)}
+			}
+			cutset, err := stringArg("trim", args, 1)
+			if err != nil {
+				return err
+			}
+			return &String{Value: strings.Trim(s, cutset)}
+		},
+	},
+	{
+		"upper",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			s, err := stringArg("upper", args, 0)
+			if err != nil {
+				return err
+			}
+			return &String{Value: strings.ToUpper(s)}
+		},
+	},
+	{
+		"lower",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			s, err := stringArg("lower", args, 0)
+			if err != nil {
+				return err
+			}
+			return &String{Value: strings.ToLower(s)}
+		},
+	},
+	{
+		"replace",
+		Between(3, 4),
+		func(_ Host, args ...Object) Object {
+			strs := make([]string, 3)
+			for i := range strs {
+				s, err := stringArg("replace", args, i)
+				if err != nil {
+					return err
+				}
+				strs[i] = s
+			}
+			n := int64(-1)
+			if len(args) == 4 {
+				var err *Error
+				if n, err = integerArg("replace", args, 3); err != nil {
+					return err
+				}
+			}
+			// an empty old matches around every character
+			matches := int64(strings.Count(strs[0], strs[1]))
+			if n >= 0 && n < matches {
+				matches = n
+			}
+			if grow := int64(len(strs[2]) - len(strs[1])); grow > 0 && matches > (maxLength-int64(len(strs[0])))/grow {
+				return newError("`replace` of %d matches would have more than %d bytes", matches, maxLength)
+			}
+			return &String{Value: strings.Replace(strs[0], strs[1], strs[2], int(n))}
+		},
+	},
+	{
+		"starts_with",
+		Exactly(2),
+		func(_ Host, args ...Object) Object {
+			s, prefix, err := stringArgs("starts_with", args)
+			if err != nil {
+				return err
+			}
+			return NativeBool(strings.HasPrefix(s, prefix))
+		},
+	},
+	{
+		"ends_with",
+		Exactly(2),
+		func(_ Host, args ...Object) Object {
+			s, suffix, err := stringArgs("ends_with", args)
+			if err != nil {
+				return err
+			}
+			return NativeBool(strings.HasSuffix(s, suffix))
+		},
+	},
+	{
+		"substring",
+		Between(2, 3),
+		func(_ Host, args ...Object) Object {
+			s, ok := args[0].(*String)
+			if !ok {
+				return argTypeError("substring", 0, "STRING", args[0])
+			}
+			return substring("substring", s, args)
+		},
+	},
+	{
+		"repeat",
+		Exactly(2),
+		func(_ Host, args ...Object) Object {
+			s, err := stringArg("repeat", args, 0)
+			if err != nil {
+				return err
+			}
+			n, err := integerArg("repeat", args, 1)
+			if err != nil {
+				return err
+			}
+			if n < 0 {
+				return newError("`repeat` count must not be negative, got=%d", n)
+			}
+			// divided rather than multiplied, which could overflow
+			if len(s) > 0 && n > maxLength/int64(len(s)) {
+				return newError("`repeat` of %d bytes %d times would have more than %d bytes", len(s), n, maxLength)
+			}
+			return &String{Value: strings.Repeat(s, int(n))}
+		},
+	},
+	{
+		"chars",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			s, err := stringArg("chars", args, 0)
+			if err != nil {
+				return err
+			}
+			return stringArray(strings.Split(s, ""))
+		},
+	},
+	{
+		"char",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			n, err := integerArg("char", args, 0)
+			if err != nil {
+				return err
+			}
+			if n < 0 || n > utf8.MaxRune || !utf8.ValidRune(rune(n)) {
+				return newError("`char` of invalid code point %d", n)
+			}
+			return &String{Value: string(rune(n))}
+		},
+	},
+	{
+		"ord",
+		Exactly(1),
+		func(_ Host, args ...Object) Object {
+			s, err := stringArg("ord", args, 0)
+			if err != nil {
+				return err
+			}
+			if utf8.RuneCountInString(s) != 1 {
+				return newError("argument to `ord` must be a single character, got=%q", s)
+			}
+			r, _ := utf8.DecodeRuneInString(s)
+			return &Integer{Value: int64(r)}
+		},
+	},
+	{
+		"format",
+		AtLeast(1),
+		func(_ Host, args ...Object) Object {
+			f, err := stringArg("format", args, 0)
+			if err != nil {
+				return err
+			}
+			return format(f, args[1:])
+		},
+	},
+}
+
+func stringArg(name string, args []Object, i int) (string, *Error) {
+	s, ok := args[i].(*String)
+	if !ok {
+		return "", argTypeError(name, i, "STRING", args[i])
+	}
+	return s.Value, nil
+}
+
+// stringArgs returns the first two arguments of the builtin name, which
+// must be strings.
+func stringArgs(name string, args []Object) (string, string, *Error) {
+	a, err := stringArg(name, args, 0)
+	if err != nil {
+		return "", "", err
+	}
+	b, err := stringArg(name, args, 1)
+	if err != nil {
+		return "", "", err
+	}
+	return a, b, nil
+}
+
+func stringArray(strs []string) *Array {
+	elems := make([]Object, len(strs))
+	for i, s := range strs {
+		elems[i] = &String{Value: s}
+	}
+	return &Array{Elements: elems}
+}
+
+// substring returns the characters of s between the bounds in args, as for
+// slice.
+func substring(name string, s *String, args []Object) Object {
+	runes := []rune(s.Value)
+	start, end, err := sliceBounds(name, args, int64(len(runes)))
+	if err != nil {
+		return err
+	}
+	return &String{Value: string(runes[start:end])}
+}
+
+// runeIndex returns the index in characters of the first occurrence of sub
+// in s, or -1 if there is none.
+func runeIndex(s, sub string) int {
+	i := strings.Index(s, sub)
+	if i < 0 {
+		return -1
+	}
+	return utf8.RuneCountInString(s[:i])
+}
+
+// format replaces each {} in f by the next of args. {{ and }} stand for
+// literal braces.
+func format(f string, args []Object) Object {
+	var b strings.Builder
+	next := 0
+	for i := 0; i < len(f); i++ {
+		switch {
+		case strings.HasPrefix(f[i:], "{{"), strings.HasPrefix(f[i:], "}}"):
+			b.WriteByte(f[i])
+			i++
+		case strings.HasPrefix(f[i:], "{}"):
+			if next == len(args) {
+				return newError("`format` has more placeholders than arguments (%d)", len(args))
+			}
+			b.WriteString(args[next].Inspect())
+			next++
+			i++
+		case f[i] == '{' || f[i] == '}':
+			return newError("`format` has unmatched %q at offset %d", f[i], i)
+		default:
+			b.WriteByte(f[i])
+		}
+	}
+	if next != len(args) {
+		return newError("`format` has %d placeholders but %d arguments", next, len(args))
+	}
+	return &String{Value: b.String()}
+}
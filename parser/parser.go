@@ -43,13 +43,13 @@ type Parser struct {
 	l              *lexer.Lexer
 	curToken       token.Token
 	peekToken      token.Token
-	errors         []string
+	errors         []*Error
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []*Error{}}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
@@ -65,6 +65,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -104,15 +105,38 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// parseStatement returns the statement at the current token, or nil if it
+// failed to parse.
 func (p *Parser) parseStatement() ast.Statement {
+	var stmt *ast.LetStatement
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		stmt = p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.EXPORT:
+		stmt = p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
+
+	// a nil *ast.LetStatement is not a nil ast.Statement
+	if stmt == nil {
+		return nil
+	}
+	return stmt
+}
+
+func (p *Parser) parseExportStatement() *ast.LetStatement {
+	if !p.expectPeek(token.LET) {
+		return nil
+	}
+
+	stmt := p.parseLetStatement()
+	if stmt != nil {
+		stmt.Export = true
+	}
+	return stmt
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
@@ -174,6 +198,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	bl.End = p.curToken
 
 	return bl
 }
@@ -208,8 +233,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	val, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as int", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorf(p.curToken, "could not parse %q as int", p.curToken.Literal)
 		return nil
 	}
 
@@ -308,13 +332,40 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	return false
 }
 
+// Error is a parser error at a position in the source.
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		msgs[i] = err.Message
+	}
+	return msgs
+}
+
+// ErrorDetails returns the parser errors with their positions.
+func (p *Parser) ErrorDetails() []*Error {
 	return p.errors
 }
 
+func (p *Parser) errorf(tok token.Token, format string, a ...interface{}) {
+	p.errors = append(p.errors, &Error{
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.peekToken, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -326,8 +377,7 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.curToken, "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -468,6 +518,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		val := p.parseExpression(LOWEST)
 		hash.Pairs[key] = val
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -480,3 +531,14 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 	return hash
 }
+
+func (p *Parser) parseImportExpression() ast.Expression {
+	exp := &ast.ImportExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+
+	exp.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	return exp
+}
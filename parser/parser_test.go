@@ -926,3 +926,107 @@ func TestFunctionLiteralWithName(t *testing.T) {
 			function.Name)
 	}
 }
+
+func TestImportAndExport(t *testing.T) {
+	input := `let math = import "lib/math";
+export let add = fn(a, b) { a + b };
+import "lib/math"["add"];`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not have 3 statements. got=%d", len(program.Statements))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	imp, ok := let.Value.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("let.Value is not ast.ImportExpression. got=%T", let.Value)
+	}
+	if imp.Path.Value != "lib/math" || let.Export {
+		t.Errorf("wrong import. path=%q, export=%t", imp.Path.Value, let.Export)
+	}
+
+	export, ok := program.Statements[1].(*ast.LetStatement)
+	if !ok || !export.Export || export.Name.Value != "add" {
+		t.Fatalf("statement is not an exported let. got=%s", program.Statements[1])
+	}
+
+	if s := program.String(); s != `let math = import "lib/math";export let add = fn<add>(a, b)(a + b);(import "lib/math"[add])` {
+		t.Errorf("wrong program string. got=%q", s)
+	}
+}
+
+func TestImportAndExportErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import math`, "expected next token to be STRING, got IDENT instead"},
+		{`export fn() {}`, "expected next token to be LET, got FUNCTION instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestFailedStatementsAreDropped(t *testing.T) {
+	tests := []string{
+		"let = 5; 1;",
+		"let x 5; 1;",
+		"export fn() {}; 1;",
+		"if (true) { let = 1; 2 }",
+		"fn() { export let; }",
+	}
+
+	for _, input := range tests {
+		program := New(lexer.New(input)).ParseProgram()
+		statements := program.Statements
+		ast.Inspect(program, func(node ast.Node) bool {
+			if block, ok := node.(*ast.BlockStatement); ok {
+				statements = append(statements, block.Statements...)
+			}
+			return true
+		})
+		for _, stmt := range statements {
+			if ast.IsNil(stmt) {
+				t.Errorf("nil statement in %q", input)
+			}
+		}
+	}
+}
+
+func FuzzParseProgram(f *testing.F) {
+	for _, seed := range []string{
+		"let x = 5; return x;",
+		"fn(x, y) { if (x < y) { x } else { y } }(1, 2)",
+		`{"a": [1, 2][0], true: fn() {}}["a"]`,
+		"macro(x) { quote(unquote(x)) }",
+		"let = ; fn(1) { [1, } {: }",
+		"import \"a\"; -(",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		for _, stmt := range program.Statements {
+			if ast.IsNil(stmt) {
+				t.Fatalf("nil statement in %q", input)
+			}
+		}
+		if len(p.Errors()) == 0 {
+			_ = program.String()
+		}
+	})
+}
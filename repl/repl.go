@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/tneuqole/monkey-go/compiler"
 	"github.com/tneuqole/monkey-go/object"
@@ -31,7 +32,9 @@ const MONKEY_FACE = `            __,__
 `
 
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	// programs read from the same buffered input as the prompt, so a line
+	// typed after one calling readline is not lost
+	streams := &object.IO{Stdin: bufio.NewReader(in), Stdout: out, Stderr: out}
 
 	// env := object.NewEnvironment()
 	// macroEnv := object.NewEnvironment()
@@ -39,18 +42,18 @@ func Start(in io.Reader, out io.Writer) {
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalsSize)
 	symbolTable := compiler.NewSymbolTable()
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
+	for i, b := range object.NewStandardRegistry().All() {
+		symbolTable.DefineBuiltin(i, b.Name)
 	}
 
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		fmt.Fprint(out, PROMPT)
+		line, err := streams.Stdin.ReadString('\n')
+		if err != nil && line == "" {
 			return
 		}
 
-		line := scanner.Text()
+		line = strings.TrimRight(line, "\r\n")
 		l := lexer.New(line)
 		p := parser.New(l)
 
@@ -69,17 +72,20 @@ func Start(in io.Reader, out io.Writer) {
 		// }
 
 		c := compiler.NewWithState(symbolTable, constants)
-		err := c.Compile(program)
+		err = c.Compile(program)
 		if err != nil {
-			fmt.Fprintf(out, "compilation failed: %s", err)
+			fmt.Fprintf(out, "compilation failed:\n%s\n", err)
+			continue
 		}
 
 		bytecode := c.Bytecode()
 		constants = bytecode.Constants
 		machine := vm.NewWithGlobals(bytecode, globals)
+		machine.SetIO(streams)
 		err = machine.Run()
 		if err != nil {
-			fmt.Fprintf(out, "vm failed: %s", err)
+			fmt.Fprintf(out, "vm failed: %s\n", err)
+			continue
 		}
 
 		result := machine.LastPoppedStackElem()
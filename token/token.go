@@ -5,14 +5,17 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int
+	Column  int
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
 
-	IDENT = "IDENT"
-	INT   = "INT"
+	IDENT   = "IDENT"
+	INT     = "INT"
+	COMMENT = "COMMENT"
 
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -46,6 +49,8 @@ const (
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
 	STRING   = "STRING"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
 )
 
 var keywords = map[string]TokenType{
@@ -57,6 +62,8 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"import": IMPORT,
+	"export": EXPORT,
 }
 
 func LookupIdent(ident string) TokenType {
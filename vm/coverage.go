@@ -0,0 +1,76 @@
+package vm
+
+import (
+	"github.com/tneuqole/monkey-go/compiler"
+	"github.com/tneuqole/monkey-go/coverage"
+	"github.com/tneuqole/monkey-go/object"
+)
+
+// Coverage records in a profile the lines whose statements a VM runs, using
+// the line tables of its functions. Install Hook with SetHook.
+type Coverage struct {
+	profile *coverage.Profile
+	// main is the path the main program is reported under
+	main string
+
+	// the line of the statement starting at each offset of a function, or
+	// 0 where none does
+	stmts map[*object.CompiledFunction][]int
+
+	// the function of the last instruction, as most instructions are in
+	// the same function as the one before
+	lastFn    *object.CompiledFunction
+	lastStmts []int
+}
+
+// NewCoverage returns a Coverage recording in profile, reporting the lines
+// of the main program under the path main.
+func NewCoverage(profile *coverage.Profile, main string) *Coverage {
+	return &Coverage{
+		profile: profile,
+		main:    main,
+		stmts:   make(map[*object.CompiledFunction][]int),
+	}
+}
+
+// Add marks the lines of bytecode and of the functions and modules it
+// contains as executable, so that those that never run are reported.
+func (c *Coverage) Add(bytecode *compiler.Bytecode) {
+	c.profile.AddLines(c.main, bytecode.Lines.StmtLines()...)
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			c.profile.AddLines(c.file(fn), fn.Lines.StmtLines()...)
+		}
+	}
+}
+
+// Hook records a run of the statement starting at the frame's instruction,
+// if any.
+func (c *Coverage) Hook(f *Frame) error {
+	fn := f.cl.Fn
+	if fn != c.lastFn {
+		stmts, ok := c.stmts[fn]
+		if !ok {
+			stmts = make([]int, len(fn.Instructions))
+			for _, e := range fn.Lines {
+				if e.Stmt && e.Offset < len(stmts) {
+					stmts[e.Offset] = e.Line
+				}
+			}
+			c.stmts[fn] = stmts
+		}
+		c.lastFn, c.lastStmts = fn, stmts
+	}
+
+	if line := c.lastStmts[f.ip]; line != 0 {
+		c.profile.Hit(c.file(fn), line)
+	}
+	return nil
+}
+
+func (c *Coverage) file(fn *object.CompiledFunction) string {
+	if fn.File == "" {
+		return c.main
+	}
+	return fn.File
+}
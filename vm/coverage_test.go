@@ -0,0 +1,55 @@
+package vm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tneuqole/monkey-go/compiler"
+	"github.com/tneuqole/monkey-go/coverage"
+)
+
+func TestCoverage(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.mk")
+	os.WriteFile(lib, []byte("export let sign = fn(x) {\n  if (x < 0) {\n    return -1;\n  }\n  1\n};\n"), 0o644)
+	main := filepath.Join(dir, "main.mk")
+
+	c := compiler.New()
+	c.SetPath(main)
+	program := parse(`let lib = import "lib";
+let sum = 0;
+let count = fn(n) {
+  if (n == 0) { return 0; }
+  count(n - 1) + 1
+};
+count(3);
+let never = fn() {
+  puts("never");
+};`)
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := c.Bytecode()
+
+	profile := coverage.NewProfile()
+	cov := NewCoverage(profile, main)
+	cov.Add(bytecode)
+	machine := New(bytecode)
+	machine.SetHook(cov.Hook)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// line 4 counts both the if and the return inside it
+	tests := map[string]string{
+		main: "[{1 1} {2 1} {3 1} {4 5} {5 3} {7 1} {8 1} {9 0}]",
+		lib:  "[{1 1} {2 0} {3 0} {5 0}]",
+	}
+	for file, want := range tests {
+		if got := fmt.Sprint(profile.Lines(file)); got != want {
+			t.Errorf("wrong lines of %s.\nwant=%s\ngot= %s", file, want, got)
+		}
+	}
+}
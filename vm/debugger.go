@@ -0,0 +1,332 @@
+package vm
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/tneuqole/monkey-go/object"
+)
+
+// ErrTerminated is returned by Run when a debugger terminates the program.
+var ErrTerminated = errors.New("terminated by debugger")
+
+type StopReason string
+
+const (
+	StopEntry      StopReason = "entry"
+	StopBreakpoint StopReason = "breakpoint"
+	StopStep       StopReason = "step"
+	StopPause      StopReason = "pause"
+)
+
+// Stop describes where and why the program stopped.
+type Stop struct {
+	Reason StopReason
+	Line   int
+}
+
+type stepMode int
+
+const (
+	runMode stepMode = iota
+	stepInMode
+	stepOverMode
+	stepOutMode
+	pauseMode
+)
+
+// StackFrame describes one frame of a stopped program, innermost first.
+// File is the imported module the frame runs in, empty for the main program.
+type StackFrame struct {
+	Name string
+	File string
+	Line int
+}
+
+// Variable is a named value of a stopped program.
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+// Debugger controls a VM running on another goroutine. The program stops
+// at the start of statements on breakpoint lines or when a step completes;
+// while stopped, the VM goroutine is blocked in the debugger and the frames,
+// locals, free variables and globals may be inspected.
+type Debugger struct {
+	vm *VM
+
+	// GlobalNames are the names of globals by index, usually taken from the
+	// compiler's symbol table.
+	GlobalNames []string
+
+	mu          sync.Mutex
+	breakpoints map[int]bool
+	mode        stepMode
+	stepDepth   int
+	stepLine    int
+	stopped     bool
+	terminated  bool
+
+	stops  chan Stop
+	resume chan error
+	done   chan error
+}
+
+// NewDebugger installs a debugger on vm. With stopOnEntry the program
+// stops before its first statement.
+func NewDebugger(vm *VM, stopOnEntry bool) *Debugger {
+	d := &Debugger{
+		vm:          vm,
+		breakpoints: make(map[int]bool),
+		stops:       make(chan Stop),
+		resume:      make(chan error),
+		done:        make(chan error, 1),
+	}
+	if stopOnEntry {
+		d.mode = pauseMode
+	}
+	vm.SetHook(d.hook)
+	return d
+}
+
+// Start runs the program on a new goroutine.
+func (d *Debugger) Start() {
+	go func() {
+		d.done <- d.vm.Run()
+		close(d.stops)
+	}()
+}
+
+// Stops delivers every stop of the program. It is closed when the program
+// ends.
+func (d *Debugger) Stops() <-chan Stop {
+	return d.stops
+}
+
+// Done delivers the result of Run once the program ends.
+func (d *Debugger) Done() <-chan error {
+	return d.done
+}
+
+// SetBreakpoints replaces all breakpoints in the main program and reports
+// for each line whether a statement starts on it.
+func (d *Debugger) SetBreakpoints(lines []int) []bool {
+	valid := make(map[int]bool)
+	for _, fn := range d.functions() {
+		if fn.File != "" {
+			continue
+		}
+		for _, line := range fn.Lines.StmtLines() {
+			valid[line] = true
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.breakpoints = make(map[int]bool)
+	verified := make([]bool, len(lines))
+	for i, line := range lines {
+		d.breakpoints[line] = true
+		verified[i] = valid[line]
+	}
+	return verified
+}
+
+// functions returns the main program and every compiled function.
+func (d *Debugger) functions() []*object.CompiledFunction {
+	fns := []*object.CompiledFunction{d.vm.frames[0].cl.Fn}
+	for _, c := range d.vm.constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			fns = append(fns, fn)
+		}
+	}
+	return fns
+}
+
+// Stopped reports whether the program is stopped.
+func (d *Debugger) Stopped() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stopped
+}
+
+// Continue resumes a stopped program until the next breakpoint.
+func (d *Debugger) Continue() { d.resumeWith(runMode) }
+
+// StepIn resumes until the next statement, entering calls.
+func (d *Debugger) StepIn() { d.resumeWith(stepInMode) }
+
+// StepOver resumes until the next statement in the current frame or a
+// caller.
+func (d *Debugger) StepOver() { d.resumeWith(stepOverMode) }
+
+// StepOut resumes until the next statement in a caller.
+func (d *Debugger) StepOut() { d.resumeWith(stepOutMode) }
+
+// Pause stops a running program at the next instruction.
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.stopped {
+		d.mode = pauseMode
+	}
+}
+
+// Terminate makes Run return ErrTerminated.
+func (d *Debugger) Terminate() {
+	d.mu.Lock()
+	d.terminated = true
+	stopped := d.stopped
+	d.stopped = false
+	d.mu.Unlock()
+
+	if stopped {
+		d.resume <- ErrTerminated
+	}
+}
+
+func (d *Debugger) resumeWith(mode stepMode) {
+	d.mu.Lock()
+	if !d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	d.stopped = false
+	d.mode = mode
+	d.stepDepth = d.vm.fp
+	d.stepLine = d.vm.currentFrame().Line()
+	d.mu.Unlock()
+
+	d.resume <- nil
+}
+
+func (d *Debugger) hook(f *Frame) error {
+	d.mu.Lock()
+	if d.terminated {
+		d.mu.Unlock()
+		return ErrTerminated
+	}
+
+	reason := d.stopReason(f)
+	if reason == "" {
+		d.mu.Unlock()
+		return nil
+	}
+	d.stopped = true
+	d.mu.Unlock()
+
+	d.stops <- Stop{Reason: reason, Line: f.Line()}
+	return <-d.resume
+}
+
+// stopReason decides whether to stop before the instruction at f.ip.
+func (d *Debugger) stopReason(f *Frame) StopReason {
+	if d.mode == pauseMode {
+		if d.vm.fp == 1 && f.ip == 0 {
+			return StopEntry
+		}
+		return StopPause
+	}
+
+	if !f.cl.Fn.Lines.IsStmt(f.ip) {
+		return ""
+	}
+
+	line, depth := f.Line(), d.vm.fp
+	if d.breakpoints[line] && f.cl.Fn.File == "" {
+		return StopBreakpoint
+	}
+
+	switch d.mode {
+	case stepInMode:
+		if depth != d.stepDepth || line != d.stepLine {
+			return StopStep
+		}
+	case stepOverMode:
+		if depth < d.stepDepth || depth == d.stepDepth && line != d.stepLine {
+			return StopStep
+		}
+	case stepOutMode:
+		if depth < d.stepDepth {
+			return StopStep
+		}
+	}
+	return ""
+}
+
+// StackFrames returns the frames of the stopped program, innermost first.
+func (d *Debugger) StackFrames() []StackFrame {
+	frames := make([]StackFrame, 0, d.vm.fp)
+	for i := d.vm.fp - 1; i >= 0; i-- {
+		f := d.vm.frames[i]
+		frames = append(frames, StackFrame{Name: functionName(f.cl.Fn, i == 0), File: f.cl.Fn.File, Line: f.Line()})
+	}
+	return frames
+}
+
+// frame returns the frame at index, counting from the innermost frame.
+func (d *Debugger) frame(index int) *Frame {
+	if index < 0 || index >= d.vm.fp {
+		return nil
+	}
+	return d.vm.frames[d.vm.fp-1-index]
+}
+
+// Locals returns the parameters and local bindings of the frame at index.
+// The main program has no locals, see Globals.
+func (d *Debugger) Locals(index int) []Variable {
+	f := d.frame(index)
+	if f == nil || f == d.vm.frames[0] {
+		return nil
+	}
+
+	fn := f.cl.Fn
+	vars := []Variable{}
+	for i := 0; i < fn.NumLocals; i++ {
+		value := d.vm.stack[f.basePointer+i]
+		if value == nil {
+			continue // never bound
+		}
+		vars = append(vars, Variable{Name: nameAt(fn.LocalNames, i), Value: value})
+	}
+	return vars
+}
+
+// FreeVariables returns the values captured by the closure of the frame at
+// index.
+func (d *Debugger) FreeVariables(index int) []Variable {
+	f := d.frame(index)
+	if f == nil {
+		return nil
+	}
+
+	vars := []Variable{}
+	for i, value := range f.cl.Free {
+		vars = append(vars, Variable{Name: nameAt(f.cl.Fn.FreeNames, i), Value: value})
+	}
+	return vars
+}
+
+// Globals returns the globals bound so far, sorted by name.
+func (d *Debugger) Globals() []Variable {
+	vars := []Variable{}
+	for i, name := range d.GlobalNames {
+		if name == "" || i >= len(d.vm.globals) || d.vm.globals[i] == nil {
+			continue
+		}
+		vars = append(vars, Variable{Name: name, Value: d.vm.globals[i]})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars
+}
+
+func nameAt(names []string, i int) string {
+	if i < len(names) && names[i] != "" {
+		return names[i]
+	}
+	return "$" + strconv.Itoa(i)
+}
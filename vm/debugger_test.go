@@ -0,0 +1,157 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/tneuqole/monkey-go/compiler"
+)
+
+const debugInput = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let x = add(1, 2);
+let y = x * 2;
+`
+
+func newTestDebugger(t *testing.T, stopOnEntry bool) *Debugger {
+	t.Helper()
+
+	c := compiler.New()
+	if err := c.Compile(parse(debugInput)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	d := NewDebugger(New(c.Bytecode()), stopOnEntry)
+	d.GlobalNames = c.SymbolTable().Names()
+	return d
+}
+
+func expectStop(t *testing.T, d *Debugger, reason StopReason, line int) {
+	t.Helper()
+
+	stop, ok := <-d.Stops()
+	if !ok {
+		t.Fatalf("program ended, expected %s stop on line %d", reason, line)
+	}
+	if stop.Reason != reason || stop.Line != line {
+		t.Fatalf("wrong stop. want=%s on line %d, got=%s on line %d", reason, line, stop.Reason, stop.Line)
+	}
+}
+
+func expectDone(t *testing.T, d *Debugger) {
+	t.Helper()
+
+	if stop, ok := <-d.Stops(); ok {
+		t.Fatalf("unexpected stop %+v", stop)
+	}
+	if err := <-d.Done(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+}
+
+func variables(vars []Variable) map[string]string {
+	m := make(map[string]string)
+	for _, v := range vars {
+		m[v.Name] = v.Value.Inspect()
+	}
+	return m
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	d := newTestDebugger(t, false)
+
+	verified := d.SetBreakpoints([]int{2, 4})
+	if !verified[0] || verified[1] {
+		t.Errorf("wrong verified breakpoints: %v", verified)
+	}
+
+	d.Start()
+	expectStop(t, d, StopBreakpoint, 2)
+
+	frames := d.StackFrames()
+	if len(frames) != 2 || frames[0] != (StackFrame{"add", "", 2}) || frames[1] != (StackFrame{"main", "", 5}) {
+		t.Errorf("wrong stack frames: %+v", frames)
+	}
+
+	locals := variables(d.Locals(0))
+	if locals["a"] != "1" || locals["b"] != "2" {
+		t.Errorf("wrong locals: %v", locals)
+	}
+	if globals := variables(d.Globals()); len(globals) != 1 || globals["add"] == "" {
+		t.Errorf("wrong globals: %v", globals)
+	}
+
+	d.StepOver()
+	expectStop(t, d, StopStep, 3)
+	if locals := variables(d.Locals(0)); locals["sum"] != "3" {
+		t.Errorf("wrong locals: %v", locals)
+	}
+
+	d.StepOut()
+	expectStop(t, d, StopStep, 6)
+	if globals := variables(d.Globals()); globals["x"] != "3" {
+		t.Errorf("wrong globals: %v", globals)
+	}
+
+	d.Continue()
+	expectDone(t, d)
+}
+
+func TestDebuggerStepIn(t *testing.T) {
+	d := newTestDebugger(t, true)
+	d.Start()
+
+	expectStop(t, d, StopEntry, 1)
+	for _, line := range []int{5, 2, 3, 6} {
+		d.StepIn()
+		expectStop(t, d, StopStep, line)
+	}
+
+	d.StepIn()
+	expectDone(t, d)
+}
+
+func TestDebuggerFreeVariables(t *testing.T) {
+	c := compiler.New()
+	input := `let outer = fn(a) {
+  fn() {
+    a
+  }
+};
+outer(42)();
+`
+	if err := c.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	d := NewDebugger(New(c.Bytecode()), false)
+	d.SetBreakpoints([]int{3})
+	d.Start()
+
+	expectStop(t, d, StopBreakpoint, 3)
+	if free := variables(d.FreeVariables(0)); free["a"] != "42" {
+		t.Errorf("wrong free variables: %v", free)
+	}
+	if frames := d.StackFrames(); frames[0].Name != "<anonymous>" {
+		t.Errorf("wrong frame name: %+v", frames[0])
+	}
+
+	d.Continue()
+	expectDone(t, d)
+}
+
+func TestDebuggerTerminate(t *testing.T) {
+	d := newTestDebugger(t, true)
+	d.Start()
+
+	expectStop(t, d, StopEntry, 1)
+	d.Terminate()
+
+	if _, ok := <-d.Stops(); ok {
+		t.Fatalf("expected program to end")
+	}
+	if err := <-d.Done(); err != ErrTerminated {
+		t.Errorf("wrong error. want=%v, got=%v", ErrTerminated, err)
+	}
+}
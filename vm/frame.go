@@ -9,12 +9,25 @@ type Frame struct {
 	cl          *object.Closure
 	ip          int
 	basePointer int
+
+	// set for the init function of a module being imported
+	module bool
 }
 
 func NewFrame(cl *object.Closure, basePointer int) *Frame {
 	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
 }
 
+// Closure returns the closure the frame runs.
+func (f *Frame) Closure() *object.Closure {
+	return f.cl
+}
+
 func (f *Frame) Instructions() code.Instructions {
 	return f.cl.Fn.Instructions
 }
+
+// Line returns the source line of the frame's current instruction.
+func (f *Frame) Line() int {
+	return f.cl.Fn.Lines.Line(max(f.ip, 0))
+}
@@ -0,0 +1,133 @@
+package vm
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// WritePprof writes the samples of the profile as a gzipped protocol
+// buffer in the format of github.com/google/pprof/proto/profile.proto, so
+// that `go tool pprof` can read it. Each sample counts once and for the
+// time since the one before.
+func (p *Profile) WritePprof(w io.Writer) error {
+	table := []string{""}
+	stringIndex := map[string]int{"": 0}
+	str := func(s string) int {
+		i, ok := stringIndex[s]
+		if !ok {
+			i = len(table)
+			table = append(table, s)
+			stringIndex[s] = i
+		}
+		return i
+	}
+
+	var b protoBuffer
+	valueType := func(field int, typ, unit string) {
+		var vt protoBuffer
+		vt.int(1, int64(str(typ)))
+		vt.int(2, int64(str(unit)))
+		b.bytes(field, vt)
+	}
+	valueType(1, "samples", "count")
+	valueType(1, "time", "nanoseconds")
+
+	// ids start at 1, as 0 means none
+	functionIDs := make(map[*FunctionProfile]int)
+	type location struct {
+		fn   *FunctionProfile
+		line int
+	}
+	locationIDs := make(map[location]int)
+	var functions, locations protoBuffer
+
+	for _, s := range p.Samples {
+		ids := make([]int64, len(s.Stack))
+		for i, l := range s.Stack {
+			fnID, ok := functionIDs[l.Function]
+			if !ok {
+				fnID = len(functionIDs) + 1
+				functionIDs[l.Function] = fnID
+				var fn protoBuffer
+				fn.int(1, int64(fnID))
+				fn.int(2, int64(str(l.Function.Name)))
+				fn.int(3, int64(str(l.Function.Name)))
+				fn.int(4, int64(str(l.Function.File)))
+				fn.int(5, int64(l.Function.Line))
+				functions.bytes(5, fn)
+			}
+
+			key := location{l.Function, l.Line}
+			locID, ok := locationIDs[key]
+			if !ok {
+				locID = len(locationIDs) + 1
+				locationIDs[key] = locID
+				var line protoBuffer
+				line.int(1, int64(fnID))
+				line.int(2, int64(l.Line))
+				var loc protoBuffer
+				loc.int(1, int64(locID))
+				loc.bytes(4, line)
+				locations.bytes(4, loc)
+			}
+			ids[i] = int64(locID)
+		}
+
+		var sample protoBuffer
+		sample.packed(1, ids)
+		sample.packed(2, []int64{s.Count, int64(s.Time)})
+		b.bytes(2, sample)
+	}
+
+	b = append(b, locations...)
+	b = append(b, functions...)
+	b.int(9, p.Start.UnixNano())
+	b.int(10, int64(p.Duration))
+	valueType(11, "instructions", "count")
+	b.int(12, int64(p.SampleInterval))
+	// last, once every string is in the table
+	for _, s := range table {
+		b.bytes(6, protoBuffer(s))
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// protoBuffer encodes the protocol buffer wire format.
+type protoBuffer []byte
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		*b = append(*b, byte(x)|0x80)
+		x >>= 7
+	}
+	*b = append(*b, byte(x))
+}
+
+// int appends a varint field, leaving out zero as proto3 does.
+func (b *protoBuffer) int(field int, x int64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(field)<<3 | 0)
+	b.varint(uint64(x))
+}
+
+// bytes appends a length delimited field: a string or an embedded message.
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+func (b *protoBuffer) packed(field int, xs []int64) {
+	var data protoBuffer
+	for _, x := range xs {
+		data.varint(uint64(x))
+	}
+	b.bytes(field, data)
+}
@@ -0,0 +1,315 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/tneuqole/monkey-go/code"
+	"github.com/tneuqole/monkey-go/object"
+)
+
+// DefaultSampleInterval is how many instructions run between samples of the
+// call stack unless a Profiler sets its own.
+const DefaultSampleInterval = 1000
+
+// Profiler measures where programs spend their time. It instruments every
+// call to count calls, instructions and time per function and every
+// instruction to count executions per opcode, and samples the call stack
+// at a fixed interval of instructions for pprof. Install it with Hook.
+type Profiler struct {
+	// SampleInterval is how many instructions run between samples, by
+	// default DefaultSampleInterval.
+	SampleInterval int
+	// Main is the path reported for the functions of the main program.
+	Main string
+
+	functions map[*object.CompiledFunction]*FunctionProfile
+	opcodes   [256]int64
+	samples   map[string]*Sample
+
+	vm *VM
+	// the frames of vm as of the last instruction, outermost first
+	stack        []profiledFrame
+	instructions int64
+	// when the first VM and the current one started
+	first time.Time
+	start time.Time
+	// when the last call or return happened, or the last sample was taken
+	lastCall   time.Time
+	lastSample time.Time
+	duration   time.Duration
+}
+
+type profiledFrame struct {
+	frame *Frame
+	fn    *FunctionProfile
+}
+
+// FunctionProfile is what a Profiler measured for one function. Self counts
+// what ran in the function itself and total also what ran in the functions
+// it called; recursive calls are not counted twice.
+type FunctionProfile struct {
+	Name              string
+	File              string
+	Line              int
+	Calls             int64
+	SelfInstructions  int64
+	TotalInstructions int64
+	SelfTime          time.Duration
+	TotalTime         time.Duration
+
+	// calls of the function in progress, and when the outermost began
+	active     int
+	enterCount int64
+	enterTime  time.Time
+}
+
+// Location is a line of a function on a sampled call stack.
+type Location struct {
+	Function *FunctionProfile
+	Line     int
+}
+
+// Sample is a call stack, innermost first, and how many samples found the
+// program in it and the time they cover.
+type Sample struct {
+	Stack []Location
+	Count int64
+	Time  time.Duration
+}
+
+// OpcodeProfile is how many times instructions of an opcode ran.
+type OpcodeProfile struct {
+	Opcode code.Opcode
+	Name   string
+	Count  int64
+}
+
+// Profile is what a Profiler measured.
+type Profile struct {
+	// Functions sorted by self instructions, most first.
+	Functions []*FunctionProfile
+	// Opcodes that ran, most first.
+	Opcodes        []OpcodeProfile
+	Samples        []*Sample
+	SampleInterval int
+	Instructions   int64
+	Start          time.Time
+	Duration       time.Duration
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{
+		SampleInterval: DefaultSampleInterval,
+		functions:      make(map[*object.CompiledFunction]*FunctionProfile),
+		samples:        make(map[string]*Sample),
+	}
+}
+
+// Hook returns the hook that profiles vm. Measurements from several VMs are
+// added up, one VM at a time: installing the hook of another VM ends the
+// profile of the previous one.
+func (p *Profiler) Hook(vm *VM) Hook {
+	p.finish()
+	p.vm = vm
+	return p.hook
+}
+
+func (p *Profiler) hook(f *Frame) error {
+	now := time.Time{}
+	if n := len(p.stack); n != p.vm.fp || p.stack[n-1].frame != f {
+		now = time.Now()
+		p.sync(now)
+	}
+
+	p.stack[len(p.stack)-1].fn.SelfInstructions++
+	p.opcodes[f.Instructions()[f.ip]]++
+	p.instructions++
+	if p.instructions%int64(p.SampleInterval) == 0 {
+		if now.IsZero() {
+			now = time.Now()
+		}
+		p.sample(now)
+	}
+	return nil
+}
+
+// sync updates the stack to the frames of the VM, leaving the functions
+// that returned and entering those that were called.
+func (p *Profiler) sync(now time.Time) {
+	if p.start.IsZero() {
+		p.start, p.lastSample = now, now
+		if p.first.IsZero() {
+			p.first = now
+		}
+	}
+	if n := len(p.stack); n != 0 {
+		p.stack[n-1].fn.SelfTime += now.Sub(p.lastCall)
+	}
+	p.lastCall = now
+
+	for n := len(p.stack); n != 0 && (n > p.vm.fp || p.stack[n-1].frame != p.vm.frames[n-1]); n = len(p.stack) {
+		p.leave(now)
+	}
+	for n := len(p.stack); n < p.vm.fp; n = len(p.stack) {
+		f := p.vm.frames[n]
+		fn := p.function(f, n == 0)
+		fn.Calls++
+		if fn.active == 0 {
+			fn.enterCount, fn.enterTime = p.instructions, now
+		}
+		fn.active++
+		p.stack = append(p.stack, profiledFrame{frame: f, fn: fn})
+	}
+}
+
+func (p *Profiler) leave(now time.Time) {
+	fn := p.stack[len(p.stack)-1].fn
+	p.stack = p.stack[:len(p.stack)-1]
+	fn.active--
+	if fn.active == 0 {
+		fn.TotalInstructions += p.instructions - fn.enterCount
+		fn.TotalTime += now.Sub(fn.enterTime)
+	}
+}
+
+// function returns the profile of the function f runs. The main programs
+// of all VMs share one.
+func (p *Profiler) function(f *Frame, main bool) *FunctionProfile {
+	key := f.cl.Fn
+	if main {
+		key = nil
+	}
+	fn, ok := p.functions[key]
+	if !ok {
+		fn = &FunctionProfile{Name: functionName(f.cl.Fn, main), File: f.cl.Fn.File}
+		if fn.File == "" {
+			fn.File = p.Main
+		}
+		if len(f.cl.Fn.Lines) != 0 {
+			fn.Line = f.cl.Fn.Lines[0].Line
+		}
+		p.functions[key] = fn
+	}
+	return fn
+}
+
+func (p *Profiler) sample(now time.Time) {
+	stack := make([]Location, len(p.stack))
+	key := ""
+	for i := range p.stack {
+		f := p.stack[len(p.stack)-1-i]
+		stack[i] = Location{Function: f.fn, Line: f.frame.Line()}
+		key += fmt.Sprintf("%p:%d,", f.fn, stack[i].Line)
+	}
+
+	s, ok := p.samples[key]
+	if !ok {
+		s = &Sample{Stack: stack}
+		p.samples[key] = s
+	}
+	s.Count++
+	s.Time += now.Sub(p.lastSample)
+	p.lastSample = now
+}
+
+// finish ends the profile of the current VM, as if its functions returned.
+func (p *Profiler) finish() {
+	if len(p.stack) == 0 {
+		return
+	}
+	now := time.Now()
+	p.stack[len(p.stack)-1].fn.SelfTime += now.Sub(p.lastCall)
+	for len(p.stack) != 0 {
+		p.leave(now)
+	}
+	p.duration += now.Sub(p.start)
+	p.start = time.Time{}
+}
+
+// Profile ends the profile of the current VM and returns what was measured
+// so far.
+func (p *Profiler) Profile() *Profile {
+	p.finish()
+
+	profile := &Profile{
+		SampleInterval: p.SampleInterval,
+		Instructions:   p.instructions,
+		Start:          p.first,
+		Duration:       p.duration,
+	}
+	for _, fn := range p.functions {
+		profile.Functions = append(profile.Functions, fn)
+	}
+	sort.Slice(profile.Functions, func(i, j int) bool {
+		a, b := profile.Functions[i], profile.Functions[j]
+		if a.SelfInstructions != b.SelfInstructions {
+			return a.SelfInstructions > b.SelfInstructions
+		}
+		return a.Name < b.Name
+	})
+
+	for op, count := range p.opcodes {
+		if count == 0 {
+			continue
+		}
+		name := fmt.Sprintf("Opcode(%d)", op)
+		if def, err := code.Lookup(byte(op)); err == nil {
+			name = def.Name
+		}
+		profile.Opcodes = append(profile.Opcodes, OpcodeProfile{Opcode: code.Opcode(op), Name: name, Count: count})
+	}
+	sort.SliceStable(profile.Opcodes, func(i, j int) bool { return profile.Opcodes[i].Count > profile.Opcodes[j].Count })
+
+	for _, s := range p.samples {
+		profile.Samples = append(profile.Samples, s)
+	}
+	sort.Slice(profile.Samples, func(i, j int) bool { return profile.Samples[i].Count > profile.Samples[j].Count })
+	return profile
+}
+
+// WriteText writes the functions and opcodes of the profile as tables.
+func (p *Profile) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%d instructions in %s\n\n", p.Instructions, p.Duration.Round(time.Microsecond))
+
+	fmt.Fprintf(w, "%10s %12s %7s %12s %7s %12s %12s  %s\n", "calls", "self ins", "self%", "total ins", "total%", "self time", "total time", "function")
+	for _, fn := range p.Functions {
+		location := fn.File
+		if fn.Line != 0 {
+			location = fmt.Sprintf("%s:%d", fn.File, fn.Line)
+		}
+		if fn.File == "" {
+			location = fmt.Sprintf("line %d", fn.Line)
+		}
+		fmt.Fprintf(w, "%10d %12d %6.2f%% %12d %6.2f%% %12s %12s  %s %s\n",
+			fn.Calls, fn.SelfInstructions, percent(fn.SelfInstructions, p.Instructions),
+			fn.TotalInstructions, percent(fn.TotalInstructions, p.Instructions),
+			fn.SelfTime.Round(time.Microsecond), fn.TotalTime.Round(time.Microsecond), fn.Name, location)
+	}
+
+	fmt.Fprintf(w, "\n%-20s %12s %7s\n", "opcode", "count", "%")
+	for _, op := range p.Opcodes {
+		fmt.Fprintf(w, "%-20s %12d %6.2f%%\n", op.Name, op.Count, percent(op.Count, p.Instructions))
+	}
+}
+
+func percent(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// functionName names fn for stack traces and profiles.
+func functionName(fn *object.CompiledFunction, main bool) string {
+	switch {
+	case main:
+		return "main"
+	case fn.Name == "":
+		return "<anonymous>"
+	default:
+		return fn.Name
+	}
+}
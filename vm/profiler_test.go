@@ -0,0 +1,184 @@
+package vm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/tneuqole/monkey-go/compiler"
+)
+
+const profileInput = `let fib = fn(x) {
+  if (x < 2) {
+    return x;
+  }
+  fib(x - 1) + fib(x - 2)
+};
+let double = fn(x) { x * 2 };
+map([1, 2, 3], double);
+fib(10);
+`
+
+func runProfiled(t *testing.T, p *Profiler) *Profile {
+	t.Helper()
+
+	c := compiler.New()
+	if err := c.Compile(parse(profileInput)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(c.Bytecode())
+	machine.SetHook(p.Hook(machine))
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	return p.Profile()
+}
+
+func TestProfiler(t *testing.T) {
+	p := NewProfiler()
+	p.SampleInterval = 100
+	p.Main = "main.mk"
+	profile := runProfiled(t, p)
+
+	functions := make(map[string]*FunctionProfile)
+	var self int64
+	for _, fn := range profile.Functions {
+		functions[fn.Name] = fn
+		self += fn.SelfInstructions
+	}
+	if self != profile.Instructions {
+		t.Errorf("self instructions add up to %d, want %d", self, profile.Instructions)
+	}
+
+	main, fib, double := functions["main"], functions["fib"], functions["double"]
+	if main == nil || fib == nil || double == nil {
+		t.Fatalf("missing functions. got=%v", functions)
+	}
+	if main.Calls != 1 || fib.Calls != 177 || double.Calls != 3 {
+		t.Errorf("wrong calls. main=%d, fib=%d, double=%d", main.Calls, fib.Calls, double.Calls)
+	}
+	if main.TotalInstructions != profile.Instructions {
+		t.Errorf("wrong total instructions of main. want=%d, got=%d", profile.Instructions, main.TotalInstructions)
+	}
+	// the recursive calls of fib are counted once
+	if fib.TotalInstructions != fib.SelfInstructions {
+		t.Errorf("wrong total instructions of fib. want=%d, got=%d", fib.SelfInstructions, fib.TotalInstructions)
+	}
+	if fib.File != "main.mk" || fib.Line != 2 || double.Line != 7 {
+		t.Errorf("wrong locations. fib=%s:%d, double=%d", fib.File, fib.Line, double.Line)
+	}
+	if main.TotalTime < fib.TotalTime || fib.TotalTime < fib.SelfTime {
+		t.Errorf("wrong times. main=%s, fib=%s (self %s)", main.TotalTime, fib.TotalTime, fib.SelfTime)
+	}
+
+	var ops int64
+	counts := make(map[string]int64)
+	for _, op := range profile.Opcodes {
+		ops += op.Count
+		counts[op.Name] = op.Count
+	}
+	// map calls double without OpCall
+	if ops != profile.Instructions || counts["OpMul"] != 3 || counts["OpCall"] != 176+2 {
+		t.Errorf("wrong opcodes. got=%v", profile.Opcodes)
+	}
+
+	var samples int64
+	for _, s := range profile.Samples {
+		samples += s.Count
+		if s.Stack[len(s.Stack)-1].Function != main {
+			t.Errorf("sampled stack does not start in main: %v", s.Stack)
+		}
+	}
+	if samples != profile.Instructions/100 {
+		t.Errorf("wrong number of samples. want=%d, got=%d", profile.Instructions/100, samples)
+	}
+}
+
+func TestProfilerAddsUpRuns(t *testing.T) {
+	p := NewProfiler()
+	first := runProfiled(t, p)
+	second := runProfiled(t, p)
+
+	if second.Instructions != 2*first.Instructions {
+		t.Errorf("wrong instructions. want=%d, got=%d", 2*first.Instructions, second.Instructions)
+	}
+	for _, fn := range second.Functions {
+		if fn.Name == "main" && fn.Calls != 2 {
+			t.Errorf("wrong calls of main. got=%d", fn.Calls)
+		}
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	p := NewProfiler()
+	p.SampleInterval = 100
+	profile := runProfiled(t, p)
+
+	var buf bytes.Buffer
+	if err := profile.WritePprof(&buf); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := make(map[uint64][][]byte)
+	for len(data) != 0 {
+		key, n := readVarint(t, data)
+		data = data[n:]
+		field, value := key>>3, []byte(nil)
+		switch key & 7 {
+		case 0:
+			_, n = readVarint(t, data)
+		case 2:
+			length, m := readVarint(t, data)
+			value = data[m : m+int(length)]
+			n = m + int(length)
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields[field] = append(fields[field], value)
+		data = data[n:]
+	}
+
+	var strs []string
+	for _, s := range fields[6] {
+		strs = append(strs, string(s))
+	}
+	want := map[string]bool{"": false, "samples": false, "time": false, "nanoseconds": false, "instructions": false, "fib": false, "main": false}
+	for _, s := range strs {
+		if _, ok := want[s]; ok {
+			want[s] = true
+		}
+	}
+	for s, found := range want {
+		if !found {
+			t.Errorf("string table %q does not contain %q", strs, s)
+		}
+	}
+	if strs[0] != "" {
+		t.Errorf("string table does not start with the empty string: %q", strs)
+	}
+	if len(fields[1]) != 2 || len(fields[2]) != len(profile.Samples) || len(fields[5]) < 2 {
+		t.Errorf("wrong counts. sample types=%d, samples=%d, functions=%d", len(fields[1]), len(fields[2]), len(fields[5]))
+	}
+}
+
+func readVarint(t *testing.T, data []byte) (uint64, int) {
+	t.Helper()
+	var x uint64
+	for i, b := range data {
+		x |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			return x, i + 1
+		}
+	}
+	t.Fatal("truncated varint")
+	return 0, 0
+}
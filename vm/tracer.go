@@ -0,0 +1,126 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tneuqole/monkey-go/code"
+	"github.com/tneuqole/monkey-go/object"
+)
+
+// TraceEvent describes an instruction about to be executed.
+type TraceEvent struct {
+	Frame *Frame
+	// Depth is the number of frames below Frame, 0 for the main program.
+	Depth    int
+	IP       int
+	Op       code.Opcode
+	Operands []int
+	// Stack holds the values on the stack, top last. It is only valid
+	// during the call to Trace.
+	Stack []object.Object
+}
+
+// Tracer is called with every instruction the VM executes, before the hook.
+type Tracer interface {
+	Trace(e TraceEvent)
+}
+
+// SetTracer installs tracer to be called before every instruction. A nil
+// tracer removes it.
+func (vm *VM) SetTracer(tracer Tracer) {
+	vm.tracer = tracer
+}
+
+func (vm *VM) trace(ins code.Instructions, ip int) {
+	op := code.Opcode(ins[ip])
+	var operands []int
+	if def, err := code.Lookup(byte(op)); err == nil {
+		operands, _ = code.ReadOperands(def, ins[ip+1:])
+	}
+	vm.tracer.Trace(TraceEvent{
+		Frame:    vm.currentFrame(),
+		Depth:    vm.fp - 1,
+		IP:       ip,
+		Op:       op,
+		Operands: operands,
+		Stack:    vm.stack[:vm.sp:vm.sp],
+	})
+}
+
+// TextTracer writes a line for every instruction: where it is, indented by
+// the depth of its frame, the instruction and the top of the stack.
+type TextTracer struct {
+	w io.Writer
+	// Main is the path shown for the main program, by default empty.
+	Main string
+	// StackDepth is how many values from the top of the stack are shown.
+	StackDepth int
+}
+
+func NewTextTracer(w io.Writer) *TextTracer {
+	return &TextTracer{w: w, StackDepth: 8}
+}
+
+func (t *TextTracer) Trace(e TraceEvent) {
+	fn := e.Frame.cl.Fn
+	file := fn.File
+	if file == "" {
+		file = t.Main
+	}
+	where := fmt.Sprintf("%s%s %s:%d", strings.Repeat("  ", e.Depth), functionName(fn, e.Depth == 0), file, e.Frame.Line())
+
+	instruction := fmt.Sprintf("Opcode(%d)", e.Op)
+	if def, err := code.Lookup(byte(e.Op)); err == nil {
+		instruction = def.Name
+	}
+	for _, operand := range e.Operands {
+		instruction += " " + strconv.Itoa(operand)
+	}
+
+	stack := e.Stack
+	elided := ""
+	if len(stack) > t.StackDepth {
+		stack = stack[len(stack)-t.StackDepth:]
+		elided = "... "
+	}
+	values := make([]string, len(stack))
+	for i, value := range stack {
+		values[i] = traceValue(value)
+	}
+
+	fmt.Fprintf(t.w, "%-32s %04d %-22s [%s%s]\n", where, e.IP, instruction, elided, strings.Join(values, ", "))
+}
+
+// traceValue shows value briefly and without the addresses Inspect shows for
+// functions, so that traces of the same program can be compared.
+func traceValue(value object.Object) string {
+	switch value := value.(type) {
+	case nil:
+		return "<nil>"
+	case *object.String:
+		return strconv.Quote(value.Value)
+	case *object.Closure:
+		return "<fn " + functionName(value.Fn, false) + ">"
+	case *object.CompiledFunction:
+		return "<fn " + functionName(value, false) + ">"
+	case *object.Builtin:
+		return "<builtin " + value.Name + ">"
+	case *object.Array:
+		elems := make([]string, len(value.Elements))
+		for i, elem := range value.Elements {
+			elems[i] = traceValue(elem)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case *object.Hash:
+		pairs := []string{}
+		for _, pair := range value.Items() {
+			pairs = append(pairs, traceValue(pair.Key)+": "+traceValue(pair.Value))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	default:
+		return value.Inspect()
+	}
+}
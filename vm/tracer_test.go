@@ -0,0 +1,74 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/tneuqole/monkey-go/code"
+	"github.com/tneuqole/monkey-go/compiler"
+)
+
+type recordingTracer struct {
+	events []string
+}
+
+func (r *recordingTracer) Trace(e TraceEvent) {
+	def, _ := code.Lookup(byte(e.Op))
+	r.events = append(r.events, fmt.Sprintf("%d %s %v %d", e.Depth, def.Name, e.Operands, len(e.Stack)))
+}
+
+func runTraced(t *testing.T, input string, tracer Tracer) {
+	t.Helper()
+
+	c := compiler.New()
+	if err := c.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(c.Bytecode())
+	machine.SetTracer(tracer)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	runTraced(t, `let f = fn(a) { a }; f(1);`, tracer)
+
+	want := []string{
+		"0 OpClosure [0 0] 0",
+		"0 OpSetGlobal [0] 1",
+		"0 OpGetGlobal [0] 0",
+		"0 OpConstant [1] 1",
+		"0 OpCall [1] 2",
+		"1 OpGetLocal [0] 2",
+		"1 OpReturnValue [] 3",
+		"0 OpPop [] 1",
+	}
+	if got, want := fmt.Sprintf("%q", tracer.events), fmt.Sprintf("%q", want); got != want {
+		t.Errorf("wrong events.\nwant=%s\ngot= %s", want, got)
+	}
+}
+
+func TestTextTracer(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTextTracer(&buf)
+	tracer.Main = "main.mk"
+	tracer.StackDepth = 2
+	runTraced(t, "let s = \"a\";\nlen([s, fn() { 1 }, 3]);", tracer)
+
+	want := `main main.mk:1                   0000 OpConstant 0           []
+main main.mk:1                   0003 OpSetGlobal 0          ["a"]
+main main.mk:2                   0006 OpGetBuiltin 0         []
+main main.mk:2                   0008 OpGetGlobal 0          [<builtin len>]
+main main.mk:2                   0011 OpClosure 2 0          [<builtin len>, "a"]
+main main.mk:2                   0015 OpConstant 3           [... "a", <fn <anonymous>>]
+main main.mk:2                   0018 OpArray 3              [... <fn <anonymous>>, 3]
+main main.mk:2                   0021 OpCall 1               [<builtin len>, ["a", <fn <anonymous>>, 3]]
+main main.mk:2                   0023 OpPop                  [3]
+`
+	if buf.String() != want {
+		t.Errorf("wrong trace.\nwant=%s\ngot= %s", want, buf.String())
+	}
+}
@@ -1,7 +1,9 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/tneuqole/monkey-go/code"
 	"github.com/tneuqole/monkey-go/compiler"
@@ -9,15 +11,26 @@ import (
 )
 
 const (
-	StackSize   = 2048
-	GlobalsSize = 65536
-	MaxFrames   = 1024
+	// DefaultMaxStackSize is how many values the stack can hold and
+	// DefaultMaxFrames how deeply calls can nest unless set otherwise.
+	DefaultMaxStackSize = 1 << 20
+	DefaultMaxFrames    = 1 << 16
+	GlobalsSize         = 65536
+
+	// the stack, frames and globals start this small and double as needed
+	initialStackSize   = 64
+	initialFrames      = 16
+	initialGlobalsSize = 64
 )
 
+// ErrStackOverflow is returned by Run when calls nest deeper or need more
+// stack than the limits of the VM allow.
+var ErrStackOverflow = errors.New("stack overflow")
+
 var (
-	True  = &object.Boolean{Value: true}
-	False = &object.Boolean{Value: false}
-	Null  = &object.Null{}
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
 )
 
 type VM struct {
@@ -30,32 +43,115 @@ type VM struct {
 	// always points to next free space
 	// top of stack is stack[sp-1]
 	sp int
+
+	maxStackSize int
+	maxFrames    int
+
+	// imported modules by init function
+	modules map[*object.CompiledFunction]object.Object
+
+	builtins *object.Registry
+	io       *object.IO
+	// failure of a function called by the running builtin, which stops Run
+	// once the builtin returns
+	callErr error
+
+	hook   Hook
+	tracer Tracer
 }
 
+// Hook is called before each instruction is executed with the frame it
+// belongs to. Returning an error stops Run with that error.
+type Hook func(f *Frame) error
+
 func New(bytecode *compiler.Bytecode) *VM {
 	cl := &object.Closure{
-		Fn: &object.CompiledFunction{Instructions: bytecode.Instructions},
+		Fn: &object.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines},
 	}
-	f := NewFrame(cl, 0)
-	frames := make([]*Frame, MaxFrames)
-	frames[0] = f
+	frames := make([]*Frame, 1, initialFrames)
+	frames[0] = NewFrame(cl, 0)
 
 	return &VM{
-		frames:    frames,
-		fp:        1,
-		constants: bytecode.Constants,
-		stack:     make([]object.Object, StackSize),
-		globals:   make([]object.Object, GlobalsSize),
-		sp:        0,
+		frames:       frames,
+		fp:           1,
+		constants:    bytecode.Constants,
+		stack:        make([]object.Object, initialStackSize),
+		globals:      make([]object.Object, initialGlobalsSize),
+		sp:           0,
+		maxStackSize: DefaultMaxStackSize,
+		maxFrames:    DefaultMaxFrames,
+		modules:      make(map[*object.CompiledFunction]object.Object),
+		builtins:     standardBuiltins(),
+		io:           object.StdIO(),
 	}
 }
 
+var (
+	standardOnce     sync.Once
+	standardRegistry *object.Registry
+)
+
+// standardBuiltins returns the registry of VMs made by New. They share one,
+// as the standard builtins keep no state and SetBuiltins replaces it rather
+// than changing it.
+func standardBuiltins() *object.Registry {
+	standardOnce.Do(func() {
+		standardRegistry = object.NewStandardRegistry()
+	})
+	return standardRegistry
+}
+
+// NewWithGlobals returns a VM that keeps the globals of the program in
+// globals. They grow on demand as in New, but into a new slice, so a caller
+// that keeps globals between runs should give room for GlobalsSize of them.
 func NewWithGlobals(bytecode *compiler.Bytecode, globals []object.Object) *VM {
 	vm := New(bytecode)
 	vm.globals = globals
 	return vm
 }
 
+// SetBuiltins sets the builtins the program was compiled with, by default
+// the standard ones.
+func (vm *VM) SetBuiltins(r *object.Registry) {
+	vm.builtins = r
+}
+
+// SetIO sets the streams builtins like puts and readline use, by default
+// those of the process.
+func (vm *VM) SetIO(streams *object.IO) {
+	vm.io = streams
+}
+
+// SetMaxStackSize limits how many values the stack can hold, by default
+// DefaultMaxStackSize. Run fails with ErrStackOverflow when the program
+// needs more.
+func (vm *VM) SetMaxStackSize(n int) {
+	vm.maxStackSize = n
+	if len(vm.stack) > n {
+		vm.stack = vm.stack[:n]
+	}
+}
+
+// SetMaxFrames limits how deeply calls can nest, counting the main program,
+// by default DefaultMaxFrames. Run fails with ErrStackOverflow when the
+// program calls deeper.
+func (vm *VM) SetMaxFrames(n int) {
+	vm.maxFrames = n
+}
+
+// SetHook installs hook to be called before every instruction. A nil hook
+// removes it.
+func (vm *VM) SetHook(hook Hook) {
+	vm.hook = hook
+}
+
+// Location returns the file and line of the instruction being executed, or
+// of the one that made Run fail. The file is empty for the main program.
+func (vm *VM) Location() (string, int) {
+	f := vm.currentFrame()
+	return f.cl.Fn.File, f.Line()
+}
+
 func (vm *VM) StackTop() object.Object {
 	if vm.sp == 0 {
 		return nil
@@ -69,15 +165,30 @@ func (vm *VM) LastPoppedStackElem() object.Object {
 }
 
 func (vm *VM) Run() error {
+	return vm.run(0)
+}
+
+// run executes instructions until the frame at index depth returns, or for
+// depth 0 until the main function ends.
+func (vm *VM) run(depth int) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	for vm.fp > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().ip++
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
 		op = code.Opcode(ins[ip])
 
+		if vm.tracer != nil {
+			vm.trace(ins, ip)
+		}
+		if vm.hook != nil {
+			if err := vm.hook(vm.currentFrame()); err != nil {
+				return err
+			}
+		}
+
 		var err error
 		switch op {
 		case code.OpConstant:
@@ -111,13 +222,20 @@ func (vm *VM) Run() error {
 				vm.currentFrame().ip = pos - 1
 			}
 		case code.OpSetGlobal:
-			globalIndex := code.ReadUint16(ins[ip+1:])
+			globalIndex := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
+			if globalIndex >= len(vm.globals) {
+				vm.growGlobals(globalIndex + 1)
+			}
 			vm.globals[globalIndex] = vm.pop()
 		case code.OpGetGlobal:
-			globalIndex := code.ReadUint16(ins[ip+1:])
+			globalIndex := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
-			err = vm.push(vm.globals[globalIndex])
+			var global object.Object
+			if globalIndex < len(vm.globals) {
+				global = vm.globals[globalIndex]
+			}
+			err = vm.pushVariable(global)
 		case code.OpSetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			f := vm.currentFrame()
@@ -127,7 +245,7 @@ func (vm *VM) Run() error {
 			localIndex := code.ReadUint8(ins[ip+1:])
 			f := vm.currentFrame()
 			f.ip += 1
-			err = vm.push(vm.stack[f.basePointer+int(localIndex)])
+			err = vm.pushVariable(vm.stack[f.basePointer+int(localIndex)])
 		case code.OpArray:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
@@ -139,9 +257,9 @@ func (vm *VM) Run() error {
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
 
-			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
-			if err != nil {
-				return err
+			hash, hashErr := vm.buildHash(vm.sp-numElements, vm.sp)
+			if hashErr != nil {
+				return hashErr
 			}
 
 			vm.sp = vm.sp - numElements
@@ -154,9 +272,24 @@ func (vm *VM) Run() error {
 			numArgs := int(code.ReadUint8(ins[ip+1:]))
 			vm.currentFrame().ip += 1
 			err = vm.executeCall(numArgs)
+		case code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+			err = vm.executeTailCall(numArgs)
 		case code.OpReturnValue:
 			val := vm.pop()
+			if vm.fp == 1 {
+				// a return statement outside functions ends the program
+				// with its value as the last popped element
+				vm.sp = 0
+				vm.stack[0] = val
+				vm.currentFrame().ip = len(ins) - 1
+				continue
+			}
 			f := vm.popFrame()
+			if f.module {
+				vm.modules[f.cl.Fn] = val
+			}
 			vm.pop()
 			vm.sp = f.basePointer - 1
 			err = vm.push(val)
@@ -169,8 +302,11 @@ func (vm *VM) Run() error {
 			builtinIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
-			fn := object.Builtins[builtinIndex]
-			err = vm.push(fn.Builtin)
+			fn := vm.builtins.Get(int(builtinIndex))
+			if fn == nil {
+				return fmt.Errorf("unknown builtin %d", builtinIndex)
+			}
+			err = vm.push(fn)
 		case code.OpClosure:
 			constIndex := int(code.ReadUint16(ins[ip+1:]))
 			numFree := int(code.ReadUint8(ins[ip+3:]))
@@ -180,12 +316,23 @@ func (vm *VM) Run() error {
 			freeIndex := int(code.ReadUint8(ins[ip+1:]))
 			vm.currentFrame().ip += 1
 			cl := vm.currentFrame().cl
-			err = vm.push(cl.Free[freeIndex])
+			err = vm.pushVariable(cl.Free[freeIndex])
 		case code.OpCurrentClosure:
 			cl := vm.currentFrame().cl
 			err = vm.push(cl)
 		case code.OpNull:
 			err = vm.push(Null)
+		case code.OpImport:
+			constIndex := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			err = vm.importModule(constIndex)
+		case code.OpModule:
+			numExports := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			mod := vm.buildModule(vm.sp-numExports*2-1, vm.sp)
+			vm.sp = vm.sp - numExports*2 - 1
+			err = vm.push(mod)
 		}
 
 		if err != nil {
@@ -198,8 +345,10 @@ func (vm *VM) Run() error {
 }
 
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= StackSize {
-		return fmt.Errorf("STACK OVERFLOW")
+	if vm.sp >= len(vm.stack) {
+		if err := vm.reserve(1); err != nil {
+			return err
+		}
 	}
 
 	vm.stack[vm.sp] = o
@@ -208,6 +357,47 @@ func (vm *VM) push(o object.Object) error {
 	return nil
 }
 
+// reserve makes room for n more values on the stack, growing it up to its
+// limit.
+func (vm *VM) reserve(n int) error {
+	need := vm.sp + n
+	if need <= len(vm.stack) {
+		return nil
+	}
+	if need > vm.maxStackSize {
+		return ErrStackOverflow
+	}
+	size := max(2*len(vm.stack), initialStackSize)
+	for size < need {
+		size *= 2
+	}
+	stack := make([]object.Object, min(size, vm.maxStackSize))
+	copy(stack, vm.stack[:vm.sp])
+	vm.stack = stack
+	return nil
+}
+
+// growGlobals makes room for at least n globals, copying them into a new
+// slice.
+func (vm *VM) growGlobals(n int) {
+	size := max(2*len(vm.globals), initialGlobalsSize)
+	for size < n {
+		size *= 2
+	}
+	globals := make([]object.Object, min(size, GlobalsSize))
+	copy(globals, vm.globals)
+	vm.globals = globals
+}
+
+// pushVariable pushes the value of a variable, which is nil if the program
+// reads it in its own definition, as in let a = -a.
+func (vm *VM) pushVariable(o object.Object) error {
+	if o == nil {
+		return fmt.Errorf("variable used before it is defined")
+	}
+	return vm.push(o)
+}
+
 func (vm *VM) pop() object.Object {
 	obj := vm.stack[vm.sp-1]
 	vm.sp--
@@ -231,6 +421,43 @@ func (vm *VM) pushClosure(constIndex, numFree int) error {
 	return vm.push(&object.Closure{Fn: fn, Free: free})
 }
 
+// importModule pushes the module whose init function is the constant at
+// constIndex, running the init function the first time.
+func (vm *VM) importModule(constIndex int) error {
+	fn, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a module: %+v", vm.constants[constIndex])
+	}
+
+	if mod, ok := vm.modules[fn]; ok {
+		return vm.push(mod)
+	}
+
+	cl := &object.Closure{Fn: fn}
+	if err := vm.push(cl); err != nil {
+		return err
+	}
+	if err := vm.callClosure(cl, 0); err != nil {
+		return err
+	}
+	vm.currentFrame().module = true
+	return nil
+}
+
+func (vm *VM) buildModule(start, end int) object.Object {
+	mod := &object.Module{
+		Path:    vm.stack[start].(*object.String).Value,
+		Exports: make(map[string]object.Object),
+	}
+	for i := start + 1; i < end; i += 2 {
+		name := vm.stack[i].(*object.String).Value
+		mod.Names = append(mod.Names, name)
+		mod.Exports[name] = vm.stack[i+1]
+	}
+
+	return mod
+}
+
 func (vm *VM) executeCall(numArgs int) error {
 	callee := vm.stack[vm.sp-numArgs-1]
 	switch callee := callee.(type) {
@@ -244,21 +471,73 @@ func (vm *VM) executeCall(numArgs int) error {
 	}
 }
 
+// executeTailCall calls a closure in place of the function calling it,
+// which returns its value: the closure and its arguments replace those of
+// the caller on the stack and its frame the caller's, so that recursion
+// through tail calls runs in constant space. Builtins are called as usual.
+func (vm *VM) executeTailCall(numArgs int) error {
+	cl, ok := vm.stack[vm.sp-numArgs-1].(*object.Closure)
+	if !ok || vm.fp == 1 {
+		return vm.executeCall(numArgs)
+	}
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	base := vm.currentFrame().basePointer
+	copy(vm.stack[base-1:], vm.stack[vm.sp-numArgs-1:vm.sp])
+	vm.sp = base + numArgs
+	// the arguments are the first locals
+	if err := vm.reserve(cl.Fn.NumLocals - numArgs); err != nil {
+		return err
+	}
+
+	// a new frame in the same place, so that hooks see a call
+	f := NewFrame(cl, base)
+	vm.frames[vm.fp-1] = f
+	vm.enter(f)
+	return nil
+}
+
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 	if numArgs != cl.Fn.NumParameters {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
 	}
 
-	f := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(f)
-	vm.sp += cl.Fn.NumLocals + numArgs
+	// the arguments are the first locals
+	if err := vm.reserve(cl.Fn.NumLocals - numArgs); err != nil {
+		return err
+	}
 
+	f := NewFrame(cl, vm.sp-numArgs)
+	if err := vm.pushFrame(f); err != nil {
+		return err
+	}
+	vm.enter(f)
 	return nil
 }
 
+// enter makes room on the stack for the locals of f, whose arguments are
+// on it.
+func (vm *VM) enter(f *Frame) {
+	end := f.basePointer + f.cl.Fn.NumLocals
+	// clear the slots of other locals, which earlier calls left values in
+	for i := vm.sp; i < end; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = end
+}
+
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
+	result := builtin.Call(host{vm}, args...)
+	if err := vm.callErr; err != nil {
+		vm.callErr = nil
+		return err
+	}
+	if err, ok := result.(*object.Error); ok {
+		return errors.New(err.Message)
+	}
 	vm.sp -= numArgs + 1
 
 	if result != nil {
@@ -269,6 +548,88 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	return nil
 }
 
+// Call calls fn, a closure or builtin, with args and returns its result.
+// Builtins use it through their Host to call the functions passed to them,
+// in which case the closure runs on a new frame above the builtin's caller.
+// It can also be used after Run has returned.
+func (vm *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	switch fn := fn.(type) {
+	case *object.Builtin:
+		result := fn.Call(host{vm}, args...)
+		if err := vm.callErr; err != nil {
+			vm.callErr = nil
+			return nil, err
+		}
+		if err, ok := result.(*object.Error); ok {
+			return nil, errors.New(err.Message)
+		}
+		if result == nil {
+			return Null, nil
+		}
+		return result, nil
+	case *object.Closure:
+		base, depth := vm.sp, vm.fp
+		for _, o := range append([]object.Object{fn}, args...) {
+			if err := vm.push(o); err != nil {
+				vm.sp = base
+				return nil, err
+			}
+		}
+		if err := vm.callClosure(fn, len(args)); err != nil {
+			vm.sp = base
+			return nil, err
+		}
+
+		if err := vm.run(depth); err != nil {
+			return nil, err
+		}
+		return vm.pop(), nil
+	default:
+		return nil, fmt.Errorf("not callable: %s", fn.Type())
+	}
+}
+
+// host is the Host passed to builtins.
+type host struct{ vm *VM }
+
+// Call calls fn for a builtin. A failure is returned to the builtin as an
+// ERROR and also stops Run once the builtin returns, even if the builtin
+// ignores it.
+func (h host) Call(fn object.Object, args ...object.Object) object.Object {
+	vm := h.vm
+	if vm.callErr != nil {
+		return &object.Error{Message: vm.callErr.Error()}
+	}
+
+	result, err := vm.Call(fn, args...)
+	if err != nil {
+		vm.callErr = err
+		return &object.Error{Message: err.Error()}
+	}
+	return result
+}
+
+// Try calls fn for a builtin, which can recover from a failure.
+func (h host) Try(fn object.Object, args ...object.Object) object.Object {
+	vm := h.vm
+	if vm.callErr != nil {
+		return &object.Error{Message: vm.callErr.Error()}
+	}
+
+	sp, fp := vm.sp, vm.fp
+	result, err := vm.Call(fn, args...)
+	if err != nil {
+		// unwind the failed call, which Run would otherwise report
+		vm.sp, vm.fp = sp, fp
+		return &object.Error{Message: err.Error()}
+	}
+	return result
+}
+
+func (h host) IO() *object.IO {
+	return h.vm.io
+}
+
 func (vm *VM) executeBangOperator() error {
 	operand := vm.pop()
 	switch operand {
@@ -322,6 +683,9 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	case code.OpMul:
 		result = leftVal * rightVal
 	case code.OpDiv:
+		if rightVal == 0 {
+			return fmt.Errorf("division by zero")
+		}
 		result = leftVal / rightVal
 	default:
 		return fmt.Errorf("unknown integer operater: %d", op)
@@ -358,9 +722,9 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
 	default:
 		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
 	}
@@ -388,6 +752,8 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 		return vm.executeHashIndex(left, index)
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return vm.executeModuleIndex(left, index)
 	default:
 		return fmt.Errorf("object %T is not indexable for %T.", left, left)
 	}
@@ -402,18 +768,28 @@ func (vm *VM) executeArrayIndex(left, index object.Object) error {
 	return vm.push(arr.Elements[i])
 }
 
+func (vm *VM) executeModuleIndex(left, index object.Object) error {
+	mod := left.(*object.Module)
+	name := index.(*object.String).Value
+	val, ok := mod.Exports[name]
+	if !ok {
+		return fmt.Errorf("%s has no export %s", mod.Inspect(), name)
+	}
+	return vm.push(val)
+}
+
 func (vm *VM) executeHashIndex(left, index object.Object) error {
 	hash := left.(*object.Hash)
-	key, ok := index.(object.Hashable)
+	key, ok := object.AsHashable(index)
 	if !ok {
 		return fmt.Errorf("index not hashable: %s", index)
 	}
 
-	pair, ok := hash.Pairs[key.HashKey()]
+	val, ok := hash.Get(key)
 	if !ok {
 		return vm.push(Null)
 	}
-	return vm.push(pair.Value)
+	return vm.push(val)
 }
 
 func (vm *VM) buildArray(start, end int) object.Object {
@@ -426,28 +802,36 @@ func (vm *VM) buildArray(start, end int) object.Object {
 }
 
 func (vm *VM) buildHash(start, end int) (object.Object, error) {
-	pairs := make(map[object.HashKey]object.HashPair, end-start)
+	hash := object.NewHash()
 	for i := start; i < end; i += 2 {
 		k := vm.stack[i]
 		v := vm.stack[i+1]
 
-		hashKey, ok := k.(object.Hashable)
+		hashKey, ok := object.AsHashable(k)
 		if !ok {
 			return nil, fmt.Errorf("object is not hashable %s", k)
 		}
-		pairs[hashKey.HashKey()] = object.HashPair{Key: k, Value: v}
+		hash.Set(hashKey, v)
 	}
 
-	return &object.Hash{Pairs: pairs}, nil
+	return hash, nil
 }
 
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.fp-1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
-	vm.frames[vm.fp] = f
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.fp >= vm.maxFrames {
+		return ErrStackOverflow
+	}
+	if vm.fp == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.fp] = f
+	}
 	vm.fp++
+	return nil
 }
 
 func (vm *VM) popFrame() *Frame {
@@ -1,10 +1,15 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/tneuqole/monkey-go/ast"
+	"github.com/tneuqole/monkey-go/code"
 	"github.com/tneuqole/monkey-go/compiler"
 	"github.com/tneuqole/monkey-go/lexer"
 	"github.com/tneuqole/monkey-go/object"
@@ -40,16 +45,23 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 		}
 
 		vm := New(c.Bytecode())
-		err = vm.Run()
-		if err != nil {
+		actual, err := runResult(vm)
+		if _, ok := tt.expected.(*object.Error); err != nil && !ok {
 			t.Fatalf("vm error: %s", err)
 		}
-
-		actual := vm.LastPoppedStackElem()
 		testExpectedObject(t, tt.expected, actual)
 	}
 }
 
+// runResult runs vm and returns the last popped element or, if a builtin
+// failed and stopped it, the error as an ERROR.
+func runResult(vm *VM) (object.Object, error) {
+	if err := vm.Run(); err != nil {
+		return &object.Error{Message: err.Error()}, err
+	}
+	return vm.LastPoppedStackElem(), nil
+}
+
 func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -143,6 +155,9 @@ func TestIndexExpressions(t *testing.T) {
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
 		{"{}[0]", Null},
+		{`{[1, "a"]: 1, [1]: 2}[[1, "a"]]`, 1},
+		{"{[1, [2]]: 3}[[1, [2]]]", 3},
+		{"{[1]: 1}[[2]]", Null},
 	}
 	runVmTests(t, tests)
 }
@@ -204,6 +219,7 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"-10", -10},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"1 / 0", &object.Error{Message: "division by zero"}},
 	}
 
 	runVmTests(t, tests)
@@ -237,6 +253,17 @@ func TestBooleanExpressions(t *testing.T) {
 		{"!!false", false},
 		{"!!5", true},
 		{"!(if (false) {5;})", true},
+		{`"a" == "a"`, true},
+		{`"a" + "b" == "ab"`, true},
+		{`"a" != "b"`, true},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, [2]] != [1, [3]]", true},
+		{"[1, 2] == [1]", false},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{"first([]) == first([])", true},
+		{`1 == "1"`, false},
+		{"[1] == 1", false},
 	}
 
 	runVmTests(t, tests)
@@ -254,6 +281,10 @@ func TestConditionals(t *testing.T) {
 		{"if (1 > 2) {10}", Null},
 		{"if (false) {10}", Null},
 		{"if ((if (false) {10})) {10} else {20}", 20},
+		{"if (true) {}", Null},
+		{"if (true) {let a = 1;}", Null},
+		{"fn() { 1 + if (true) { return 2 } else { 3 } }()", 2},
+		{"return 5; 6", 5},
 	}
 
 	runVmTests(t, tests)
@@ -264,6 +295,8 @@ func TestGlobalLetStatements(t *testing.T) {
 		{"let one = 1; one", 1},
 		{"let one = 1; let two = 2; one + two", 3},
 		{"let one = 1; let two = one + one; one + two", 3},
+		{"let one = 1; let one = one + 1; one", 2},
+		{"fn() { let one = 1; let one = one + 1; one }()", 2},
 	}
 	runVmTests(t, tests)
 }
@@ -531,11 +564,26 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	}
 }
 
+func TestRuntimeErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = -a;", &object.Error{Message: "variable used before it is defined"}},
+		{"let a = fn() { a }(); -a", &object.Error{Message: "variable used before it is defined"}},
+		{"fn() { let a = [fn() { a }]; a[0]() + 1 }()", &object.Error{Message: "variable used before it is defined"}},
+		{"let f = fn() { let x = 5; x }; f(); fn() { let a = -a; a }()", &object.Error{Message: "variable used before it is defined"}},
+		{"let f = fn() { f() + 1 }; f()", &object.Error{Message: "stack overflow"}},
+		{"let f = fn(n) { let a = 1; let b = 2; f(n + a + b) + 1 }; f(0)", &object.Error{Message: "stack overflow"}},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []vmTestCase{
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`let s = "héllo"; len(s) - len(chars(s))`, 0},
 		{
 			`len(1)`,
 			&object.Error{
@@ -580,6 +628,431 @@ func TestBuiltinFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestCustomBuiltins(t *testing.T) {
+	r := object.NewStandardRegistry("puts")
+	r.Register("sum", object.AtLeast(1), func(args ...object.Object) object.Object {
+		var sum int64
+		for _, arg := range args {
+			sum += arg.(*object.Integer).Value
+		}
+		return &object.Integer{Value: sum}
+	})
+
+	c := compiler.NewWithBuiltins(r)
+	if err := c.Compile(parse(`puts(1)`)); err == nil || err.Error() != "1:1: undefined variable puts" {
+		t.Errorf("expected puts to be undefined. got=%v", err)
+	}
+
+	tests := []vmTestCase{
+		{`sum(1, 2, 3) + len([1])`, 7},
+		{`let f = fn(g) { g(4) }; f(sum)`, 4},
+		{`sum()`, &object.Error{Message: "wrong number of arguments. got=0, want=at least 1"}},
+	}
+
+	for _, tt := range tests {
+		c := compiler.NewWithBuiltins(r)
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(c.Bytecode())
+		vm.SetBuiltins(r)
+		actual, err := runResult(vm)
+		if _, ok := tt.expected.(*object.Error); err != nil && !ok {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, actual)
+	}
+
+	// bytecode compiled against a larger registry
+	c = compiler.NewWithBuiltins(r)
+	c.Compile(parse(`sum(1)`))
+	vm := New(c.Bytecode())
+	vm.SetBuiltins(object.NewRegistry())
+	if err, want := vm.Run(), fmt.Sprintf("unknown builtin %d", len(r.All())-1); err == nil || err.Error() != want {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	// VMs made by New share the standard builtins, which SetBuiltins above
+	// replaced rather than changed
+	c = compiler.New()
+	c.Compile(parse(`len([1, 2])`))
+	vm = New(c.Bytecode())
+	actual, err := runResult(vm)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 2, actual)
+	if allocs := testing.AllocsPerRun(10, func() { New(c.Bytecode()) }); allocs > 20 {
+		t.Errorf("New made %.0f allocations, want at most 20", allocs)
+	}
+}
+
+// higherOrderBuiltins returns the standard builtins plus some that call
+// the functions passed to them.
+func higherOrderBuiltins() *object.Registry {
+	r := object.NewStandardRegistry()
+	r.RegisterHost("apply", object.Exactly(2), func(host object.Host, args ...object.Object) object.Object {
+		arr := args[0].(*object.Array)
+		result := make([]object.Object, len(arr.Elements))
+		for i, elem := range arr.Elements {
+			result[i] = host.Call(args[1], elem)
+			if _, ok := result[i].(*object.Error); ok {
+				return result[i]
+			}
+		}
+		return &object.Array{Elements: result}
+	})
+	r.RegisterHost("ignore", object.Exactly(1), func(host object.Host, args ...object.Object) object.Object {
+		host.Call(args[0])
+		return nil
+	})
+	r.RegisterHost("recover", object.Exactly(1), func(host object.Host, args ...object.Object) object.Object {
+		result := host.Try(args[0])
+		if err, ok := result.(*object.Error); ok {
+			return &object.String{Value: "recovered: " + err.Message}
+		}
+		return result
+	})
+	r.RegisterFunc("count_if", func(arr []int, pred func(int) (bool, error)) (int, error) {
+		n := 0
+		for _, x := range arr {
+			ok, err := pred(x)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				n++
+			}
+		}
+		return n, nil
+	})
+	return r
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	r := higherOrderBuiltins()
+	tests := []vmTestCase{
+		{`apply([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`let n = 10; apply([1, 2], fn(x) { x + n })`, []int{11, 12}},
+		{`apply([[1], [2, 3]], len)`, []int{1, 2}},
+		{`apply([1, 2], fn(x) { apply([x], fn(y) { y * 10 })[0] + 1 })`, []int{11, 21}},
+		{`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; apply([10, 15], fib)`, []int{55, 610}},
+		{`let f = fn() { apply([1], fn(x) { return x; 99 }) }; f()[0] + 1`, 2},
+		{`count_if([1, 2, 3, 4], fn(x) { x > 2 })`, 2},
+		{`count_if([1, 2], fn(x) { apply([x], fn(y) { y == 2 })[0] })`, 1},
+		{`ignore(fn() { 1 }); 5`, 5},
+		{`recover(fn() { 1 })`, 1},
+		{`recover(fn() { -true })`, "recovered: unsupported type for negation: BOOLEAN"},
+		{`let f = fn(x) { recover(fn() { x + apply([1], fn(y) { y + true })[0] }) }; f(1)`, "recovered: unsupported types for binary operation: INTEGER BOOLEAN"},
+		{`let f = fn() { recover(fn() { [1, 2, len(1)] }); 3 }; [f(), 4][0]`, 3},
+	}
+
+	for _, tt := range tests {
+		c := compiler.NewWithBuiltins(r)
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(c.Bytecode())
+		vm.SetBuiltins(r)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if vm.sp != 0 {
+			t.Errorf("stack not empty after %q: sp=%d", tt.input, vm.sp)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestHigherOrderBuiltinErrors(t *testing.T) {
+	r := higherOrderBuiltins()
+	tests := []struct {
+		input    string
+		expected string
+		line     int
+	}{
+		{"apply([1], fn(x) {\n-true })", "unsupported type for negation: BOOLEAN", 2},
+		{"apply([1], fn(x, y) { x })", "wrong number of arguments: want=2, got=1", 1},
+		{"apply([1], 5)", "not callable: INTEGER", 1},
+		{"let f = fn() {\n-true };\nignore(f); 1", "unsupported type for negation: BOOLEAN", 2},
+		{"count_if([1], fn(x) {\n\nx + true })", "unsupported types for binary operation: INTEGER BOOLEAN", 3},
+	}
+
+	for _, tt := range tests {
+		c := compiler.NewWithBuiltins(r)
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(c.Bytecode())
+		vm.SetBuiltins(r)
+		err := vm.Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+			continue
+		}
+		if _, line := vm.Location(); line != tt.line {
+			t.Errorf("wrong line for %q. want=%d, got=%d", tt.input, tt.line, line)
+		}
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`let n = 10; map([1, 2], fn(x) { x + n })`, "[11, 12]"},
+		{`map([[1], [2, 3]], len)`, "[1, 2]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`map(1, fn(x) { x })`, "ERROR: argument to `map` must be ARRAY or HASH, got=INTEGER"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`filter([1, 2], fn(x) { if (x > 1) { "yes" } })`, "[2]"},
+		{`reduce([1, 2, 3], fn(acc, x) { acc + x })`, "6"},
+		{`reduce([1, 2, 3], fn(acc, x) { push(acc, x * x) }, [])`, "[1, 4, 9]"},
+		{`reduce([], fn(acc, x) { acc + x }, 0)`, "0"},
+		{`reduce([], fn(acc, x) { acc + x })`, "ERROR: `reduce` of empty ARRAY with no initial value"},
+		{`each([1, 2], fn(x) { x })`, "null"},
+		{`range(4)`, "[0, 1, 2, 3]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`range(5, 0, -2)`, "[5, 3, 1]"},
+		{`range(3, 1)`, "[]"},
+		{`range(0, 1, 0)`, "ERROR: `range` step must not be 0"},
+		{`range(1, "a")`, "ERROR: argument 2 to `range` must be INTEGER, got=STRING"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`zip([1], [2], [3])`, "[[1, 2, 3]]"},
+		{`enumerate(["a", "b"])`, "[[0, a], [1, b]]"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([1, "a"])`, "ERROR: `sort` cannot compare INTEGER and STRING"},
+		{`sort([[1]])`, "ERROR: `sort` cannot compare ARRAY"},
+		{`sort_by(["ccc", "a", "bb"], len)`, "[a, bb, ccc]"},
+		{`sort_by([[2, "a"], [1, "b"], [2, "c"]], first)`, "[[1, b], [2, a], [2, c]]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`reverse("abc")`, "cba"},
+		{`slice([1, 2, 3, 4], 1, 3)`, "[2, 3]"},
+		{`slice([1, 2, 3, 4], -2)`, "[3, 4]"},
+		{`slice([1, 2], 5)`, "[]"},
+		{`slice("hello", 1, -1)`, "ell"},
+		{`contains([1, "a"], "a")`, "true"},
+		{`contains([1, 2], 3)`, "false"},
+		{`contains("hello", "ell")`, "true"},
+		{`contains({"a": 1}, "a")`, "true"},
+		{`index_of([1, 2, 3], 3)`, "2"},
+		{`index_of([1, 2, 3], 4)`, "-1"},
+		{`index_of("hello", "l")`, "2"},
+		{`flatten([1, [2, [3]], []])`, "[1, 2, [3]]"},
+		{`flatten([1, [2, [3]]], 2)`, "[1, 2, 3]"},
+		{`uniq([1, 2, 1, "a", "a", true, true])`, "[1, 2, a, true]"},
+		{`let f = fn(xs) { map(filter(xs, fn(x) { x > 1 }), fn(x) { x * 10 }) }; f(range(4))`, "[20, 30]"},
+	}
+
+	for _, tt := range tests {
+		c := compiler.New()
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(c.Bytecode())
+		result, _ := runResult(vm)
+		if got := result.Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, 3: true}`, "{b: 1,a: 2,3: true}"},
+		{`keys({"b": 1, "a": 2})`, "[b, a]"},
+		{`values({"b": 1, "a": 2})`, "[1, 2]"},
+		{`items({"b": 1, "a": 2})`, "[[b, 1], [a, 2]]"},
+		{`keys({})`, "[]"},
+		{`keys([1])`, "ERROR: argument to `keys` must be HASH, got=ARRAY"},
+		{`has_key({"a": 1}, "a")`, "true"},
+		{`has_key({"a": 1}, "b")`, "false"},
+		{`has_key({"a": 1}, [{}])`, "ERROR: not hashable: ARRAY"},
+		{`delete({"a": 1, "b": 2, "c": 3}, "b")`, "{a: 1,c: 3}"},
+		{`let h = {"a": 1}; delete(h, "a"); h`, "{a: 1}"},
+		{`merge({"a": 1, "b": 2}, {"b": 3, "c": 4})`, "{a: 1,b: 3,c: 4}"},
+		{`merge({"a": 1}, 2)`, "ERROR: argument 2 to `merge` must be HASH, got=INTEGER"},
+		{`len({"a": 1, "b": 2})`, "2"},
+		{`map({"a": 1, "b": 2}, fn(k, v) { k + "=" + format("{}", v) })`, "[a=1, b=2]"},
+		{`filter({"a": 1, "b": 2, "c": 3}, fn(k, v) { v != 2 })`, "{a: 1,c: 3}"},
+		{`let total = fn(h) { reduce(values(h), fn(acc, v) { acc + v }, 0) }; total({"a": 1, "b": 2})`, "3"},
+		{`each({"a": 1}, fn(k, v) { v })`, "null"},
+	}
+
+	for _, tt := range tests {
+		c := compiler.New()
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(c.Bytecode())
+		result, _ := runResult(vm)
+		if got := result.Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_stringify({"b": [1, true, first([])], "a": "x"})`, `{"b":[1,true,null],"a":"x"}`},
+		{`json_parse(json_stringify({"b": [1, {}], "a": "x"}))`, "{b: [1, {}],a: x}"},
+		{`json_stringify([len])`, "ERROR: json_stringify: cannot serialize BUILTIN"},
+		{`json_parse("[1, 2")`, "ERROR: json_parse: unexpected end of JSON input"},
+		{`json_parse(1)`, "ERROR: argument to `json_parse` must be STRING, got=INTEGER"},
+	}
+
+	for _, tt := range tests {
+		c := compiler.New()
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(c.Bytecode())
+		result, _ := runResult(vm)
+		if got := result.Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{`split("  a b  c ")`, "[a, b, c]"},
+		{`split(1, ",")`, "ERROR: argument to `split` must be STRING, got=INTEGER"},
+		{`join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`join([1, true, "x"])`, "1truex"},
+		{`join(["a"], 1)`, "ERROR: argument 2 to `join` must be STRING, got=INTEGER"},
+		{`trim("  hi  ")`, "hi"},
+		{`trim("xxhixx", "x")`, "hi"},
+		{`upper("héllo")`, "HÉLLO"},
+		{`lower("HeLLo")`, "hello"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`replace("a-b-c", "-", "+", 1)`, "a+b-c"},
+		{`replace("abc", "b", 1)`, "ERROR: argument 3 to `replace` must be STRING, got=INTEGER"},
+		{`contains("hello", "ell")`, "true"},
+		{`starts_with("hello", "he")`, "true"},
+		{`ends_with("hello", "he")`, "false"},
+		{`starts_with("hello", ["he"])`, "ERROR: argument 2 to `starts_with` must be STRING, got=ARRAY"},
+		{`index_of("héllo", "l")`, "2"},
+		{`index_of("hello", "z")`, "-1"},
+		{`substring("héllo", 1, 3)`, "él"},
+		{`substring("héllo", -2)`, "lo"},
+		{`substring([1], 0)`, "ERROR: argument to `substring` must be STRING, got=ARRAY"},
+		{`slice("日本語", 1)`, "本語"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", -1)`, "ERROR: `repeat` count must not be negative, got=-1"},
+		{`chars("héy")`, "[h, é, y]"},
+		{`char(97)`, "a"},
+		{`char(-1)`, "ERROR: `char` of invalid code point -1"},
+		{`ord("é")`, "233"},
+		{`ord("ab")`, `ERROR: argument to ` + "`ord`" + ` must be a single character, got="ab"`},
+		{`format("{} is {}", "x", 1)`, "x is 1"},
+		{`format("{{}} {}", [1, 2])`, "{} [1, 2]"},
+		{`format("{}")`, "ERROR: `format` has more placeholders than arguments (0)"},
+		{`format("{}", 1, 2)`, "ERROR: `format` has 1 placeholders but 2 arguments"},
+		{`format("{x}", 1)`, `ERROR: ` + "`format`" + ` has unmatched '{' at offset 0`},
+		{`format(1)`, "ERROR: argument to `format` must be STRING, got=INTEGER"},
+	}
+
+	for _, tt := range tests {
+		c := compiler.New()
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(c.Bytecode())
+		result, _ := runResult(vm)
+		if got := result.Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestIOBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		stdin    string
+		expected interface{}
+		stdout   string
+		stderr   string
+	}{
+		{`puts("a", 1)`, "", Null, "a\n1\n", ""},
+		{`print("a", 1, [2])`, "", Null, "a 1 [2]\n", ""},
+		{`print()`, "", Null, "\n", ""},
+		{`eprint("oops")`, "", Null, "", "oops\n"},
+		{`readline()`, "one\ntwo\n", "one", "", ""},
+		{`readline(); readline()`, "one\r\ntwo", "two", "", ""},
+		{`readline()`, "", Null, "", ""},
+		{`input("name? ")`, "bob\n", "bob", "name? ", ""},
+		{`input(1)`, "", &object.Error{Message: "argument to `input` must be STRING, got=INTEGER"}, "", ""},
+	}
+
+	for _, tt := range tests {
+		c := compiler.New()
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		var stdout, stderr strings.Builder
+		vm := New(c.Bytecode())
+		vm.SetIO(object.NewIO(strings.NewReader(tt.stdin), &stdout, &stderr))
+		actual, err := runResult(vm)
+		if _, ok := tt.expected.(*object.Error); err != nil && !ok {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.expected, actual)
+		if stdout.String() != tt.stdout {
+			t.Errorf("wrong stdout for %q. want=%q, got=%q", tt.input, tt.stdout, stdout.String())
+		}
+		if stderr.String() != tt.stderr {
+			t.Errorf("wrong stderr for %q. want=%q, got=%q", tt.input, tt.stderr, stderr.String())
+		}
+	}
+}
+
+func TestCallAfterRun(t *testing.T) {
+	c := compiler.New()
+	if err := c.Compile(parse(`let add = fn(a, b) { a + b }; let x = 1;`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(c.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	add := vm.globals[0]
+	result, err := vm.Call(add, &object.Integer{Value: 2}, &object.Integer{Value: 3})
+	if err != nil {
+		t.Fatalf("call failed: %s", err)
+	}
+	testExpectedObject(t, 5, result)
+
+	if _, err := vm.Call(add); err == nil || err.Error() != "wrong number of arguments: want=2, got=0" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	if vm.sp != 0 || vm.fp != 1 {
+		t.Errorf("vm not reset after call: sp=%d, fp=%d", vm.sp, vm.fp)
+	}
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -709,6 +1182,158 @@ func TestRecursiveFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+				let count = fn(n, acc) {
+					if (n == 0) { acc } else { count(n - 1, acc + 1) }
+				};
+				count(1000000, 0);
+				`,
+			expected: 1000000,
+		},
+		{
+			input: `
+				let even = fn(n, odd) { if (n == 0) { true } else { return odd(n - 1, even); } };
+				let odd = fn(n, even) { if (n == 0) { false } else { even(n - 1, odd) } };
+				even(100001, odd);
+				`,
+			expected: false,
+		},
+		{
+			// the callee has more locals than the caller, whose slots it
+			// must not see
+			input: `
+				let inner = fn(a) { let b = a * 2; let c = b + 1; [a, b, c] };
+				let outer = fn() { inner(5) };
+				outer();
+				`,
+			expected: []int{5, 10, 11},
+		},
+		{
+			input: `
+				let f = fn(xs) { if (len(xs) > 2) { len(xs) } else { f(push(xs, 0)) } };
+				f([]);
+				`,
+			expected: 3,
+		},
+		{
+			input: `
+				let add = fn(a, b) { a + b };
+				let f = fn(x) { add(x) };
+				f(1);
+				`,
+			expected: &object.Error{Message: "wrong number of arguments: want=2, got=1"},
+		},
+	}
+	runVmTests(t, tests)
+}
+
+// tailCallTracer checks that the first instruction after each tail call
+// finds the stack holding just the callee and its locals.
+type tailCallTracer struct {
+	t         *testing.T
+	tailCalls int
+	afterCall bool
+}
+
+func (tr *tailCallTracer) Trace(e TraceEvent) {
+	if tr.afterCall {
+		want := e.Frame.basePointer + e.Frame.cl.Fn.NumLocals
+		if len(e.Stack) != want {
+			tr.t.Errorf("after tail call %d the stack holds %d values, want %d", tr.tailCalls, len(e.Stack), want)
+		}
+	}
+	tr.afterCall = e.Op == code.OpTailCall
+	if tr.afterCall {
+		tr.tailCalls++
+	}
+}
+
+func TestTailCallStack(t *testing.T) {
+	input := `
+		let f = fn(a, b, c) {
+			let d = a + b;
+			if (a == 0) { d + c } else { f(a - 1, b + 1, c) }
+		};
+		let g = fn(x) { f(x, 0, 10) };
+		g(3);
+	`
+	c := compiler.New()
+	if err := c.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(c.Bytecode())
+	tracer := &tailCallTracer{t: t}
+	machine.SetTracer(tracer)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if err := testIntegerObject(13, machine.LastPoppedStackElem()); err != nil {
+		t.Errorf("testIntegerObject failed: %s", err)
+	}
+	if tracer.tailCalls != 4 {
+		t.Errorf("got %d tail calls, want 4", tracer.tailCalls)
+	}
+}
+
+func TestStackLimits(t *testing.T) {
+	// depth calls itself n levels deep with a few values on the stack each
+	const depth = `
+		let depth = fn(n) { if (n == 0) { 0 } else { let m = n - 1; 1 + depth(m) } };
+		depth(%d);
+	`
+	tests := []struct {
+		input              string
+		maxStack, maxFrame int
+		expected           interface{}
+	}{
+		// far deeper than the stack and frames New starts with
+		{fmt.Sprintf(depth, 10000), 0, 0, 10000},
+		// the main program and 99 calls
+		{fmt.Sprintf(depth, 98), 0, 100, 98},
+		{fmt.Sprintf(depth, 99), 0, 100, ErrStackOverflow},
+		{fmt.Sprintf(depth, 100), 200, 0, ErrStackOverflow},
+		{"[" + strings.Repeat("1, ", 99) + "1]", 100, 0, 100},
+		{"[" + strings.Repeat("1, ", 100) + "1]", 100, 0, ErrStackOverflow},
+		{"[" + strings.Repeat("1, ", 100) + "{}]", 100, 0, ErrStackOverflow},
+	}
+
+	for _, tt := range tests {
+		c := compiler.New()
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(c.Bytecode())
+		if tt.maxStack != 0 {
+			vm.SetMaxStackSize(tt.maxStack)
+		}
+		if tt.maxFrame != 0 {
+			vm.SetMaxFrames(tt.maxFrame)
+		}
+
+		err := vm.Run()
+		switch expected := tt.expected.(type) {
+		case error:
+			if !errors.Is(err, expected) {
+				t.Errorf("got error %v, want %v", err, expected)
+			}
+		case int:
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			result := vm.LastPoppedStackElem()
+			if arr, ok := result.(*object.Array); ok {
+				result = &object.Integer{Value: int64(len(arr.Elements))}
+			}
+			if err := testIntegerObject(int64(expected), result); err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	}
+}
+
 func TestRecursiveFibonacci(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -731,3 +1356,87 @@ func TestRecursiveFibonacci(t *testing.T) {
 	}
 	runVmTests(t, tests)
 }
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	modules := map[string]string{
+		"math.mk": `let square = fn(x) { x * x };
+let secret = 7;
+let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) };
+export let cube = fn(x) { square(x) * x };
+export let answer = secret * 6;
+export let sign = fn(x) { unless(x > 0, "negative", "positive") };`,
+		"lib/util.mk": `let m = import "../math";
+export let math = m;
+export let nine = m["cube"](3) / 3;`,
+	}
+	for name, src := range modules {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []vmTestCase{
+		{`let m = import "DIR/math"; m["cube"](3)`, 27},
+		{`import "DIR/math"["answer"]`, 42},
+		{`let secret = 1; let m = import "DIR/math"; secret + m["answer"]`, 43},
+		{`let m = import "DIR/math"; let u = import "DIR/lib/util"; m == u["math"]`, true},
+		{`let f = fn() { import "DIR/math" }; f() == f()`, true},
+		{`import "DIR/lib/util"["nine"]`, 9},
+		{`import "DIR/math"["sign"](-1)`, "negative"},
+	}
+	for i := range tests {
+		tests[i].input = strings.ReplaceAll(tests[i].input, "DIR", dir)
+	}
+	runVmTests(t, tests)
+
+	program := parse(`import "` + dir + `/math"["square"]`)
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(c.Bytecode()).Run()
+	if expected := `module("` + dir + `/math.mk") has no export square`; err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
+
+func FuzzRun(f *testing.F) {
+	for _, seed := range []string{
+		"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10)",
+		`let h = {"a": [1, 2], [3]: fn(x) { x }}; h[[3]](h["a"][1])`,
+		`map(range(0, 5), fn(x) { x * 2 })`,
+		"let f = fn() { f() }; f()",
+		`puts(len("abc") / 0)`,
+		"let a = 1; let a = a + 1; -a",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+		c := compiler.New()
+		if err := c.Compile(program); err != nil {
+			return
+		}
+
+		// any failure must be a runtime error rather than a panic
+		vm := New(c.Bytecode())
+		vm.SetIO(object.NewIO(nil, nil, nil))
+		// tail calls loop without using up the stack, so stop them here
+		steps := 0
+		vm.SetHook(func(*Frame) error {
+			if steps++; steps > 1000000 {
+				return errors.New("too many steps")
+			}
+			return nil
+		})
+		vm.Run()
+	})
+}